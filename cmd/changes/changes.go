@@ -0,0 +1,347 @@
+package changes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+// sailing is what the diff compares, for either kind of route
+type sailing struct {
+	date          string
+	departureTime string
+	departure     time.Time
+	cancelled     bool
+	departed      bool
+	vesselName    string
+	status        string
+	fill          int
+	capacity      models.CapacitySailing
+}
+
+/*
+ * DiffCapacityRoute
+ *
+ * Compares two scrapes of a capacity route and returns what changed, soonest
+ * sailing first. Sailings are matched by date and scheduled departure, so the
+ * page rolling over at midnight isn't a change.
+ *
+ * Sailings dropping off the page after they leave, and tomorrow's sailings
+ * being published, are normal and not reported. A sailing is reported as added
+ * only if it departs before the last sailing previously listed, and as removed
+ * only if it disappears before it was due to leave.
+ *
+ * Returns nothing if either scrape has no sailings, e.g. the first scrape.
+ *
+ * @param models.CapacityRoute previous
+ * @param models.CapacityRoute current
+ * @param time.Time detectedAt
+ *
+ * @return []models.ServiceChange
+ */
+func DiffCapacityRoute(previous models.CapacityRoute, current models.CapacityRoute, detectedAt time.Time) []models.ServiceChange {
+	if len(previous.Sailings) == 0 || len(current.Sailings) == 0 {
+		return nil
+	}
+
+	loc := sailingtime.Location()
+	return diff(current.RouteCode, capacitySailings(previous, loc), capacitySailings(current, loc), detectedAt, false)
+}
+
+/*
+ * DiffNonCapacityRoute
+ *
+ * Compares two scrapes of a non capacity route's schedule and returns what
+ * changed, soonest sailing first. Schedules for different days aren't compared.
+ *
+ * @param models.NonCapacityRoute previous
+ * @param models.NonCapacityRoute current
+ * @param time.Time detectedAt
+ *
+ * @return []models.ServiceChange
+ */
+func DiffNonCapacityRoute(previous models.NonCapacityRoute, current models.NonCapacityRoute, detectedAt time.Time) []models.ServiceChange {
+	if len(previous.Sailings) == 0 || len(current.Sailings) == 0 {
+		return nil
+	}
+
+	loc := sailingtime.Location()
+	before, after := nonCapacitySailings(previous, loc), nonCapacitySailings(current, loc)
+	if len(before) == 0 || len(after) == 0 || before[0].date != after[0].date {
+		return nil
+	}
+
+	return diff(current.RouteCode, before, after, detectedAt, true)
+}
+
+/*
+ * DiffCapacityFill
+ *
+ * Compares two scrapes of a capacity route and returns the sailings that are
+ * still to leave whose fill changed, soonest sailing first.
+ *
+ * @param models.CapacityRoute previous
+ * @param models.CapacityRoute current
+ * @param time.Time detectedAt
+ *
+ * @return []models.FillChange
+ */
+func DiffCapacityFill(previous models.CapacityRoute, current models.CapacityRoute, detectedAt time.Time) []models.FillChange {
+	loc := sailingtime.Location()
+
+	byKey := make(map[string]sailing, len(previous.Sailings))
+	for _, s := range capacitySailings(previous, loc) {
+		byKey[s.date+" "+s.departureTime] = s
+	}
+
+	var fills []models.FillChange
+	for _, s := range capacitySailings(current, loc) {
+		old, ok := byKey[s.date+" "+s.departureTime]
+		if !ok || s.departed || s.cancelled || s.fill == old.fill {
+			continue
+		}
+
+		fills = append(fills, models.FillChange{
+			RouteCode:     current.RouteCode,
+			SailingDate:   s.date,
+			DepartureTime: s.departureTime,
+			VesselName:    s.vesselName,
+			PreviousFill:  old.fill,
+			CurrentFill:   s.fill,
+			DetectedAt:    detectedAt,
+		})
+	}
+
+	sort.SliceStable(fills, func(i, j int) bool {
+		if fills[i].SailingDate != fills[j].SailingDate {
+			return fills[i].SailingDate < fills[j].SailingDate
+		}
+		return sortMinutes(fills[i].DepartureTime) < sortMinutes(fills[j].DepartureTime)
+	})
+
+	return fills
+}
+
+/*
+ * DiffCapacitySailings
+ *
+ * Compares two scrapes of a capacity route sailing by sailing, in the order
+ * they are listed. A sailing that leaves is departed, one that reaches the other side is
+ * arrived (after departed, if both happened between the scrapes), and one
+ * that is cancelled is cancelled. Any other change, including a sailing
+ * appearing, is an update. Returns nothing if previous has no sailings.
+ *
+ * @param models.CapacityRoute previous
+ * @param models.CapacityRoute current
+ * @param time.Time detectedAt
+ *
+ * @return []models.SailingUpdate
+ */
+func DiffCapacitySailings(previous models.CapacityRoute, current models.CapacityRoute, detectedAt time.Time) []models.SailingUpdate {
+	if len(previous.Sailings) == 0 {
+		return nil
+	}
+
+	loc := sailingtime.Location()
+
+	byKey := make(map[string]sailing, len(previous.Sailings))
+	for _, s := range capacitySailings(previous, loc) {
+		byKey[s.date+" "+s.departureTime] = s
+	}
+
+	var updates []models.SailingUpdate
+	add := func(updateType string, s sailing, old *models.CapacitySailing) {
+		updates = append(updates, models.SailingUpdate{
+			Type:        updateType,
+			RouteCode:   current.RouteCode,
+			SailingDate: s.date,
+			Sailing:     s.capacity,
+			Previous:    old,
+			DetectedAt:  detectedAt,
+		})
+	}
+
+	for _, s := range capacitySailings(current, loc) {
+		old, ok := byKey[s.date+" "+s.departureTime]
+		if !ok {
+			add(models.SailingUpdated, s, nil)
+			continue
+		}
+		if old.capacity == s.capacity {
+			continue
+		}
+
+		before := old.capacity
+		switch status := s.capacity.SailingStatus; {
+		case status == before.SailingStatus:
+			add(models.SailingUpdated, s, &before)
+		case status == "cancelled":
+			add(models.SailingCancelled, s, &before)
+		case status == "current":
+			add(models.SailingDeparted, s, &before)
+		case status == "past":
+			if before.SailingStatus != "current" {
+				add(models.SailingDeparted, s, &before)
+			}
+			add(models.SailingArrived, s, &before)
+		default:
+			add(models.SailingUpdated, s, &before)
+		}
+	}
+
+	return updates
+}
+
+func diff(routeCode string, previous []sailing, current []sailing, detectedAt time.Time, fullSchedule bool) []models.ServiceChange {
+	byKey := make(map[string]sailing, len(previous))
+	var lastPrevious time.Time
+	for _, s := range previous {
+		byKey[s.date+" "+s.departureTime] = s
+		if s.departure.After(lastPrevious) {
+			lastPrevious = s.departure
+		}
+	}
+
+	var changes []models.ServiceChange
+	add := func(s sailing, kind string, before string, after string, summary string) {
+		changes = append(changes, models.ServiceChange{
+			RouteCode:     routeCode,
+			Kind:          kind,
+			SailingDate:   s.date,
+			DepartureTime: s.departureTime,
+			Previous:      before,
+			Current:       after,
+			Summary:       fmt.Sprintf("%s %s sailing on %s %s", routeCode, s.departureTime, s.date, summary),
+			DetectedAt:    detectedAt,
+		})
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, s := range current {
+		key := s.date + " " + s.departureTime
+		seen[key] = true
+
+		old, ok := byKey[key]
+		if !ok {
+			switch {
+			case s.cancelled:
+				add(s, models.ChangeCancelled, "", s.status, "cancelled"+reason(s.status))
+			case !s.departed && (fullSchedule || s.departure.Before(lastPrevious)):
+				add(s, models.ChangeAdded, "", s.vesselName, "added")
+			}
+			continue
+		}
+
+		switch {
+		case s.cancelled && !old.cancelled:
+			add(s, models.ChangeCancelled, old.status, s.status, "cancelled"+reason(s.status))
+		case old.vesselName != "" && s.vesselName != "" && old.vesselName != s.vesselName:
+			add(s, models.ChangeVesselChanged, old.vesselName, s.vesselName, fmt.Sprintf("now %s instead of %s", s.vesselName, old.vesselName))
+		case s.status != old.status && s.status != "":
+			add(s, models.ChangeStatusChanged, old.status, s.status, "status: "+s.status)
+		}
+	}
+
+	for _, s := range previous {
+		if seen[s.date+" "+s.departureTime] || s.departed || s.cancelled {
+			continue
+		}
+		if fullSchedule || s.departure.After(detectedAt) {
+			add(s, models.ChangeRemoved, s.vesselName, "", "removed")
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].SailingDate != changes[j].SailingDate {
+			return changes[i].SailingDate < changes[j].SailingDate
+		}
+		return sortMinutes(changes[i].DepartureTime) < sortMinutes(changes[j].DepartureTime)
+	})
+
+	return changes
+}
+
+func capacitySailings(route models.CapacityRoute, loc *time.Location) []sailing {
+	day := scrapeDay(route.LastUpdated, loc)
+
+	var sailings []sailing
+	for _, s := range route.Sailings {
+		departureTime := s.ScheduledDepartureTime
+		if departureTime == "" {
+			departureTime = s.DepartureTime
+		}
+
+		date := day
+		if s.IsTomorrow {
+			date = day.AddDate(0, 0, 1)
+		}
+
+		departure, err := time.ParseInLocation("2006-01-02 3:04 pm", date.Format("2006-01-02")+" "+departureTime, loc)
+		if err != nil {
+			continue
+		}
+
+		sailings = append(sailings, sailing{
+			date:          date.Format("2006-01-02"),
+			departureTime: departureTime,
+			departure:     departure,
+			cancelled:     s.SailingStatus == "cancelled",
+			departed:      s.SailingStatus == "past" || s.SailingStatus == "current",
+			vesselName:    s.VesselName,
+			status:        s.VesselStatus,
+			fill:          s.Fill,
+			capacity:      s,
+		})
+	}
+
+	return sailings
+}
+
+func nonCapacitySailings(route models.NonCapacityRoute, loc *time.Location) []sailing {
+	date := scrapeDay(route.LastUpdated, loc).Format("2006-01-02")
+
+	var sailings []sailing
+	for _, s := range route.Sailings {
+		departure, err := time.ParseInLocation("2006-01-02 3:04 pm", date+" "+s.DepartureTime, loc)
+		if err != nil {
+			continue
+		}
+
+		sailings = append(sailings, sailing{
+			date:          date,
+			departureTime: s.DepartureTime,
+			departure:     departure,
+			cancelled:     strings.Contains(strings.ToLower(s.VesselStatus), "cancel"),
+			vesselName:    s.VesselName,
+			status:        s.VesselStatus,
+		})
+	}
+
+	return sailings
+}
+
+// scrapeDay returns the day a route was scraped in loc, or today if unknown
+func scrapeDay(lastUpdated *time.Time, loc *time.Location) time.Time {
+	scrapedAt := time.Now()
+	if lastUpdated != nil {
+		scrapedAt = *lastUpdated
+	}
+	return scrapedAt.In(loc)
+}
+
+func reason(status string) string {
+	if status == "" {
+		return ""
+	}
+	return ": " + status
+}
+
+// sortMinutes returns a "7:00 am" time of day as minutes past midnight, or 0 if it isn't one
+func sortMinutes(departureTime string) int {
+	minutes, _ := sailingtime.ClockMinutes(departureTime)
+	return minutes
+}
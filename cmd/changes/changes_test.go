@@ -0,0 +1,164 @@
+package changes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+func TestDiffCapacityRoute(t *testing.T) {
+	loc := sailingtime.Location()
+	before := time.Date(2024, 6, 1, 23, 55, 0, 0, loc)
+	after := time.Date(2024, 6, 2, 0, 5, 0, 0, loc)
+
+	previous := models.CapacityRoute{
+		RouteCode:   "TSASWB",
+		LastUpdated: &before,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "9:00 pm", ScheduledDepartureTime: "9:00 pm", SailingStatus: "past"},
+			{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "future", IsTomorrow: true, VesselName: "Spirit of British Columbia"},
+			{DepartureTime: "9:00 am", ScheduledDepartureTime: "9:00 am", SailingStatus: "future", IsTomorrow: true, VesselName: "Coastal Renaissance"},
+			{DepartureTime: "11:00 am", ScheduledDepartureTime: "11:00 am", SailingStatus: "future", IsTomorrow: true},
+			{DepartureTime: "3:00 pm", ScheduledDepartureTime: "3:00 pm", SailingStatus: "future", IsTomorrow: true},
+		},
+	}
+
+	// After midnight yesterday's sailings are gone and tomorrow's are today's
+	current := models.CapacityRoute{
+		RouteCode:   "TSASWB",
+		LastUpdated: &after,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "future", VesselName: "Spirit of British Columbia"},
+			{DepartureTime: "9:00 am", ScheduledDepartureTime: "9:00 am", SailingStatus: "future", VesselName: "Queen of New Westminster"},
+			{DepartureTime: "1:00 pm", ScheduledDepartureTime: "1:00 pm", SailingStatus: "future"},
+			{DepartureTime: "3:00 pm", ScheduledDepartureTime: "3:00 pm", SailingStatus: "cancelled", VesselStatus: "Mechanical difficulties"},
+			{DepartureTime: "5:00 pm", ScheduledDepartureTime: "5:00 pm", SailingStatus: "future"},
+		},
+	}
+
+	got := DiffCapacityRoute(previous, current, after)
+
+	want := []struct{ kind, time string }{
+		{models.ChangeVesselChanged, "9:00 am"},
+		{models.ChangeRemoved, "11:00 am"},
+		{models.ChangeAdded, "1:00 pm"},
+		{models.ChangeCancelled, "3:00 pm"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || got[i].DepartureTime != w.time || got[i].SailingDate != "2024-06-02" {
+			t.Errorf("change %d = %+v, want %s at %s", i, got[i], w.kind, w.time)
+		}
+	}
+	if got[3].Summary != "TSASWB 3:00 pm sailing on 2024-06-02 cancelled: Mechanical difficulties" {
+		t.Errorf("summary = %q", got[3].Summary)
+	}
+
+	if changes := DiffCapacityRoute(models.CapacityRoute{}, current, after); len(changes) != 0 {
+		t.Errorf("first scrape reported changes: %+v", changes)
+	}
+}
+
+func TestDiffCapacityFill(t *testing.T) {
+	loc := sailingtime.Location()
+	before := time.Date(2024, 6, 1, 8, 0, 0, 0, loc)
+	after := before.Add(time.Minute)
+
+	previous := models.CapacityRoute{
+		RouteCode:   "TSASWB",
+		LastUpdated: &before,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "past", Fill: 80},
+			{DepartureTime: "9:00 am", ScheduledDepartureTime: "9:00 am", SailingStatus: "future", Fill: 85},
+			{DepartureTime: "11:00 am", ScheduledDepartureTime: "11:00 am", SailingStatus: "future", Fill: 40},
+			{DepartureTime: "1:00 pm", ScheduledDepartureTime: "1:00 pm", SailingStatus: "future", Fill: 10},
+		},
+	}
+	current := models.CapacityRoute{
+		RouteCode:   "TSASWB",
+		LastUpdated: &after,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "7:05 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "past", Fill: 100},
+			{DepartureTime: "9:00 am", ScheduledDepartureTime: "9:00 am", SailingStatus: "future", Fill: 92, VesselName: "Spirit of Vancouver Island"},
+			{DepartureTime: "11:00 am", ScheduledDepartureTime: "11:00 am", SailingStatus: "future", Fill: 40},
+			{DepartureTime: "1:00 pm", ScheduledDepartureTime: "1:00 pm", SailingStatus: "cancelled", Fill: 0},
+		},
+	}
+
+	got := DiffCapacityFill(previous, current, after)
+	want := []models.FillChange{
+		{RouteCode: "TSASWB", SailingDate: "2024-06-01", DepartureTime: "9:00 am", VesselName: "Spirit of Vancouver Island", PreviousFill: 85, CurrentFill: 92, DetectedAt: after},
+	}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("DiffCapacityFill = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffCapacitySailings(t *testing.T) {
+	loc := sailingtime.Location()
+	before := time.Date(2024, 6, 1, 9, 0, 0, 0, loc)
+	after := before.Add(time.Minute)
+
+	previous := models.CapacityRoute{
+		RouteCode:   "TSASWB",
+		LastUpdated: &before,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "current"},
+			{DepartureTime: "8:00 am", ScheduledDepartureTime: "8:00 am", SailingStatus: "future"},
+			{DepartureTime: "9:00 am", ScheduledDepartureTime: "9:00 am", SailingStatus: "future"},
+			{DepartureTime: "11:00 am", ScheduledDepartureTime: "11:00 am", SailingStatus: "future", Fill: 40},
+			{DepartureTime: "1:00 pm", ScheduledDepartureTime: "1:00 pm", SailingStatus: "future"},
+			{DepartureTime: "3:00 pm", ScheduledDepartureTime: "3:00 pm", SailingStatus: "future"},
+		},
+	}
+	current := models.CapacityRoute{
+		RouteCode:   "TSASWB",
+		LastUpdated: &after,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "past"},
+			{DepartureTime: "8:05 am", ScheduledDepartureTime: "8:00 am", ActualDepartureTime: "8:05 am", SailingStatus: "past"},
+			{DepartureTime: "9:01 am", ScheduledDepartureTime: "9:00 am", ActualDepartureTime: "9:01 am", SailingStatus: "current"},
+			{DepartureTime: "11:00 am", ScheduledDepartureTime: "11:00 am", SailingStatus: "future", Fill: 55},
+			{DepartureTime: "1:00 pm", ScheduledDepartureTime: "1:00 pm", SailingStatus: "cancelled"},
+			{DepartureTime: "3:00 pm", ScheduledDepartureTime: "3:00 pm", SailingStatus: "future"},
+			{DepartureTime: "5:00 pm", ScheduledDepartureTime: "5:00 pm", SailingStatus: "future"},
+		},
+	}
+
+	var got []string
+	for _, update := range DiffCapacitySailings(previous, current, after) {
+		got = append(got, update.Sailing.ScheduledDepartureTime+" "+update.Type)
+		if update.SailingDate != "2024-06-01" || !update.DetectedAt.Equal(after) {
+			t.Errorf("update = %+v", update)
+		}
+		if update.Sailing.ScheduledDepartureTime == "11:00 am" && (update.Previous == nil || update.Previous.Fill != 40 || update.Sailing.Fill != 55) {
+			t.Errorf("fill update = %+v", update)
+		}
+	}
+
+	want := []string{
+		"7:00 am " + models.SailingArrived,
+		"8:00 am " + models.SailingDeparted,
+		"8:00 am " + models.SailingArrived,
+		"9:00 am " + models.SailingDeparted,
+		"11:00 am " + models.SailingUpdated,
+		"1:00 pm " + models.SailingCancelled,
+		"5:00 pm " + models.SailingUpdated,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("DiffCapacitySailings = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("update %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if got := DiffCapacitySailings(models.CapacityRoute{}, current, after); len(got) != 0 {
+		t.Errorf("first scrape = %+v, want nothing", got)
+	}
+}
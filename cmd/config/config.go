@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type DBConfig struct {
+	Driver   string // "postgres" (default), "sqlite" or "memory"
+	Path     string // SQLite database file
 	User     string
 	Password string
 	Host     string
@@ -18,9 +22,44 @@ type DBConfig struct {
 	URL      string
 }
 
+type HistoryConfig struct {
+	FullResolution     time.Duration // Keep every observation this long
+	DownsampleInterval time.Duration // Then keep one observation per sailing per interval
+	Retention          time.Duration // Delete observations older than this
+}
+
+type ScraperConfig struct {
+	FixtureDir     string
+	Cassette       string
+	CassetteRecord bool // Fetch pages missing from the cassette live and save them to it
+	Concurrency    int
+	RateLimit      float64 // Requests per second to each upstream host
+	RateBurst      int
+	RequestTimeout time.Duration
+
+	MaxAttempts      int
+	RetryBaseDelay   time.Duration
+	BreakerThreshold int // Consecutive failed requests before bcferries.com is considered down
+	BreakerCooldown  time.Duration
+}
+
+type WebhookConfig struct {
+	MaxAttempts    int // Tries per delivery before it is dead lettered
+	RetryBaseDelay time.Duration
+	Timeout        time.Duration // Per attempt
+	QueueSize      int           // Undelivered events held per subscription before new ones are dead lettered
+}
+
 var (
-	DB         DBConfig
-	ServerPort string
+	DB                    DBConfig
+	Scraper               ScraperConfig
+	ScrapeRunRetention    time.Duration
+	History               HistoryConfig
+	Webhooks              WebhookConfig
+	ForecastLookback      time.Duration
+	CapacityStaleAfter    time.Duration
+	NonCapacityStaleAfter time.Duration
+	ServerPort            string
 )
 
 /*
@@ -28,9 +67,9 @@ var (
  *
  * Loads environment variables from a `.env` file using godotenv.
  *
- * Populates the DB configuration and server port. Constructs the database URL
+ * Populates the DB configuration, scraper sources and server port. Constructs the database URL
  * using the retrieved values. Logs a fatal error and exits if any required DB
- * variables are missing or if the `.env` file cannot be loaded.
+ * variables are missing when using Postgres, or if the `.env` file cannot be loaded.
  *
  * @return void
  */
@@ -41,6 +80,8 @@ func LoadEnv() {
 
 	// DB config
 	DB = DBConfig{
+		Driver:   getEnvString("DB_DRIVER", "postgres"),
+		Path:     getEnvString("DB_PATH", "bcferries.db"),
 		User:     os.Getenv("DB_USER"),
 		Password: os.Getenv("DB_PASS"),
 		Host:     os.Getenv("DB_HOST"),
@@ -49,12 +90,175 @@ func LoadEnv() {
 		SSL:      os.Getenv("DB_SSL"),
 	}
 
-	if DB.User == "" || DB.Password == "" || DB.Host == "" || DB.Port == "" || DB.Database == "" || DB.SSL == "" {
+	// Only Postgres needs connection details
+	if DB.Driver == "postgres" && (DB.User == "" || DB.Password == "" || DB.Host == "" || DB.Port == "" || DB.Database == "" || DB.SSL == "") {
 		log.Fatal("Missing required SQL environment variables")
 	}
 
 	DB.URL = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s", DB.User, DB.Password, DB.Host, DB.Port, DB.Database, DB.SSL)
 
+	// Scraper sources, both optional. When set, pages are read from disk instead of bcferries.com
+	Scraper = ScraperConfig{
+		FixtureDir: os.Getenv("SCRAPER_FIXTURE_DIR"),
+		Cassette:   os.Getenv("SCRAPER_CASSETTE"),
+
+		CassetteRecord: getEnvBool("SCRAPER_CASSETTE_RECORD", false),
+
+		Concurrency:    getEnvInt("SCRAPER_CONCURRENCY", 4),
+		RateLimit:      getEnvFloat("SCRAPER_RATE_LIMIT", 2),
+		RateBurst:      getEnvInt("SCRAPER_RATE_BURST", 4),
+		RequestTimeout: getEnvDuration("SCRAPER_REQUEST_TIMEOUT", 30*time.Second),
+
+		MaxAttempts:      getEnvInt("SCRAPER_MAX_ATTEMPTS", 3),
+		RetryBaseDelay:   getEnvDuration("SCRAPER_RETRY_BASE_DELAY", 1*time.Second),
+		BreakerThreshold: getEnvInt("SCRAPER_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:  getEnvDuration("SCRAPER_BREAKER_COOLDOWN", 2*time.Minute),
+	}
+
+	// How long scrape run history is kept
+	ScrapeRunRetention = getEnvDuration("SCRAPE_RUN_RETENTION", 7*24*time.Hour)
+
+	// Capacity history retention and downsampling
+	History = HistoryConfig{
+		FullResolution:     getEnvDuration("HISTORY_FULL_RESOLUTION", 48*time.Hour),
+		DownsampleInterval: getEnvDuration("HISTORY_DOWNSAMPLE_INTERVAL", 15*time.Minute),
+		Retention:          getEnvDuration("HISTORY_RETENTION", 365*24*time.Hour),
+	}
+
+	// Webhook delivery retries and queueing
+	Webhooks = WebhookConfig{
+		MaxAttempts:    getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		RetryBaseDelay: getEnvDuration("WEBHOOK_RETRY_BASE_DELAY", 2*time.Second),
+		Timeout:        getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		QueueSize:      getEnvInt("WEBHOOK_QUEUE_SIZE", 1000),
+	}
+
+	// How much capacity history fill forecasts are based on
+	ForecastLookback = getEnvDuration("FORECAST_LOOKBACK", 8*7*24*time.Hour)
+
+	// Age after which route data is flagged as stale in responses
+	CapacityStaleAfter = getEnvDuration("CAPACITY_STALE_AFTER", 5*time.Minute)
+	NonCapacityStaleAfter = getEnvDuration("NON_CAPACITY_STALE_AFTER", 9*time.Hour)
+
 	// Port
 	ServerPort = os.Getenv("PORT")
 }
+
+/*
+ * getEnvString
+ *
+ * Reads a string environment variable, falling back to def when unset.
+ *
+ * @param string name
+ * @param string def
+ *
+ * @return string
+ */
+func getEnvString(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+/*
+ * getEnvInt
+ *
+ * Reads an integer environment variable, falling back to def when unset or invalid.
+ *
+ * @param string name
+ * @param int def
+ *
+ * @return int
+ */
+func getEnvInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %d", name, value, def)
+		return def
+	}
+
+	return parsed
+}
+
+/*
+ * getEnvFloat
+ *
+ * Reads a decimal environment variable, falling back to def when unset or invalid.
+ *
+ * @param string name
+ * @param float64 def
+ *
+ * @return float64
+ */
+func getEnvFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %v", name, value, def)
+		return def
+	}
+
+	return parsed
+}
+
+/*
+ * getEnvBool
+ *
+ * Reads a boolean environment variable such as "true" or "1", falling back to
+ * def when unset or invalid.
+ *
+ * @param string name
+ * @param bool def
+ *
+ * @return bool
+ */
+func getEnvBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %v", name, value, def)
+		return def
+	}
+
+	return parsed
+}
+
+/*
+ * getEnvDuration
+ *
+ * Reads a duration environment variable such as "30s", falling back to def
+ * when unset or invalid.
+ *
+ * @param string name
+ * @param time.Duration def
+ *
+ * @return time.Duration
+ */
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", name, value, def)
+		return def
+	}
+
+	return parsed
+}
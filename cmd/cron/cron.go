@@ -1,9 +1,14 @@
 package cron
 
 import (
+	"errors"
+	"log"
 	"time"
 
 	"github.com/go-co-op/gocron"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/config"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
 	"github.com/samuel-pratt/bc-ferries-api/cmd/scraper"
 )
 
@@ -14,8 +19,11 @@ import (
  *
  * - Scrapes capacity route data every 1 minute.
  * - Scrapes non-capacity route data every 4 hours.
+ * - Prunes scrape run history once a day.
+ * - Downsamples and prunes capacity history every hour.
  *
- * The scheduler runs asynchronously in the background.
+ * The scheduler runs asynchronously in the background. A tick that arrives while
+ * the previous run of the same job is still going is skipped by the scraper.
  *
  * @return void
  */
@@ -23,12 +31,174 @@ func SetupCron() {
 	s := gocron.NewScheduler(time.UTC)
 
 	s.Every(1).Minute().Do(func() {
-		scraper.ScrapeCapacityRoutes()
+		recordRun(models.CapacityJob, scraper.ScrapeCapacityRoutes)
 	})
 
 	s.Every(4).Hour().Do(func() {
-		scraper.ScrapeNonCapacityRoutes()
+		recordRun(models.NonCapacityJob, scraper.ScrapeNonCapacityRoutes)
+	})
+
+	s.Every(1).Day().Do(func() {
+		pruneRuns()
+	})
+
+	s.Every(1).Hour().Do(func() {
+		applyHistoryPolicies()
 	})
 
 	s.StartAsync()
 }
+
+/*
+ * recordRun
+ *
+ * Runs a scrape job and stores its start/end time and per-route outcomes in
+ * the scrape run history. Runs skipped because the previous one is still going
+ * are logged but not recorded.
+ *
+ * @param string job - models.CapacityJob or models.NonCapacityJob
+ * @param func() ([]models.RouteScrapeResult, error) scrape
+ *
+ * @return void
+ */
+func recordRun(job string, scrape func() ([]models.RouteScrapeResult, error)) {
+	run := models.ScrapeRun{
+		Job:       job,
+		StartedAt: time.Now(),
+	}
+
+	results, err := scrape()
+	if errors.Is(err, scraper.ErrScrapeInProgress) {
+		log.Printf("recordRun: %s scrape still in progress, skipping", job)
+		return
+	}
+
+	run.FinishedAt = time.Now()
+	run.Routes = results
+	run.Status = runStatus(results, err)
+
+	if err := db.SaveScrapeRun(&run); err != nil {
+		log.Printf("recordRun: failed to save %s run: %v", job, err)
+	}
+}
+
+/*
+ * runStatus
+ *
+ * Summarises route outcomes: succeeded when every route was scraped, failed when
+ * none were, and partial otherwise.
+ *
+ * @param []models.RouteScrapeResult results
+ * @param error err
+ *
+ * @return string
+ */
+func runStatus(results []models.RouteScrapeResult, err error) string {
+	if err != nil || len(results) == 0 {
+		return models.RunFailed
+	}
+
+	ok := 0
+	for _, result := range results {
+		if result.Outcome == models.OutcomeOK {
+			ok++
+		}
+	}
+
+	switch ok {
+	case len(results):
+		return models.RunSucceeded
+	case 0:
+		return models.RunFailed
+	default:
+		return models.RunPartial
+	}
+}
+
+/*
+ * pruneRuns
+ *
+ * Deletes scrape run history older than the configured retention.
+ *
+ * @return void
+ */
+func pruneRuns() {
+	retention := config.ScrapeRunRetention
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+
+	deleted, err := db.PruneScrapeRuns(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("pruneRuns: failed to prune scrape runs: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("pruneRuns: deleted %d scrape runs older than %s", deleted, retention)
+	}
+}
+
+/*
+ * applyHistoryPolicies
+ *
+ * Downsamples capacity history older than the full resolution window and
+ * deletes history older than the retention period.
+ *
+ * @return void
+ */
+func applyHistoryPolicies() {
+	policy := config.History
+	if policy.FullResolution <= 0 {
+		policy.FullResolution = 48 * time.Hour
+	}
+	if policy.DownsampleInterval <= 0 {
+		policy.DownsampleInterval = 15 * time.Minute
+	}
+	if policy.Retention <= 0 {
+		policy.Retention = 365 * 24 * time.Hour
+	}
+
+	now := time.Now()
+
+	downsampled, err := db.DownsampleCapacityObservations(now.Add(-policy.FullResolution), policy.DownsampleInterval)
+	if err != nil {
+		log.Printf("applyHistoryPolicies: failed to downsample capacity history: %v", err)
+	} else if downsampled > 0 {
+		log.Printf("applyHistoryPolicies: downsampled %d capacity observations", downsampled)
+	}
+
+	pruned, err := db.PruneCapacityObservations(now.Add(-policy.Retention))
+	if err != nil {
+		log.Printf("applyHistoryPolicies: failed to prune capacity history: %v", err)
+	} else if pruned > 0 {
+		log.Printf("applyHistoryPolicies: deleted %d capacity observations older than %s", pruned, policy.Retention)
+	}
+
+	pruned, err = db.PruneDepartureRecords(now.Add(-policy.Retention))
+	if err != nil {
+		log.Printf("applyHistoryPolicies: failed to prune departure records: %v", err)
+	} else if pruned > 0 {
+		log.Printf("applyHistoryPolicies: deleted %d departure records older than %s", pruned, policy.Retention)
+	}
+
+	pruned, err = db.PruneCancellationEvents(now.Add(-policy.Retention))
+	if err != nil {
+		log.Printf("applyHistoryPolicies: failed to prune cancellations: %v", err)
+	} else if pruned > 0 {
+		log.Printf("applyHistoryPolicies: deleted %d cancellations older than %s", pruned, policy.Retention)
+	}
+
+	pruned, err = db.PruneServiceChanges(now.Add(-policy.Retention))
+	if err != nil {
+		log.Printf("applyHistoryPolicies: failed to prune service changes: %v", err)
+	} else if pruned > 0 {
+		log.Printf("applyHistoryPolicies: deleted %d service changes older than %s", pruned, policy.Retention)
+	}
+
+	pruned, err = db.PruneDeadLetters(now.Add(-policy.Retention))
+	if err != nil {
+		log.Printf("applyHistoryPolicies: failed to prune webhook dead letters: %v", err)
+	} else if pruned > 0 {
+		log.Printf("applyHistoryPolicies: deleted %d webhook dead letters older than %s", pruned, policy.Retention)
+	}
+}
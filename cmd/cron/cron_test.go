@@ -0,0 +1,33 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestRunStatus(t *testing.T) {
+	ok := models.RouteScrapeResult{Outcome: models.OutcomeOK}
+	failed := models.RouteScrapeResult{Outcome: models.OutcomeFetchFailed}
+	skipped := models.RouteScrapeResult{Outcome: models.OutcomeSkipped}
+
+	tests := []struct {
+		name    string
+		results []models.RouteScrapeResult
+		err     error
+		want    string
+	}{
+		{"all ok", []models.RouteScrapeResult{ok, ok}, nil, models.RunSucceeded},
+		{"some failed", []models.RouteScrapeResult{ok, failed}, nil, models.RunPartial},
+		{"none ok", []models.RouteScrapeResult{failed, skipped}, nil, models.RunFailed},
+		{"no routes", nil, nil, models.RunFailed},
+		{"error", []models.RouteScrapeResult{ok}, errors.New("boom"), models.RunFailed},
+	}
+
+	for _, tt := range tests {
+		if got := runStatus(tt.results, tt.err); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
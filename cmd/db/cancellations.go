@@ -0,0 +1,124 @@
+package db
+
+import (
+	"log"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+/*
+ * SaveCancellationEvents
+ *
+ * Inserts new cancellations and updates ones seen before in a single
+ * transaction. A cancellation keeps the time it was first seen; its vessel and
+ * reason are replaced by the latest non-empty values.
+ *
+ * @param []models.CancellationEvent events - LastSeenAt is used as the time seen
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveCancellationEvents(events []models.CancellationEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO cancellation_events (
+			route_code,
+			sailing_date,
+			scheduled_departure_time,
+			vessel_name,
+			reason,
+			first_seen_at,
+			last_seen_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (route_code, sailing_date, scheduled_departure_time) DO UPDATE SET
+			vessel_name = CASE WHEN EXCLUDED.vessel_name = '' THEN cancellation_events.vessel_name ELSE EXCLUDED.vessel_name END,
+			reason = CASE WHEN EXCLUDED.reason = '' THEN cancellation_events.reason ELSE EXCLUDED.reason END,
+			last_seen_at = EXCLUDED.last_seen_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		_, err := stmt.Exec(e.RouteCode, e.SailingDate, e.ScheduledDepartureTime, e.VesselName, e.Reason, dbTime(e.LastSeenAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * GetCancellations
+ *
+ * @param string from - first sailing date, YYYY-MM-DD
+ * @param string to - last sailing date, YYYY-MM-DD
+ * @param string routeCode - limits results to one route, or "" for all
+ *
+ * @return []models.CancellationEvent - most recently first seen first
+ */
+func (s *SQLStore) GetCancellations(from string, to string, routeCode string) []models.CancellationEvent {
+	events := []models.CancellationEvent{}
+
+	sqlStatement := `
+		SELECT route_code, ` + s.dialect.sailingDate + `, scheduled_departure_time, vessel_name, reason, first_seen_at, last_seen_at
+		FROM cancellation_events
+		WHERE sailing_date >= $1 AND sailing_date <= $2 AND ($3 = '' OR route_code = $3)
+		ORDER BY first_seen_at DESC, route_code`
+
+	rows, err := s.db.Query(sqlStatement, from, to, routeCode)
+	if err != nil {
+		log.Printf("GetCancellations: query failed: %v", err)
+		return events
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.CancellationEvent
+		var firstSeenAt, lastSeenAt nullTime
+
+		err := rows.Scan(&e.RouteCode, &e.SailingDate, &e.ScheduledDepartureTime, &e.VesselName, &e.Reason, &firstSeenAt, &lastSeenAt)
+		if err != nil {
+			log.Printf("GetCancellations: row scan failed: %v", err)
+			continue
+		}
+		e.FirstSeenAt, e.LastSeenAt = firstSeenAt.Time, lastSeenAt.Time
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetCancellations: row iteration error: %v", err)
+	}
+
+	return events
+}
+
+/*
+ * PruneCancellationEvents
+ *
+ * Deletes cancellations last seen before cutoff.
+ *
+ * @param time.Time cutoff
+ *
+ * @return int64 - number of cancellations deleted
+ * @return error
+ */
+func (s *SQLStore) PruneCancellationEvents(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM cancellation_events WHERE last_seen_at < $1`, dbTime(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
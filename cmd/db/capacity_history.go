@@ -0,0 +1,206 @@
+package db
+
+import (
+	"log"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+/*
+ * SaveCapacityObservations
+ *
+ * Appends fill observations to the `capacity_observations` time series in a
+ * single transaction. Repeating an observation with the same timestamp is a no-op.
+ *
+ * @param []models.CapacityObservation observations
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveCapacityObservations(observations []models.CapacityObservation) error {
+	if len(observations) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO capacity_observations (
+			route_code,
+			sailing_date,
+			departure_time,
+			observed_at,
+			sailing_status,
+			fill,
+			car_fill,
+			oversize_fill,
+			vessel_name
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (route_code, sailing_date, departure_time, observed_at) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, o := range observations {
+		_, err := stmt.Exec(o.RouteCode, o.SailingDate, o.DepartureTime, dbTime(o.ObservedAt), o.SailingStatus, o.Fill, o.CarFill, o.OversizeFill, o.VesselName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * GetSailingHistory
+ *
+ * Retrieves every stored observation of one scheduled departure, oldest first.
+ *
+ * @param string routeCode - e.g. "TSASWB"
+ * @param string sailingDate - YYYY-MM-DD in America/Vancouver
+ * @param string departureTime - as scraped, e.g. "7:00 am"
+ *
+ * @return models.SailingHistory - with no observations if none were found
+ */
+func (s *SQLStore) GetSailingHistory(routeCode string, sailingDate string, departureTime string) models.SailingHistory {
+	history := models.SailingHistory{
+		RouteCode:     routeCode,
+		SailingDate:   sailingDate,
+		DepartureTime: departureTime,
+		Observations:  []models.FillSnapshot{},
+	}
+
+	sqlStatement := `
+		SELECT observed_at, fill, car_fill, oversize_fill, vessel_name
+		FROM capacity_observations
+		WHERE route_code = $1 AND sailing_date = $2 AND departure_time = $3
+		ORDER BY observed_at`
+
+	rows, err := s.db.Query(sqlStatement, routeCode, sailingDate, departureTime)
+	if err != nil {
+		log.Printf("GetSailingHistory: query failed: %v", err)
+		return history
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var snapshot models.FillSnapshot
+		if err := rows.Scan(&snapshot.ObservedAt, &snapshot.Fill, &snapshot.CarFill, &snapshot.OversizeFill, &snapshot.VesselName); err != nil {
+			log.Printf("GetSailingHistory: row scan failed: %v", err)
+			continue
+		}
+		history.Observations = append(history.Observations, snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetSailingHistory: row iteration error: %v", err)
+	}
+
+	return history
+}
+
+/*
+ * GetCapacityObservationsSince
+ *
+ * Retrieves a route's observations made at or after since, for forecasting.
+ *
+ * @param string routeCode
+ * @param time.Time since
+ *
+ * @return []models.CapacityObservation
+ */
+func (s *SQLStore) GetCapacityObservationsSince(routeCode string, since time.Time) []models.CapacityObservation {
+	var observations []models.CapacityObservation
+
+	sqlStatement := `
+		SELECT ` + s.dialect.sailingDate + `, departure_time, observed_at, sailing_status, fill, car_fill, oversize_fill, vessel_name
+		FROM capacity_observations
+		WHERE route_code = $1 AND observed_at >= $2
+		ORDER BY observed_at`
+
+	rows, err := s.db.Query(sqlStatement, routeCode, dbTime(since))
+	if err != nil {
+		log.Printf("GetCapacityObservationsSince: query failed: %v", err)
+		return observations
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		o := models.CapacityObservation{RouteCode: routeCode}
+		if err := rows.Scan(&o.SailingDate, &o.DepartureTime, &o.ObservedAt, &o.SailingStatus, &o.Fill, &o.CarFill, &o.OversizeFill, &o.VesselName); err != nil {
+			log.Printf("GetCapacityObservationsSince: row scan failed: %v", err)
+			continue
+		}
+		observations = append(observations, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetCapacityObservationsSince: row iteration error: %v", err)
+	}
+
+	return observations
+}
+
+/*
+ * DownsampleCapacityObservations
+ *
+ * Thins out observations made before cutoff so that at most one remains per
+ * sailing in each interval-sized bucket. The latest observation in a bucket is
+ * kept, so the final fill level before departure is never lost.
+ *
+ * @param time.Time cutoff
+ * @param time.Duration interval
+ *
+ * @return int64 - number of observations deleted
+ * @return error
+ */
+func (s *SQLStore) DownsampleCapacityObservations(cutoff time.Time, interval time.Duration) (int64, error) {
+	seconds := int64(interval / time.Second)
+	if seconds <= 0 {
+		return 0, nil
+	}
+
+	sqlStatement := `
+		DELETE FROM capacity_observations AS o
+		WHERE o.observed_at < $1
+		AND EXISTS (
+			SELECT 1
+			FROM capacity_observations n
+			WHERE n.route_code = o.route_code
+			AND n.sailing_date = o.sailing_date
+			AND n.departure_time = o.departure_time
+			AND n.observed_at > o.observed_at
+			AND n.observed_at < $1
+			AND ` + s.dialect.timeBucket("n.observed_at", "$2") + ` = ` + s.dialect.timeBucket("o.observed_at", "$2") + `
+		)`
+
+	result, err := s.db.Exec(sqlStatement, dbTime(cutoff), seconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+/*
+ * PruneCapacityObservations
+ *
+ * Deletes observations made before cutoff.
+ *
+ * @param time.Time cutoff
+ *
+ * @return int64 - number of observations deleted
+ * @return error
+ */
+func (s *SQLStore) PruneCapacityObservations(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM capacity_observations WHERE observed_at < $1`, dbTime(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
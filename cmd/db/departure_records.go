@@ -0,0 +1,128 @@
+package db
+
+import (
+	"log"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+/*
+ * SaveDepartureRecords
+ *
+ * Inserts or updates departure records in a single transaction. A sailing is
+ * keyed by route, date and scheduled departure, so later scrapes replace what
+ * earlier ones saw, e.g. filling in the arrival time.
+ *
+ * @param []models.DepartureRecord records
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveDepartureRecords(records []models.DepartureRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO departure_records (
+			route_code,
+			sailing_date,
+			scheduled_departure_time,
+			outcome,
+			actual_departure_time,
+			delay_minutes,
+			arrival_time,
+			vessel_name,
+			recorded_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (route_code, sailing_date, scheduled_departure_time) DO UPDATE SET
+			outcome = EXCLUDED.outcome,
+			actual_departure_time = EXCLUDED.actual_departure_time,
+			delay_minutes = EXCLUDED.delay_minutes,
+			arrival_time = EXCLUDED.arrival_time,
+			vessel_name = EXCLUDED.vessel_name,
+			recorded_at = EXCLUDED.recorded_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		_, err := stmt.Exec(r.RouteCode, r.SailingDate, r.ScheduledDepartureTime, r.Outcome, r.ActualDepartureTime, r.DelayMinutes, r.ArrivalTime, r.VesselName, dbTime(r.RecordedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * GetDepartureRecords
+ *
+ * @param string from - first sailing date, YYYY-MM-DD
+ * @param string to - last sailing date, YYYY-MM-DD
+ *
+ * @return []models.DepartureRecord - ordered by route and sailing date
+ */
+func (s *SQLStore) GetDepartureRecords(from string, to string) []models.DepartureRecord {
+	records := []models.DepartureRecord{}
+
+	sqlStatement := `
+		SELECT route_code, ` + s.dialect.sailingDate + `, scheduled_departure_time, outcome, actual_departure_time, delay_minutes, arrival_time, vessel_name, recorded_at
+		FROM departure_records
+		WHERE sailing_date >= $1 AND sailing_date <= $2
+		ORDER BY route_code, sailing_date, scheduled_departure_time`
+
+	rows, err := s.db.Query(sqlStatement, from, to)
+	if err != nil {
+		log.Printf("GetDepartureRecords: query failed: %v", err)
+		return records
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.DepartureRecord
+		var recordedAt nullTime
+
+		err := rows.Scan(&r.RouteCode, &r.SailingDate, &r.ScheduledDepartureTime, &r.Outcome, &r.ActualDepartureTime, &r.DelayMinutes, &r.ArrivalTime, &r.VesselName, &recordedAt)
+		if err != nil {
+			log.Printf("GetDepartureRecords: row scan failed: %v", err)
+			continue
+		}
+		r.RecordedAt = recordedAt.Time
+
+		records = append(records, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetDepartureRecords: row iteration error: %v", err)
+	}
+
+	return records
+}
+
+/*
+ * PruneDepartureRecords
+ *
+ * Deletes departure records last seen before cutoff.
+ *
+ * @param time.Time cutoff
+ *
+ * @return int64 - number of records deleted
+ * @return error
+ */
+func (s *SQLStore) PruneDepartureRecords(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM departure_records WHERE recorded_at < $1`, dbTime(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,725 @@
+package db
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+// MemoryStore is a Store that keeps everything in memory, for tests and for
+// running the API without a database. Its contents are lost on exit.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	capacityRoutes    map[string]models.CapacityRoute
+	nonCapacityRoutes map[string]models.NonCapacityRoute
+
+	runs      []models.ScrapeRun
+	nextRunID int64
+
+	observations map[observationKey]models.CapacityObservation
+
+	departures    map[departureKey]models.DepartureRecord
+	cancellations map[departureKey]models.CancellationEvent
+
+	changes      []models.ServiceChange
+	nextChangeID int64
+
+	subscriptions      []models.Subscription
+	nextSubscriptionID int64
+	deadLetters        []models.DeadLetter
+	nextDeadLetterID   int64
+}
+
+type departureKey struct {
+	routeCode              string
+	sailingDate            string
+	scheduledDepartureTime string
+}
+
+type observationKey struct {
+	routeCode     string
+	sailingDate   string
+	departureTime string
+	observedAt    int64
+}
+
+/*
+ * NewMemoryStore
+ *
+ * @return *MemoryStore - an empty store
+ */
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		capacityRoutes:     make(map[string]models.CapacityRoute),
+		nonCapacityRoutes:  make(map[string]models.NonCapacityRoute),
+		nextRunID:          1,
+		observations:       make(map[observationKey]models.CapacityObservation),
+		departures:         make(map[departureKey]models.DepartureRecord),
+		cancellations:      make(map[departureKey]models.CancellationEvent),
+		nextChangeID:       1,
+		nextSubscriptionID: 1,
+		nextDeadLetterID:   1,
+	}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+/**********/
+/* Routes */
+/**********/
+
+func (m *MemoryStore) GetCapacitySailings() []models.CapacityRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var routes []models.CapacityRoute
+	for _, route := range m.capacityRoutes {
+		route.Sailings = append([]models.CapacitySailing{}, route.Sailings...)
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].RouteCode < routes[j].RouteCode })
+
+	return routes
+}
+
+func (m *MemoryStore) GetNonCapacitySailings() []models.NonCapacityRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var routes []models.NonCapacityRoute
+	for _, route := range m.nonCapacityRoutes {
+		route.Sailings = append([]models.NonCapacitySailing{}, route.Sailings...)
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].RouteCode < routes[j].RouteCode })
+
+	return routes
+}
+
+func (m *MemoryStore) GetCapacityRoute(routeCode string) (models.CapacityRoute, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	route, ok := m.capacityRoutes[routeCode]
+	route.Sailings = append([]models.CapacitySailing{}, route.Sailings...)
+	return route, ok
+}
+
+func (m *MemoryStore) GetNonCapacityRoute(routeCode string) (models.NonCapacityRoute, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	route, ok := m.nonCapacityRoutes[routeCode]
+	route.Sailings = append([]models.NonCapacitySailing{}, route.Sailings...)
+	return route, ok
+}
+
+func (m *MemoryStore) FilterCapacitySailings(routeCode string, filter models.SailingFilter) []models.CapacityRoute {
+	routes := []models.CapacityRoute{}
+	for _, route := range m.GetCapacitySailings() {
+		if routeCode != "" && route.RouteCode != routeCode {
+			continue
+		}
+		sailings := []models.CapacitySailing{}
+		for _, sailing := range route.Sailings {
+			if filter.Limit > 0 && len(sailings) == filter.Limit {
+				break
+			}
+			if matchesCapacity(filter, sailing) {
+				sailings = append(sailings, sailing)
+			}
+		}
+		route.Sailings = sailings
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+func (m *MemoryStore) FilterNonCapacitySailings(routeCode string, filter models.SailingFilter) []models.NonCapacityRoute {
+	routes := []models.NonCapacityRoute{}
+	for _, route := range m.GetNonCapacitySailings() {
+		if routeCode != "" && route.RouteCode != routeCode {
+			continue
+		}
+		sailings := []models.NonCapacitySailing{}
+		for _, sailing := range route.Sailings {
+			if filter.Limit > 0 && len(sailings) == filter.Limit {
+				break
+			}
+			if matchesSailing(filter, sailing.DepartureTime, false, sailing.VesselName) {
+				sailings = append(sailings, sailing)
+			}
+		}
+		route.Sailings = sailings
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// matchesCapacity applies a filter the way sailingConditions does in SQL
+func matchesCapacity(filter models.SailingFilter, sailing models.CapacitySailing) bool {
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, sailing.SailingStatus) {
+		return false
+	}
+	if filter.MinAvailable > 0 && (sailing.SailingStatus != "future" || 100-sailing.Fill < filter.MinAvailable) {
+		return false
+	}
+	scheduledTime := sailing.ScheduledDepartureTime
+	if scheduledTime == "" {
+		scheduledTime = sailing.DepartureTime
+	}
+	return matchesSailing(filter, scheduledTime, sailing.IsTomorrow, sailing.VesselName)
+}
+
+func matchesSailing(filter models.SailingFilter, scheduledTime string, isTomorrow bool, vesselName string) bool {
+	if filter.Vessel != "" && !strings.EqualFold(filter.Vessel, vesselName) {
+		return false
+	}
+	if filter.After < 0 && filter.Before < 0 {
+		return true
+	}
+	if isTomorrow {
+		return filter.Before < 0
+	}
+
+	minutes := departureMinutes(scheduledTime)
+	if !minutes.Valid {
+		return false
+	}
+	return (filter.After < 0 || minutes.Int64 >= int64(filter.After)) && (filter.Before < 0 || minutes.Int64 <= int64(filter.Before))
+}
+
+func (m *MemoryStore) SaveCapacityRoute(route models.CapacityRoute) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lastUpdated := scrapedAt(route.LastUpdated)
+	route.LastUpdated = &lastUpdated
+	route.IsStale = false
+	route.Sailings = append([]models.CapacitySailing{}, route.Sailings...)
+
+	m.capacityRoutes[route.RouteCode] = route
+	return nil
+}
+
+func (m *MemoryStore) SaveNonCapacityRoute(route models.NonCapacityRoute) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lastUpdated := scrapedAt(route.LastUpdated)
+	route.LastUpdated = &lastUpdated
+	route.IsStale = false
+	route.Sailings = append([]models.NonCapacitySailing{}, route.Sailings...)
+
+	m.nonCapacityRoutes[route.RouteCode] = route
+	return nil
+}
+
+/***************/
+/* Scrape Runs */
+/***************/
+
+func (m *MemoryStore) SaveScrapeRun(run *models.ScrapeRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run.ID = m.nextRunID
+	m.nextRunID++
+
+	saved := *run
+	saved.Routes = append([]models.RouteScrapeResult{}, run.Routes...)
+	sort.Slice(saved.Routes, func(i, j int) bool { return saved.Routes[i].RouteCode < saved.Routes[j].RouteCode })
+	m.runs = append(m.runs, saved)
+
+	return nil
+}
+
+func (m *MemoryStore) GetLatestScrapeRuns() map[string]models.ScrapeRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := make(map[string]models.ScrapeRun)
+	for _, run := range m.runs {
+		if latest, ok := runs[run.Job]; !ok || run.StartedAt.After(latest.StartedAt) {
+			run.Routes = append([]models.RouteScrapeResult{}, run.Routes...)
+			runs[run.Job] = run
+		}
+	}
+
+	return runs
+}
+
+func (m *MemoryStore) GetRouteScrapeStatuses() []models.RouteScrapeStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type jobRoute struct{ job, routeCode string }
+	byRoute := make(map[jobRoute]*models.RouteScrapeStatus)
+
+	for _, run := range m.runs {
+		for _, result := range run.Routes {
+			key := jobRoute{run.Job, result.RouteCode}
+
+			status, ok := byRoute[key]
+			if !ok {
+				status = &models.RouteScrapeStatus{Job: run.Job, LastAttempt: result}
+				byRoute[key] = status
+			} else if result.ScrapedAt.After(status.LastAttempt.ScrapedAt) {
+				status.LastAttempt = result
+			}
+
+			if result.Outcome == models.OutcomeOK && (status.LastSuccessAt == nil || result.ScrapedAt.After(*status.LastSuccessAt)) {
+				scrapedAt := result.ScrapedAt
+				status.LastSuccessAt = &scrapedAt
+			}
+		}
+	}
+
+	var statuses []models.RouteScrapeStatus
+	for _, status := range byRoute {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Job != statuses[j].Job {
+			return statuses[i].Job < statuses[j].Job
+		}
+		return statuses[i].LastAttempt.RouteCode < statuses[j].LastAttempt.RouteCode
+	})
+
+	return statuses
+}
+
+func (m *MemoryStore) PruneScrapeRuns(cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.runs[:0]
+	for _, run := range m.runs {
+		if !run.StartedAt.Before(cutoff) {
+			kept = append(kept, run)
+		}
+	}
+
+	deleted := int64(len(m.runs) - len(kept))
+	m.runs = kept
+	return deleted, nil
+}
+
+/********************/
+/* Capacity History */
+/********************/
+
+func (m *MemoryStore) SaveCapacityObservations(observations []models.CapacityObservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, o := range observations {
+		key := observationKey{o.RouteCode, o.SailingDate, o.DepartureTime, o.ObservedAt.UnixNano()}
+		if _, ok := m.observations[key]; !ok {
+			m.observations[key] = o
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) GetSailingHistory(routeCode string, sailingDate string, departureTime string) models.SailingHistory {
+	history := models.SailingHistory{
+		RouteCode:     routeCode,
+		SailingDate:   sailingDate,
+		DepartureTime: departureTime,
+		Observations:  []models.FillSnapshot{},
+	}
+
+	for _, o := range m.filterObservations(func(o models.CapacityObservation) bool {
+		return o.RouteCode == routeCode && o.SailingDate == sailingDate && o.DepartureTime == departureTime
+	}) {
+		history.Observations = append(history.Observations, models.FillSnapshot{
+			ObservedAt:   o.ObservedAt,
+			Fill:         o.Fill,
+			CarFill:      o.CarFill,
+			OversizeFill: o.OversizeFill,
+			VesselName:   o.VesselName,
+		})
+	}
+
+	return history
+}
+
+func (m *MemoryStore) GetCapacityObservationsSince(routeCode string, since time.Time) []models.CapacityObservation {
+	return m.filterObservations(func(o models.CapacityObservation) bool {
+		return o.RouteCode == routeCode && !o.ObservedAt.Before(since)
+	})
+}
+
+func (m *MemoryStore) DownsampleCapacityObservations(cutoff time.Time, interval time.Duration) (int64, error) {
+	seconds := int64(interval / time.Second)
+	if seconds <= 0 {
+		return 0, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type bucketKey struct {
+		routeCode, sailingDate, departureTime string
+		bucket                                int64
+	}
+	latest := make(map[bucketKey]observationKey)
+
+	for key, o := range m.observations {
+		if !o.ObservedAt.Before(cutoff) {
+			continue
+		}
+
+		bucket := bucketKey{o.RouteCode, o.SailingDate, o.DepartureTime, o.ObservedAt.Unix() / seconds}
+		if kept, ok := latest[bucket]; ok && kept.observedAt > key.observedAt {
+			continue
+		}
+		latest[bucket] = key
+	}
+
+	keep := make(map[observationKey]bool, len(latest))
+	for _, key := range latest {
+		keep[key] = true
+	}
+
+	var deleted int64
+	for key, o := range m.observations {
+		if o.ObservedAt.Before(cutoff) && !keep[key] {
+			delete(m.observations, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *MemoryStore) PruneCapacityObservations(cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, o := range m.observations {
+		if o.ObservedAt.Before(cutoff) {
+			delete(m.observations, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+/*********************/
+/* Departure Records */
+/*********************/
+
+func (m *MemoryStore) SaveDepartureRecords(records []models.DepartureRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range records {
+		m.departures[departureKey{r.RouteCode, r.SailingDate, r.ScheduledDepartureTime}] = r
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) GetDepartureRecords(from string, to string) []models.DepartureRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := []models.DepartureRecord{}
+	for _, r := range m.departures {
+		if r.SailingDate >= from && r.SailingDate <= to {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.RouteCode != b.RouteCode {
+			return a.RouteCode < b.RouteCode
+		}
+		if a.SailingDate != b.SailingDate {
+			return a.SailingDate < b.SailingDate
+		}
+		return a.ScheduledDepartureTime < b.ScheduledDepartureTime
+	})
+
+	return records
+}
+
+func (m *MemoryStore) PruneDepartureRecords(cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, r := range m.departures {
+		if r.RecordedAt.Before(cutoff) {
+			delete(m.departures, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+/*****************/
+/* Cancellations */
+/*****************/
+
+func (m *MemoryStore) SaveCancellationEvents(events []models.CancellationEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range events {
+		key := departureKey{e.RouteCode, e.SailingDate, e.ScheduledDepartureTime}
+
+		if saved, ok := m.cancellations[key]; ok {
+			e.FirstSeenAt = saved.FirstSeenAt
+			if e.VesselName == "" {
+				e.VesselName = saved.VesselName
+			}
+			if e.Reason == "" {
+				e.Reason = saved.Reason
+			}
+		} else {
+			e.FirstSeenAt = e.LastSeenAt
+		}
+
+		m.cancellations[key] = e
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) GetCancellations(from string, to string, routeCode string) []models.CancellationEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []models.CancellationEvent{}
+	for _, e := range m.cancellations {
+		if e.SailingDate >= from && e.SailingDate <= to && (routeCode == "" || e.RouteCode == routeCode) {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].FirstSeenAt.Equal(events[j].FirstSeenAt) {
+			return events[i].FirstSeenAt.After(events[j].FirstSeenAt)
+		}
+		return events[i].RouteCode < events[j].RouteCode
+	})
+
+	return events
+}
+
+func (m *MemoryStore) PruneCancellationEvents(cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, e := range m.cancellations {
+		if e.LastSeenAt.Before(cutoff) {
+			delete(m.cancellations, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+/*******************/
+/* Service Changes */
+/*******************/
+
+func (m *MemoryStore) SaveServiceChanges(changes []models.ServiceChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range changes {
+		changes[i].ID = m.nextChangeID
+		m.nextChangeID++
+		m.changes = append(m.changes, changes[i])
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) GetServiceChanges(routeCode string, limit int) []models.ServiceChange {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changes := []models.ServiceChange{}
+	for _, c := range m.changes {
+		if routeCode == "" || c.RouteCode == routeCode {
+			changes = append(changes, c)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].DetectedAt.Equal(changes[j].DetectedAt) {
+			return changes[i].DetectedAt.After(changes[j].DetectedAt)
+		}
+		return changes[i].ID > changes[j].ID
+	})
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+
+	return changes
+}
+
+func (m *MemoryStore) PruneServiceChanges(cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.changes[:0]
+	for _, c := range m.changes {
+		if !c.DetectedAt.Before(cutoff) {
+			kept = append(kept, c)
+		}
+	}
+
+	deleted := int64(len(m.changes) - len(kept))
+	m.changes = kept
+	return deleted, nil
+}
+
+/*************************/
+/* Webhook Subscriptions */
+/*************************/
+
+func (m *MemoryStore) SaveSubscription(subscription *models.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscription.ID = m.nextSubscriptionID
+	m.nextSubscriptionID++
+
+	saved := *subscription
+	saved.RouteCodes = append([]string{}, subscription.RouteCodes...)
+	saved.EventTypes = append([]string{}, subscription.EventTypes...)
+	m.subscriptions = append(m.subscriptions, saved)
+
+	return nil
+}
+
+func (m *MemoryStore) GetSubscription(id int64) (models.Subscription, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, subscription := range m.subscriptions {
+		if subscription.ID == id {
+			return subscription, true
+		}
+	}
+
+	return models.Subscription{}, false
+}
+
+func (m *MemoryStore) GetSubscriptions() []models.Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Subscription{}, m.subscriptions...)
+}
+
+func (m *MemoryStore) DeleteSubscription(id int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	kept := m.subscriptions[:0]
+	for _, subscription := range m.subscriptions {
+		if subscription.ID == id {
+			found = true
+			continue
+		}
+		kept = append(kept, subscription)
+	}
+	m.subscriptions = kept
+
+	letters := m.deadLetters[:0]
+	for _, letter := range m.deadLetters {
+		if letter.SubscriptionID != id {
+			letters = append(letters, letter)
+		}
+	}
+	m.deadLetters = letters
+
+	return found, nil
+}
+
+func (m *MemoryStore) SaveDeadLetter(letter *models.DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	letter.ID = m.nextDeadLetterID
+	m.nextDeadLetterID++
+	m.deadLetters = append(m.deadLetters, *letter)
+
+	return nil
+}
+
+func (m *MemoryStore) GetDeadLetters(subscriptionID int64, limit int) []models.DeadLetter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	letters := []models.DeadLetter{}
+	for _, letter := range m.deadLetters {
+		if letter.SubscriptionID == subscriptionID {
+			letters = append(letters, letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].FailedAt.After(letters[j].FailedAt)
+		}
+		return letters[i].ID > letters[j].ID
+	})
+	if len(letters) > limit {
+		letters = letters[:limit]
+	}
+
+	return letters
+}
+
+func (m *MemoryStore) PruneDeadLetters(cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.deadLetters[:0]
+	for _, letter := range m.deadLetters {
+		if !letter.FailedAt.Before(cutoff) {
+			kept = append(kept, letter)
+		}
+	}
+
+	deleted := int64(len(m.deadLetters) - len(kept))
+	m.deadLetters = kept
+	return deleted, nil
+}
+
+// filterObservations returns the observations matching keep, oldest first
+func (m *MemoryStore) filterObservations(keep func(models.CapacityObservation) bool) []models.CapacityObservation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var observations []models.CapacityObservation
+	for _, o := range m.observations {
+		if keep(o) {
+			observations = append(observations, o)
+		}
+	}
+	sort.Slice(observations, func(i, j int) bool {
+		return observations[i].ObservedAt.Before(observations[j].ObservedAt)
+	})
+
+	return observations
+}
@@ -0,0 +1,325 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database has migrations applied that this
+// binary doesn't know about, i.e. it was migrated by a newer release.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// Migrations are numbered SQL files, e.g. 0002_normalized_sailings.up.sql with a
+// matching 0002_normalized_sailings.down.sql, in a directory per dialect.
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+/*
+ * Migrations
+ *
+ * Returns the store's migrations embedded in the binary, oldest first.
+ *
+ * @return []Migration
+ * @return error - if a file is misnamed or a version is missing its up file
+ */
+func (s *SQLStore) Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, s.dialect.migrations)
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := migrationFileRe.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has two names, %q and %q", version, m.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+/*
+ * MigrateUp
+ *
+ * Applies every embedded migration that hasn't been applied yet, oldest first,
+ * each in its own transaction.
+ *
+ * @return []Migration - the migrations applied
+ * @return error - ErrSchemaTooNew if the database is ahead of this binary
+ */
+func (s *SQLStore) MigrateUp() ([]Migration, error) {
+	migrations, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		ok, err := s.inMigrationTx(func(tx *sql.Tx, versions map[int]time.Time) (bool, error) {
+			if err := checkSchemaVersion(versions, migrations); err != nil {
+				return false, err
+			}
+			if _, done := versions[m.Version]; done {
+				return false, nil
+			}
+
+			if _, err := tx.Exec(m.Up); err != nil {
+				return false, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`, m.Version, m.Name, dbTime(time.Now()))
+			return err == nil, err
+		})
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, m)
+		}
+	}
+
+	return applied, nil
+}
+
+/*
+ * MigrateDown
+ *
+ * Reverts the most recently applied migrations, newest first.
+ *
+ * @param int steps - how many migrations to revert
+ *
+ * @return []Migration - the migrations reverted
+ * @return error
+ */
+func (s *SQLStore) MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]Migration)
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	var reverted []Migration
+	for i := 0; i < steps; i++ {
+		var m Migration
+		ok, err := s.inMigrationTx(func(tx *sql.Tx, versions map[int]time.Time) (bool, error) {
+			if err := checkSchemaVersion(versions, migrations); err != nil {
+				return false, err
+			}
+
+			latest := -1
+			for version := range versions {
+				if version > latest {
+					latest = version
+				}
+			}
+			if latest < 0 {
+				return false, nil
+			}
+
+			m = byVersion[latest]
+			if m.Down == "" {
+				return false, fmt.Errorf("migration %d_%s can't be reverted, it has no down file", m.Version, m.Name)
+			}
+
+			if _, err := tx.Exec(m.Down); err != nil {
+				return false, fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err == nil, err
+		})
+		if err != nil {
+			return reverted, err
+		}
+		if !ok {
+			break
+		}
+		reverted = append(reverted, m)
+	}
+
+	return reverted, nil
+}
+
+/*
+ * MigrationStatus
+ *
+ * Lists every embedded migration and when it was applied, if it has been.
+ *
+ * @return []MigrationStatus - oldest first
+ * @return error - ErrSchemaTooNew if the database is ahead of this binary
+ */
+func (s *SQLStore) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	versions, err := appliedVersions(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i].Migration = m
+		if appliedAt, ok := versions[m.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return statuses, checkSchemaVersion(versions, migrations)
+}
+
+func (s *SQLStore) ensureMigrationsTable() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at ` + s.dialect.timestampType + ` NOT NULL
+		)`)
+	return err
+}
+
+// inMigrationTx runs fn in a transaction holding the dialect's migration lock, if
+// it has one, so two servers starting at once don't apply the same migration
+// twice. fn is passed the versions applied so far, and the transaction is
+// committed if it returns true.
+func (s *SQLStore) inMigrationTx(fn func(tx *sql.Tx, versions map[int]time.Time) (bool, error)) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if s.dialect.migrationLock != "" {
+		if _, err := tx.Exec(s.dialect.migrationLock); err != nil {
+			return false, err
+		}
+	}
+
+	versions, err := appliedVersions(tx)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := fn(tx, versions)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func appliedVersions(q queryer) (map[int]time.Time, error) {
+	rows, err := q.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt nullTime
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt.Time
+	}
+
+	return versions, rows.Err()
+}
+
+/*
+ * checkSchemaVersion
+ *
+ * @param map[int]time.Time versions - applied migration versions
+ * @param []Migration migrations - migrations known to this binary
+ *
+ * @return error - ErrSchemaTooNew if any applied version is unknown
+ */
+func checkSchemaVersion(versions map[int]time.Time, migrations []Migration) error {
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+
+	for version := range versions {
+		if !known[version] {
+			return fmt.Errorf("%w: migration %d is applied but unknown", ErrSchemaTooNew, version)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+func TestMigrations_Embedded(t *testing.T) {
+	for _, d := range []*dialect{postgresDialect, sqliteDialect} {
+		migrations, err := (&SQLStore{dialect: d}).Migrations()
+		if err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s: migration %d has version %d, want versions numbered from 1 without gaps", d.name, i, m.Version)
+			}
+			if m.Up == "" || m.Down == "" {
+				t.Errorf("%s: migration %d_%s is missing its up or down file", d.name, m.Version, m.Name)
+			}
+		}
+	}
+}
+
+// initSQL is the schema databases were created with before migrations existed
+const initSQL = `
+CREATE TABLE capacity_routes (
+    route_code VARCHAR(6) PRIMARY KEY,
+    from_terminal_code VARCHAR(3) NOT NULL,
+    to_terminal_code VARCHAR(3) NOT NULL,
+    sailing_duration VARCHAR(7) NOT NULL,
+    sailings JSONB NOT NULL
+);
+
+CREATE TABLE non_capacity_routes (
+    route_code VARCHAR(6) PRIMARY KEY,
+    from_terminal_code VARCHAR(3) NOT NULL,
+    to_terminal_code VARCHAR(3) NOT NULL,
+    sailing_duration VARCHAR(7) NOT NULL,
+    sailings JSONB NOT NULL
+);`
+
+// testPostgres returns a store on a new, empty schema in the database at
+// TEST_POSTGRES_URL, skipping the test if it isn't set
+func testPostgres(t *testing.T) *SQLStore {
+	t.Helper()
+
+	rawURL := os.Getenv("TEST_POSTGRES_URL")
+	if rawURL == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	admin, err := OpenPostgres(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.DB().Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.DB().Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	s, err := OpenPostgres(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// checkUpgradedSchema fails the test unless the tables and columns that
+// init.sql databases are upgraded with work
+func checkUpgradedSchema(t *testing.T, s *SQLStore) {
+	t.Helper()
+	now := time.Now().Truncate(time.Second)
+
+	run := models.ScrapeRun{
+		Job:        models.CapacityJob,
+		StartedAt:  now,
+		FinishedAt: now,
+		Status:     models.RunSucceeded,
+		Routes:     []models.RouteScrapeResult{{RouteCode: "TSASWB", Outcome: models.OutcomeOK, ScrapedAt: now}},
+	}
+	if err := s.SaveScrapeRun(&run); err != nil {
+		t.Fatalf("SaveScrapeRun: %v", err)
+	}
+	if latest := s.GetLatestScrapeRuns()[models.CapacityJob]; latest.ID != run.ID {
+		t.Errorf("latest capacity run = %+v, want %d", latest, run.ID)
+	}
+
+	capacity := models.CapacityRoute{RouteCode: "TSASWB", FromTerminalCode: "TSA", ToTerminalCode: "SWB", LastUpdated: &now}
+	if err := s.SaveCapacityRoute(capacity); err != nil {
+		t.Fatalf("SaveCapacityRoute: %v", err)
+	}
+	if route, _ := s.GetCapacityRoute("TSASWB"); route.LastUpdated == nil || !route.LastUpdated.Equal(now) {
+		t.Errorf("capacity route LastUpdated = %v, want %v", route.LastUpdated, now)
+	}
+	nonCapacity := models.NonCapacityRoute{RouteCode: "SWBFUL", FromTerminalCode: "SWB", ToTerminalCode: "FUL", LastUpdated: &now}
+	if err := s.SaveNonCapacityRoute(nonCapacity); err != nil {
+		t.Fatalf("SaveNonCapacityRoute: %v", err)
+	}
+	if route, _ := s.GetNonCapacityRoute("SWBFUL"); route.LastUpdated == nil || !route.LastUpdated.Equal(now) {
+		t.Errorf("non-capacity route LastUpdated = %v, want %v", route.LastUpdated, now)
+	}
+
+	observation := models.CapacityObservation{
+		RouteCode:     "TSASWB",
+		SailingDate:   now.In(sailingtime.Location()).Format("2006-01-02"),
+		DepartureTime: "7:00 am",
+		ObservedAt:    now,
+		SailingStatus: "future",
+		Fill:          40,
+	}
+	if err := s.SaveCapacityObservations([]models.CapacityObservation{observation}); err != nil {
+		t.Fatalf("SaveCapacityObservations: %v", err)
+	}
+	if observations := s.GetCapacityObservationsSince("TSASWB", now.Add(-time.Minute)); len(observations) != 1 || observations[0].Fill != 40 {
+		t.Errorf("capacity observations = %+v", observations)
+	}
+}
+
+// Databases created from init.sql have no schema_migrations table, so every
+// migration runs against the tables they already have
+func TestPostgres_UpgradesInitSQL(t *testing.T) {
+	s := testPostgres(t)
+
+	if _, err := s.DB().Exec(initSQL); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.DB().Exec(`
+		INSERT INTO capacity_routes (route_code, from_terminal_code, to_terminal_code, sailing_duration, sailings)
+		VALUES ('TSASWB', 'TSA', 'SWB', '1h 35m', '[{"time": "7:00 am", "sailingStatus": "future", "fill": 40, "vesselName": "Spirit of British Columbia"}]')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	route, ok := s.GetCapacityRoute("TSASWB")
+	if !ok || len(route.Sailings) != 1 || route.Sailings[0].DepartureTime != "7:00 am" || route.Sailings[0].VesselName != "Spirit of British Columbia" {
+		t.Errorf("GetCapacityRoute(TSASWB) = %+v, %v", route, ok)
+	}
+	// Not scraped since the upgrade
+	if route.LastUpdated != nil {
+		t.Errorf("LastUpdated = %v, want nil", route.LastUpdated)
+	}
+	checkUpgradedSchema(t, s)
+}
+
+// Databases that applied an earlier 0001_initial_schema may be missing what
+// was added to it later, which the migrations after it add back
+func TestPostgres_RestoresSchemaMissingAfterInitialMigration(t *testing.T) {
+	tests := []struct {
+		version int
+		drop    string
+	}{
+		{10, "DROP TABLE scrape_run_routes, scrape_runs"},
+		{11, "ALTER TABLE capacity_routes DROP COLUMN scraped_at; ALTER TABLE non_capacity_routes DROP COLUMN scraped_at"},
+		{12, "DROP TABLE capacity_observations"},
+	}
+
+	for _, tt := range tests {
+		s := testPostgres(t)
+		if _, err := s.MigrateUp(); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+
+		if _, err := s.DB().Exec(tt.drop); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.DB().Exec(`DELETE FROM schema_migrations WHERE version = $1`, tt.version); err != nil {
+			t.Fatal(err)
+		}
+
+		if applied, err := s.MigrateUp(); err != nil || len(applied) != 1 || applied[0].Version != tt.version {
+			t.Fatalf("%s: MigrateUp = %v, %v; want only migration %d", tt.drop, applied, err, tt.version)
+		}
+		checkUpgradedSchema(t, s)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":  {Data: []byte("CREATE TABLE b ();")},
+		"m/0001_first.up.sql":   {Data: []byte("CREATE TABLE a ();")},
+		"m/0001_first.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Version != 2 {
+		t.Fatalf("migrations = %+v", migrations)
+	}
+	if migrations[0].Down != "DROP TABLE a;" || migrations[1].Down != "" {
+		t.Errorf("down files not matched to their migrations: %+v", migrations)
+	}
+
+	fsys["m/0003_third.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE c;")}
+	if _, err := loadMigrations(fsys, "m"); err == nil {
+		t.Error("expected an error for a migration without an up file")
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}}
+
+	if err := checkSchemaVersion(map[int]time.Time{1: {}}, migrations); err != nil {
+		t.Errorf("older schema: %v", err)
+	}
+	if err := checkSchemaVersion(map[int]time.Time{1: {}, 2: {}, 3: {}}, migrations); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("newer schema: got %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestSQLStore_MigrateDownAndUp(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	applied, err := s.MigrateUp()
+	if err != nil || len(applied) == 0 {
+		t.Fatalf("MigrateUp = %v, %v", applied, err)
+	}
+	if again, err := s.MigrateUp(); err != nil || len(again) != 0 {
+		t.Errorf("second MigrateUp = %v, %v; want nothing to apply", again, err)
+	}
+
+	reverted, err := s.MigrateDown(len(applied))
+	if err != nil || len(reverted) != len(applied) {
+		t.Fatalf("MigrateDown = %v, %v", reverted, err)
+	}
+
+	statuses, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			t.Errorf("migration %d still applied after reverting everything", status.Version)
+		}
+	}
+
+	if _, err := s.MigrateUp(); err != nil {
+		t.Errorf("MigrateUp after reverting: %v", err)
+	}
+}
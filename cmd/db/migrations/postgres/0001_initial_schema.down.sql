@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS capacity_observations;
+DROP TABLE IF EXISTS scrape_run_routes;
+DROP TABLE IF EXISTS scrape_runs;
+DROP TABLE IF EXISTS non_capacity_routes;
+DROP TABLE IF EXISTS capacity_routes;
@@ -0,0 +1,60 @@
+-- Schema as created by init.sql before migrations were introduced. Safe to run
+-- against a database that already has some or all of it.
+
+CREATE TABLE IF NOT EXISTS capacity_routes (
+    route_code VARCHAR(6) PRIMARY KEY,
+    from_terminal_code VARCHAR(3) NOT NULL,
+    to_terminal_code VARCHAR(3) NOT NULL,
+    sailing_duration VARCHAR(7) NOT NULL,
+    sailings JSONB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS non_capacity_routes (
+    route_code VARCHAR(6) PRIMARY KEY,
+    from_terminal_code VARCHAR(3) NOT NULL,
+    to_terminal_code VARCHAR(3) NOT NULL,
+    sailing_duration VARCHAR(7) NOT NULL,
+    sailings JSONB NOT NULL
+);
+
+ALTER TABLE capacity_routes ADD COLUMN IF NOT EXISTS scraped_at TIMESTAMPTZ;
+ALTER TABLE non_capacity_routes ADD COLUMN IF NOT EXISTS scraped_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS scrape_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job VARCHAR(16) NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(16) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS scrape_runs_job_started_at_idx ON scrape_runs (job, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS scrape_run_routes (
+    run_id BIGINT NOT NULL REFERENCES scrape_runs (id) ON DELETE CASCADE,
+    route_code VARCHAR(6) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    http_status INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    warning_count INTEGER NOT NULL DEFAULT 0,
+    sailing_count INTEGER NOT NULL DEFAULT 0,
+    scraped_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (run_id, route_code)
+);
+
+CREATE INDEX IF NOT EXISTS scrape_run_routes_route_code_scraped_at_idx ON scrape_run_routes (route_code, scraped_at DESC);
+
+CREATE TABLE IF NOT EXISTS capacity_observations (
+    route_code VARCHAR(6) NOT NULL,
+    sailing_date DATE NOT NULL,
+    departure_time VARCHAR(8) NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL,
+    sailing_status VARCHAR(16) NOT NULL,
+    fill SMALLINT NOT NULL,
+    car_fill SMALLINT NOT NULL,
+    oversize_fill SMALLINT NOT NULL,
+    vessel_name TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (route_code, sailing_date, departure_time, observed_at)
+);
+
+CREATE INDEX IF NOT EXISTS capacity_observations_observed_at_idx ON capacity_observations (observed_at);
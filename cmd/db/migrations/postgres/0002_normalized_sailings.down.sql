@@ -0,0 +1,66 @@
+ALTER TABLE capacity_routes
+    DROP CONSTRAINT IF EXISTS capacity_routes_route_code_fkey,
+    ADD COLUMN from_terminal_code VARCHAR(3),
+    ADD COLUMN to_terminal_code VARCHAR(3),
+    ADD COLUMN sailings JSONB;
+
+ALTER TABLE non_capacity_routes
+    DROP CONSTRAINT IF EXISTS non_capacity_routes_route_code_fkey,
+    ADD COLUMN from_terminal_code VARCHAR(3),
+    ADD COLUMN to_terminal_code VARCHAR(3),
+    ADD COLUMN sailings JSONB;
+
+UPDATE capacity_routes c
+SET
+    from_terminal_code = r.from_terminal_code,
+    to_terminal_code = r.to_terminal_code,
+    sailings = COALESCE((
+        SELECT jsonb_agg(jsonb_build_object(
+            'time', s.departure_time,
+            'arrivalTime', s.arrival_time,
+            'sailingStatus', s.sailing_status,
+            'fill', s.fill,
+            'carFill', s.car_fill,
+            'oversizeFill', s.oversize_fill,
+            'vesselName', COALESCE(v.name, ''),
+            'vesselStatus', s.vessel_status
+        ) ORDER BY s.position)
+        FROM sailings s
+        LEFT JOIN vessels v ON v.id = s.vessel_id
+        WHERE s.route_code = c.route_code AND s.kind = 'capacity'
+    ), '[]'::jsonb)
+FROM routes r
+WHERE r.route_code = c.route_code;
+
+UPDATE non_capacity_routes n
+SET
+    from_terminal_code = r.from_terminal_code,
+    to_terminal_code = r.to_terminal_code,
+    sailings = COALESCE((
+        SELECT jsonb_agg(jsonb_build_object(
+            'time', s.departure_time,
+            'arrivalTime', s.arrival_time,
+            'vesselName', COALESCE(v.name, ''),
+            'vesselStatus', s.vessel_status
+        ) ORDER BY s.position)
+        FROM sailings s
+        LEFT JOIN vessels v ON v.id = s.vessel_id
+        WHERE s.route_code = n.route_code AND s.kind = 'noncapacity'
+    ), '[]'::jsonb)
+FROM routes r
+WHERE r.route_code = n.route_code;
+
+ALTER TABLE capacity_routes
+    ALTER COLUMN from_terminal_code SET NOT NULL,
+    ALTER COLUMN to_terminal_code SET NOT NULL,
+    ALTER COLUMN sailings SET NOT NULL;
+
+ALTER TABLE non_capacity_routes
+    ALTER COLUMN from_terminal_code SET NOT NULL,
+    ALTER COLUMN to_terminal_code SET NOT NULL,
+    ALTER COLUMN sailings SET NOT NULL;
+
+DROP TABLE sailings;
+DROP TABLE vessels;
+DROP TABLE routes;
+DROP TABLE terminals;
@@ -0,0 +1,121 @@
+-- Moves sailings out of the JSONB `sailings` column of capacity_routes and
+-- non_capacity_routes into one row per sailing, with terminals, routes and
+-- vessels in their own tables.
+
+CREATE TABLE terminals (
+    code VARCHAR(3) PRIMARY KEY
+);
+
+CREATE TABLE routes (
+    route_code VARCHAR(6) PRIMARY KEY,
+    from_terminal_code VARCHAR(3) NOT NULL REFERENCES terminals (code),
+    to_terminal_code VARCHAR(3) NOT NULL REFERENCES terminals (code)
+);
+
+CREATE TABLE vessels (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE sailings (
+    id BIGSERIAL PRIMARY KEY,
+    route_code VARCHAR(6) NOT NULL REFERENCES routes (route_code),
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('capacity', 'noncapacity')),
+    position INTEGER NOT NULL,
+    departure_time VARCHAR(16) NOT NULL DEFAULT '',
+    departure_minutes SMALLINT,
+    arrival_time VARCHAR(16) NOT NULL DEFAULT '',
+    sailing_status VARCHAR(16) NOT NULL DEFAULT '',
+    fill SMALLINT NOT NULL DEFAULT 0,
+    car_fill SMALLINT NOT NULL DEFAULT 0,
+    oversize_fill SMALLINT NOT NULL DEFAULT 0,
+    vessel_id INTEGER REFERENCES vessels (id),
+    vessel_status TEXT NOT NULL DEFAULT '',
+    UNIQUE (route_code, kind, position)
+);
+
+CREATE INDEX sailings_route_departure_idx ON sailings (route_code, kind, departure_minutes);
+CREATE INDEX sailings_vessel_id_idx ON sailings (vessel_id);
+CREATE INDEX sailings_status_idx ON sailings (kind, sailing_status);
+
+-- Backfill from the JSONB columns
+
+INSERT INTO terminals (code)
+SELECT from_terminal_code FROM capacity_routes
+UNION SELECT to_terminal_code FROM capacity_routes
+UNION SELECT from_terminal_code FROM non_capacity_routes
+UNION SELECT to_terminal_code FROM non_capacity_routes;
+
+INSERT INTO routes (route_code, from_terminal_code, to_terminal_code)
+SELECT route_code, from_terminal_code, to_terminal_code FROM capacity_routes
+UNION
+SELECT route_code, from_terminal_code, to_terminal_code FROM non_capacity_routes
+ON CONFLICT (route_code) DO NOTHING;
+
+INSERT INTO vessels (name)
+SELECT DISTINCT s->>'vesselName'
+FROM (
+    SELECT jsonb_array_elements(sailings) AS s FROM capacity_routes
+    UNION ALL
+    SELECT jsonb_array_elements(sailings) FROM non_capacity_routes
+) all_sailings
+WHERE COALESCE(s->>'vesselName', '') <> '';
+
+INSERT INTO sailings (
+    route_code, kind, position, departure_time, departure_minutes, arrival_time,
+    sailing_status, fill, car_fill, oversize_fill, vessel_id, vessel_status
+)
+SELECT
+    r.route_code,
+    'capacity',
+    s.position,
+    COALESCE(s.sailing->>'time', ''),
+    CASE WHEN lower(s.sailing->>'time') ~ '^\d{1,2}:\d{2} [ap]m$'
+        THEN (EXTRACT(HOUR FROM to_timestamp(s.sailing->>'time', 'HH12:MI AM')) * 60
+            + EXTRACT(MINUTE FROM to_timestamp(s.sailing->>'time', 'HH12:MI AM')))::SMALLINT
+    END,
+    COALESCE(s.sailing->>'arrivalTime', ''),
+    COALESCE(s.sailing->>'sailingStatus', ''),
+    COALESCE((s.sailing->>'fill')::SMALLINT, 0),
+    COALESCE((s.sailing->>'carFill')::SMALLINT, 0),
+    COALESCE((s.sailing->>'oversizeFill')::SMALLINT, 0),
+    v.id,
+    COALESCE(s.sailing->>'vesselStatus', '')
+FROM capacity_routes r
+CROSS JOIN LATERAL jsonb_array_elements(r.sailings) WITH ORDINALITY AS s (sailing, position)
+LEFT JOIN vessels v ON v.name = s.sailing->>'vesselName';
+
+INSERT INTO sailings (
+    route_code, kind, position, departure_time, departure_minutes, arrival_time,
+    vessel_id, vessel_status
+)
+SELECT
+    r.route_code,
+    'noncapacity',
+    s.position,
+    COALESCE(s.sailing->>'time', ''),
+    CASE WHEN lower(s.sailing->>'time') ~ '^\d{1,2}:\d{2} [ap]m$'
+        THEN (EXTRACT(HOUR FROM to_timestamp(s.sailing->>'time', 'HH12:MI AM')) * 60
+            + EXTRACT(MINUTE FROM to_timestamp(s.sailing->>'time', 'HH12:MI AM')))::SMALLINT
+    END,
+    COALESCE(s.sailing->>'arrivalTime', ''),
+    v.id,
+    COALESCE(s.sailing->>'vesselStatus', '')
+FROM non_capacity_routes r
+CROSS JOIN LATERAL jsonb_array_elements(r.sailings) WITH ORDINALITY AS s (sailing, position)
+LEFT JOIN vessels v ON v.name = s.sailing->>'vesselName';
+
+-- capacity_routes and non_capacity_routes keep only what is specific to each
+-- kind of schedule
+
+ALTER TABLE capacity_routes
+    DROP COLUMN sailings,
+    DROP COLUMN from_terminal_code,
+    DROP COLUMN to_terminal_code,
+    ADD FOREIGN KEY (route_code) REFERENCES routes (route_code);
+
+ALTER TABLE non_capacity_routes
+    DROP COLUMN sailings,
+    DROP COLUMN from_terminal_code,
+    DROP COLUMN to_terminal_code,
+    ADD FOREIGN KEY (route_code) REFERENCES routes (route_code);
@@ -0,0 +1 @@
+ALTER TABLE sailings DROP COLUMN IF EXISTS is_tomorrow;
@@ -0,0 +1,2 @@
+-- Capacity sailings marked "(Tomorrow)" on bcferries.com, so they can be dated
+ALTER TABLE sailings ADD COLUMN IF NOT EXISTS is_tomorrow BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+ALTER TABLE sailings
+    DROP COLUMN IF EXISTS scheduled_departure_time,
+    DROP COLUMN IF EXISTS actual_departure_time,
+    DROP COLUMN IF EXISTS delay_minutes;
@@ -0,0 +1,16 @@
+-- How each scheduled capacity sailing turned out, kept after it drops off
+-- bcferries.com for on-time statistics
+CREATE TABLE IF NOT EXISTS departure_records (
+    route_code VARCHAR(6) NOT NULL,
+    sailing_date DATE NOT NULL,
+    scheduled_departure_time VARCHAR(8) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    actual_departure_time VARCHAR(8) NOT NULL DEFAULT '',
+    delay_minutes INTEGER NOT NULL DEFAULT 0,
+    arrival_time VARCHAR(8) NOT NULL DEFAULT '',
+    vessel_name TEXT NOT NULL DEFAULT '',
+    recorded_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (route_code, sailing_date, scheduled_departure_time)
+);
+
+CREATE INDEX IF NOT EXISTS departure_records_sailing_date_idx ON departure_records (sailing_date);
@@ -0,0 +1,13 @@
+-- Cancelled sailings and the reason given, kept after they drop off bcferries.com
+CREATE TABLE IF NOT EXISTS cancellation_events (
+    route_code VARCHAR(6) NOT NULL,
+    sailing_date DATE NOT NULL,
+    scheduled_departure_time VARCHAR(8) NOT NULL,
+    vessel_name TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (route_code, sailing_date, scheduled_departure_time)
+);
+
+CREATE INDEX IF NOT EXISTS cancellation_events_sailing_date_idx ON cancellation_events (sailing_date);
@@ -0,0 +1,15 @@
+-- Changes detected between consecutive scrapes of a route, for the alerts feeds
+CREATE TABLE IF NOT EXISTS service_changes (
+    id BIGSERIAL PRIMARY KEY,
+    route_code VARCHAR(6) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    sailing_date DATE NOT NULL,
+    departure_time VARCHAR(8) NOT NULL,
+    previous TEXT NOT NULL DEFAULT '',
+    current TEXT NOT NULL DEFAULT '',
+    summary TEXT NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS service_changes_detected_at_idx ON service_changes (detected_at DESC);
+CREATE INDEX IF NOT EXISTS service_changes_route_code_idx ON service_changes (route_code, detected_at DESC);
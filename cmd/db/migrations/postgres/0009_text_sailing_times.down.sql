@@ -0,0 +1,17 @@
+ALTER TABLE service_changes
+    ALTER COLUMN departure_time TYPE VARCHAR(8) USING left(departure_time, 8);
+
+ALTER TABLE cancellation_events
+    ALTER COLUMN scheduled_departure_time TYPE VARCHAR(8) USING left(scheduled_departure_time, 8);
+
+ALTER TABLE departure_records
+    ALTER COLUMN scheduled_departure_time TYPE VARCHAR(8) USING left(scheduled_departure_time, 8),
+    ALTER COLUMN actual_departure_time TYPE VARCHAR(8) USING left(actual_departure_time, 8),
+    ALTER COLUMN arrival_time TYPE VARCHAR(8) USING left(arrival_time, 8);
+
+ALTER TABLE capacity_observations
+    ALTER COLUMN departure_time TYPE VARCHAR(8) USING left(departure_time, 8);
+
+ALTER TABLE sailings
+    ALTER COLUMN departure_time TYPE VARCHAR(16) USING left(departure_time, 16),
+    ALTER COLUMN arrival_time TYPE VARCHAR(16) USING left(arrival_time, 16);
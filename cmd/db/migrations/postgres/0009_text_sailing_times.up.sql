@@ -0,0 +1,20 @@
+-- The non-capacity parser keeps a cell's raw text when it has no clock time,
+-- which can be longer than the old VARCHAR limits and failed the whole route
+-- save. Times are stored as TEXT, like the columns added in 0004.
+ALTER TABLE sailings
+    ALTER COLUMN departure_time TYPE TEXT,
+    ALTER COLUMN arrival_time TYPE TEXT;
+
+ALTER TABLE capacity_observations
+    ALTER COLUMN departure_time TYPE TEXT;
+
+ALTER TABLE departure_records
+    ALTER COLUMN scheduled_departure_time TYPE TEXT,
+    ALTER COLUMN actual_departure_time TYPE TEXT,
+    ALTER COLUMN arrival_time TYPE TEXT;
+
+ALTER TABLE cancellation_events
+    ALTER COLUMN scheduled_departure_time TYPE TEXT;
+
+ALTER TABLE service_changes
+    ALTER COLUMN departure_time TYPE TEXT;
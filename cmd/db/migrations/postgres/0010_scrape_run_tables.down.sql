@@ -0,0 +1 @@
+-- The tables belong to 0001_initial_schema, which drops them when reverted.
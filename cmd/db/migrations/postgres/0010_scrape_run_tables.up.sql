@@ -0,0 +1,26 @@
+-- Scrape run history (/v2/status/). 0001 creates these tables on new databases;
+-- this adds them to databases that applied a 0001 without them, and does
+-- nothing elsewhere.
+CREATE TABLE IF NOT EXISTS scrape_runs (
+    id BIGSERIAL PRIMARY KEY,
+    job VARCHAR(16) NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(16) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS scrape_runs_job_started_at_idx ON scrape_runs (job, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS scrape_run_routes (
+    run_id BIGINT NOT NULL REFERENCES scrape_runs (id) ON DELETE CASCADE,
+    route_code VARCHAR(6) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    http_status INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    warning_count INTEGER NOT NULL DEFAULT 0,
+    sailing_count INTEGER NOT NULL DEFAULT 0,
+    scraped_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (run_id, route_code)
+);
+
+CREATE INDEX IF NOT EXISTS scrape_run_routes_route_code_scraped_at_idx ON scrape_run_routes (route_code, scraped_at DESC);
@@ -0,0 +1,5 @@
+-- Per-route lastUpdated and staleness. 0001 adds these columns on new
+-- databases; this adds them to databases that applied a 0001 without them.
+-- Routes saved before then keep a NULL scrape time until they are next scraped.
+ALTER TABLE capacity_routes ADD COLUMN IF NOT EXISTS scraped_at TIMESTAMPTZ;
+ALTER TABLE non_capacity_routes ADD COLUMN IF NOT EXISTS scraped_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+-- The table belongs to 0001_initial_schema, which drops it when reverted.
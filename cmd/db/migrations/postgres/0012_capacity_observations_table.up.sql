@@ -0,0 +1,17 @@
+-- Capacity history. 0001 creates this table on new databases; this adds it,
+-- with the TEXT departure time from 0009, to databases that applied a 0001
+-- without it, and does nothing elsewhere.
+CREATE TABLE IF NOT EXISTS capacity_observations (
+    route_code VARCHAR(6) NOT NULL,
+    sailing_date DATE NOT NULL,
+    departure_time TEXT NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL,
+    sailing_status VARCHAR(16) NOT NULL,
+    fill SMALLINT NOT NULL,
+    car_fill SMALLINT NOT NULL,
+    oversize_fill SMALLINT NOT NULL,
+    vessel_name TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (route_code, sailing_date, departure_time, observed_at)
+);
+
+CREATE INDEX IF NOT EXISTS capacity_observations_observed_at_idx ON capacity_observations (observed_at);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS capacity_observations;
+DROP TABLE IF EXISTS scrape_run_routes;
+DROP TABLE IF EXISTS scrape_runs;
+DROP TABLE IF EXISTS sailings;
+DROP TABLE IF EXISTS vessels;
+DROP TABLE IF EXISTS non_capacity_routes;
+DROP TABLE IF EXISTS capacity_routes;
+DROP TABLE IF EXISTS routes;
+DROP TABLE IF EXISTS terminals;
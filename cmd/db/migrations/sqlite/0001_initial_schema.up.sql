@@ -0,0 +1,89 @@
+-- SQLite equivalent of the Postgres schema after migration 0002. Times are
+-- stored as UTC text, which sorts and compares correctly.
+
+CREATE TABLE terminals (
+    code TEXT PRIMARY KEY
+);
+
+CREATE TABLE routes (
+    route_code TEXT PRIMARY KEY,
+    from_terminal_code TEXT NOT NULL REFERENCES terminals (code),
+    to_terminal_code TEXT NOT NULL REFERENCES terminals (code)
+);
+
+CREATE TABLE capacity_routes (
+    route_code TEXT PRIMARY KEY REFERENCES routes (route_code),
+    sailing_duration TEXT NOT NULL,
+    scraped_at TIMESTAMP
+);
+
+CREATE TABLE non_capacity_routes (
+    route_code TEXT PRIMARY KEY REFERENCES routes (route_code),
+    sailing_duration TEXT NOT NULL,
+    scraped_at TIMESTAMP
+);
+
+CREATE TABLE vessels (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE sailings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    route_code TEXT NOT NULL REFERENCES routes (route_code),
+    kind TEXT NOT NULL CHECK (kind IN ('capacity', 'noncapacity')),
+    position INTEGER NOT NULL,
+    departure_time TEXT NOT NULL DEFAULT '',
+    departure_minutes INTEGER,
+    arrival_time TEXT NOT NULL DEFAULT '',
+    sailing_status TEXT NOT NULL DEFAULT '',
+    fill INTEGER NOT NULL DEFAULT 0,
+    car_fill INTEGER NOT NULL DEFAULT 0,
+    oversize_fill INTEGER NOT NULL DEFAULT 0,
+    vessel_id INTEGER REFERENCES vessels (id),
+    vessel_status TEXT NOT NULL DEFAULT '',
+    UNIQUE (route_code, kind, position)
+);
+
+CREATE INDEX sailings_route_departure_idx ON sailings (route_code, kind, departure_minutes);
+CREATE INDEX sailings_vessel_id_idx ON sailings (vessel_id);
+CREATE INDEX sailings_status_idx ON sailings (kind, sailing_status);
+
+CREATE TABLE scrape_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    status TEXT NOT NULL
+);
+
+CREATE INDEX scrape_runs_job_started_at_idx ON scrape_runs (job, started_at DESC);
+
+CREATE TABLE scrape_run_routes (
+    run_id INTEGER NOT NULL REFERENCES scrape_runs (id) ON DELETE CASCADE,
+    route_code TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    http_status INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    warning_count INTEGER NOT NULL DEFAULT 0,
+    sailing_count INTEGER NOT NULL DEFAULT 0,
+    scraped_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (run_id, route_code)
+);
+
+CREATE INDEX scrape_run_routes_route_code_scraped_at_idx ON scrape_run_routes (route_code, scraped_at DESC);
+
+CREATE TABLE capacity_observations (
+    route_code TEXT NOT NULL,
+    sailing_date TEXT NOT NULL,
+    departure_time TEXT NOT NULL,
+    observed_at TIMESTAMP NOT NULL,
+    sailing_status TEXT NOT NULL,
+    fill INTEGER NOT NULL,
+    car_fill INTEGER NOT NULL,
+    oversize_fill INTEGER NOT NULL,
+    vessel_name TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (route_code, sailing_date, departure_time, observed_at)
+);
+
+CREATE INDEX capacity_observations_observed_at_idx ON capacity_observations (observed_at);
@@ -0,0 +1 @@
+ALTER TABLE sailings DROP COLUMN is_tomorrow;
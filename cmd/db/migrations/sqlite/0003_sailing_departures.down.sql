@@ -0,0 +1,3 @@
+ALTER TABLE sailings DROP COLUMN scheduled_departure_time;
+ALTER TABLE sailings DROP COLUMN actual_departure_time;
+ALTER TABLE sailings DROP COLUMN delay_minutes;
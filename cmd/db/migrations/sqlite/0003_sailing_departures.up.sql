@@ -0,0 +1,9 @@
+-- Scheduled and actual departure of capacity sailings, and the delay between them
+ALTER TABLE sailings ADD COLUMN scheduled_departure_time TEXT NOT NULL DEFAULT '';
+ALTER TABLE sailings ADD COLUMN actual_departure_time TEXT NOT NULL DEFAULT '';
+ALTER TABLE sailings ADD COLUMN delay_minutes INTEGER NOT NULL DEFAULT 0;
+
+-- departure_time was the scheduled time for sailings that hadn't left yet
+UPDATE sailings
+SET scheduled_departure_time = departure_time
+WHERE kind = 'capacity' AND sailing_status IN ('future', 'cancelled');
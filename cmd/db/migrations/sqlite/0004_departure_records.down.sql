@@ -0,0 +1 @@
+DROP TABLE departure_records;
@@ -0,0 +1,16 @@
+-- How each scheduled capacity sailing turned out, kept after it drops off
+-- bcferries.com for on-time statistics
+CREATE TABLE departure_records (
+    route_code TEXT NOT NULL,
+    sailing_date TEXT NOT NULL,
+    scheduled_departure_time TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    actual_departure_time TEXT NOT NULL DEFAULT '',
+    delay_minutes INTEGER NOT NULL DEFAULT 0,
+    arrival_time TEXT NOT NULL DEFAULT '',
+    vessel_name TEXT NOT NULL DEFAULT '',
+    recorded_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (route_code, sailing_date, scheduled_departure_time)
+);
+
+CREATE INDEX departure_records_sailing_date_idx ON departure_records (sailing_date);
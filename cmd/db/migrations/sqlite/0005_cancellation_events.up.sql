@@ -0,0 +1,13 @@
+-- Cancelled sailings and the reason given, kept after they drop off bcferries.com
+CREATE TABLE cancellation_events (
+    route_code TEXT NOT NULL,
+    sailing_date TEXT NOT NULL,
+    scheduled_departure_time TEXT NOT NULL,
+    vessel_name TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (route_code, sailing_date, scheduled_departure_time)
+);
+
+CREATE INDEX cancellation_events_sailing_date_idx ON cancellation_events (sailing_date);
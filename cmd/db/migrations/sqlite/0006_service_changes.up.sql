@@ -0,0 +1,15 @@
+-- Changes detected between consecutive scrapes of a route, for the alerts feeds
+CREATE TABLE service_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    route_code TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    sailing_date TEXT NOT NULL,
+    departure_time TEXT NOT NULL,
+    previous TEXT NOT NULL DEFAULT '',
+    current TEXT NOT NULL DEFAULT '',
+    summary TEXT NOT NULL,
+    detected_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX service_changes_detected_at_idx ON service_changes (detected_at DESC);
+CREATE INDEX service_changes_route_code_idx ON service_changes (route_code, detected_at DESC);
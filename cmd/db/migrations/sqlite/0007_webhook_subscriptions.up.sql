@@ -0,0 +1,24 @@
+-- Webhooks registered through /v2/subscriptions, and deliveries that failed every retry
+CREATE TABLE webhook_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    route_codes TEXT NOT NULL DEFAULT '',
+    event_types TEXT NOT NULL,
+    fill_threshold INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhook_dead_letters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_status INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    failed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_dead_letters_subscription_idx ON webhook_dead_letters (subscription_id, failed_at DESC);
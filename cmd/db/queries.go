@@ -1,56 +1,122 @@
 package db
 
 import (
-	"encoding/json"
+	"database/sql"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
 )
 
 /*
  * GetCapacitySailings
  *
- * Retrieves all capacity route records from the database, including parsed sailing data.
+ * Retrieves all capacity routes from the database, including their sailings.
  *
- * Queries the `capacity_routes` table and unmarshals the `sailings` JSON column
- * into a slice of `models.CapacitySailing` for each route.
+ * Routes come from `capacity_routes` joined to `routes`, and sailings from the
+ * `sailings` table in the order they were scraped. LastUpdated is set from the
+ * `scraped_at` column, and is nil for rows written before it existed.
  *
  * @return []models.CapacityRoute - a slice of capacity routes with their sailings
  */
-func GetCapacitySailings() []models.CapacityRoute {
+func (s *SQLStore) GetCapacitySailings() []models.CapacityRoute {
+	return s.getCapacityRoutes("", allSailings)
+}
+
+/*
+ * GetCapacityRoute
+ *
+ * Retrieves a single capacity route and its sailings.
+ *
+ * @param string routeCode - e.g. "TSASWB"
+ *
+ * @return models.CapacityRoute
+ * @return bool - false if the route isn't in the database
+ */
+func (s *SQLStore) GetCapacityRoute(routeCode string) (models.CapacityRoute, bool) {
+	routes := s.getCapacityRoutes(routeCode, allSailings)
+	if len(routes) == 0 {
+		return models.CapacityRoute{}, false
+	}
+	return routes[0], true
+}
+
+/*
+ * FilterCapacitySailings
+ *
+ * Retrieves capacity routes with only the sailings that match a filter. The
+ * filter is applied in the query, apart from its limit.
+ *
+ * @param string routeCode - e.g. "TSASWB", or empty for every route
+ * @param models.SailingFilter filter
+ *
+ * @return []models.CapacityRoute - routes that haven't been scraped are left out
+ */
+func (s *SQLStore) FilterCapacitySailings(routeCode string, filter models.SailingFilter) []models.CapacityRoute {
+	return s.getCapacityRoutes(routeCode, filter)
+}
+
+// getCapacityRoutes reads one route, or every route when routeCode is empty
+func (s *SQLStore) getCapacityRoutes(routeCode string, filter models.SailingFilter) []models.CapacityRoute {
 	var routes []models.CapacityRoute
 
-	sqlStatement := `SELECT * FROM capacity_routes`
+	for _, info := range s.getRouteInfo("capacity_routes", routeCode) {
+		routes = append(routes, models.CapacityRoute{
+			RouteCode:        info.routeCode,
+			FromTerminalCode: info.fromTerminalCode,
+			ToTerminalCode:   info.toTerminalCode,
+			SailingDuration:  info.sailingDuration,
+			Sailings:         []models.CapacitySailing{},
+			LastUpdated:      info.lastUpdated,
+		})
+	}
+
+	if len(routes) == 0 {
+		return routes
+	}
+
+	byRoute := make(map[string]*models.CapacityRoute)
+	for i := range routes {
+		byRoute[routes[i].RouteCode] = &routes[i]
+	}
+
+	sqlStatement := `
+		SELECT s.route_code, s.departure_time, s.scheduled_departure_time, s.actual_departure_time, s.delay_minutes, s.arrival_time, s.sailing_status, s.fill, s.car_fill, s.oversize_fill, COALESCE(v.name, ''), s.vessel_status, s.is_tomorrow
+		FROM sailings s
+		LEFT JOIN vessels v ON v.id = s.vessel_id
+		WHERE s.kind = $1 AND ($2 = '' OR s.route_code = $2)`
 
-	rows, err := Conn.Query(sqlStatement)
+	conditions, args := sailingConditions(filter, []interface{}{models.CapacityJob, routeCode})
+	sqlStatement += conditions + `
+		ORDER BY s.route_code, s.position`
+
+	rows, err := s.db.Query(sqlStatement, args...)
 	if err != nil {
-		log.Printf("GetCapacitySailings: query failed: %v", err)
+		log.Printf("getCapacityRoutes: query failed: %v", err)
 		return routes
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var route models.CapacityRoute
-		var sailings []uint8
+		var routeCode string
+		var sailing models.CapacitySailing
 
-		err := rows.Scan(&route.RouteCode, &route.FromTerminalCode, &route.ToTerminalCode, &route.SailingDuration, &sailings)
+		err := rows.Scan(&routeCode, &sailing.DepartureTime, &sailing.ScheduledDepartureTime, &sailing.ActualDepartureTime, &sailing.DelayMinutes, &sailing.ArrivalTime, &sailing.SailingStatus, &sailing.Fill, &sailing.CarFill, &sailing.OversizeFill, &sailing.VesselName, &sailing.VesselStatus, &sailing.IsTomorrow)
 		if err != nil {
-			log.Printf("GetCapacitySailings: row scan failed: %v", err)
+			log.Printf("getCapacityRoutes: row scan failed: %v", err)
 			continue
 		}
 
-		var content []models.CapacitySailing
-		if err := json.Unmarshal(sailings, &content); err != nil {
-			log.Printf("GetCapacitySailings: JSON unmarshal failed: %v", err)
-			continue
+		if route, ok := byRoute[routeCode]; ok && (filter.Limit == 0 || len(route.Sailings) < filter.Limit) {
+			route.Sailings = append(route.Sailings, sailing)
 		}
-
-		route.Sailings = content
-		routes = append(routes, route)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("GetCapacitySailings: row iteration error: %v", err)
+		log.Printf("getCapacityRoutes: row iteration error: %v", err)
 	}
 
 	return routes
@@ -59,48 +125,491 @@ func GetCapacitySailings() []models.CapacityRoute {
 /*
  * GetNonCapacitySailings
  *
- * Retrieves all non-capacity route records from the database, including parsed sailing data.
+ * Retrieves all non-capacity routes from the database, including their sailings.
  *
- * Queries the `non_capacity_routes` table and unmarshals the `sailings` JSON column
- * into a slice of `models.NonCapacitySailing` for each route.
+ * Routes come from `non_capacity_routes` joined to `routes`, and sailings from the
+ * `sailings` table in the order they were scraped. LastUpdated is set from the
+ * `scraped_at` column, and is nil for rows written before it existed.
  *
  * @return []models.NonCapacityRoute - a slice of non-capacity routes with their sailings
  */
-func GetNonCapacitySailings() []models.NonCapacityRoute {
+func (s *SQLStore) GetNonCapacitySailings() []models.NonCapacityRoute {
+	return s.getNonCapacityRoutes("", allSailings)
+}
+
+/*
+ * GetNonCapacityRoute
+ *
+ * Retrieves a single non-capacity route and its sailings.
+ *
+ * @param string routeCode - e.g. "TSASWB"
+ *
+ * @return models.NonCapacityRoute
+ * @return bool - false if the route isn't in the database
+ */
+func (s *SQLStore) GetNonCapacityRoute(routeCode string) (models.NonCapacityRoute, bool) {
+	routes := s.getNonCapacityRoutes(routeCode, allSailings)
+	if len(routes) == 0 {
+		return models.NonCapacityRoute{}, false
+	}
+	return routes[0], true
+}
+
+/*
+ * FilterNonCapacitySailings
+ *
+ * Retrieves non-capacity routes with only the sailings that match a filter.
+ * Non-capacity sailings have no status or fill, so the filter's statuses and
+ * minimum space are ignored.
+ *
+ * @param string routeCode - e.g. "SWBFUL", or empty for every route
+ * @param models.SailingFilter filter
+ *
+ * @return []models.NonCapacityRoute - routes that haven't been scraped are left out
+ */
+func (s *SQLStore) FilterNonCapacitySailings(routeCode string, filter models.SailingFilter) []models.NonCapacityRoute {
+	return s.getNonCapacityRoutes(routeCode, filter)
+}
+
+// getNonCapacityRoutes reads one route, or every route when routeCode is empty
+func (s *SQLStore) getNonCapacityRoutes(routeCode string, filter models.SailingFilter) []models.NonCapacityRoute {
 	var routes []models.NonCapacityRoute
 
-	sqlStatement := `SELECT * FROM non_capacity_routes`
+	for _, info := range s.getRouteInfo("non_capacity_routes", routeCode) {
+		routes = append(routes, models.NonCapacityRoute{
+			RouteCode:        info.routeCode,
+			FromTerminalCode: info.fromTerminalCode,
+			ToTerminalCode:   info.toTerminalCode,
+			SailingDuration:  info.sailingDuration,
+			Sailings:         []models.NonCapacitySailing{},
+			LastUpdated:      info.lastUpdated,
+		})
+	}
+
+	if len(routes) == 0 {
+		return routes
+	}
+
+	byRoute := make(map[string]*models.NonCapacityRoute)
+	for i := range routes {
+		byRoute[routes[i].RouteCode] = &routes[i]
+	}
+
+	sqlStatement := `
+		SELECT s.route_code, s.departure_time, s.arrival_time, COALESCE(v.name, ''), s.vessel_status
+		FROM sailings s
+		LEFT JOIN vessels v ON v.id = s.vessel_id
+		WHERE s.kind = $1 AND ($2 = '' OR s.route_code = $2)`
+
+	filter.Statuses, filter.MinAvailable = nil, 0
+	conditions, args := sailingConditions(filter, []interface{}{models.NonCapacityJob, routeCode})
+	sqlStatement += conditions + `
+		ORDER BY s.route_code, s.position`
 
-	rows, err := Conn.Query(sqlStatement)
+	rows, err := s.db.Query(sqlStatement, args...)
 	if err != nil {
-		log.Printf("GetNonCapacitySailings: query failed: %v", err)
+		log.Printf("getNonCapacityRoutes: query failed: %v", err)
 		return routes
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var route models.NonCapacityRoute
-		var sailings []uint8
+		var routeCode string
+		var sailing models.NonCapacitySailing
 
-		err := rows.Scan(&route.RouteCode, &route.FromTerminalCode, &route.ToTerminalCode, &route.SailingDuration, &sailings)
+		err := rows.Scan(&routeCode, &sailing.DepartureTime, &sailing.ArrivalTime, &sailing.VesselName, &sailing.VesselStatus)
 		if err != nil {
-			log.Printf("GetNonCapacitySailings: row scan failed: %v", err)
+			log.Printf("getNonCapacityRoutes: row scan failed: %v", err)
 			continue
 		}
 
-		var content []models.NonCapacitySailing
-		if err := json.Unmarshal(sailings, &content); err != nil {
-			log.Printf("GetNonCapacitySailings: JSON unmarshal failed: %v", err)
-			continue
+		if route, ok := byRoute[routeCode]; ok && (filter.Limit == 0 || len(route.Sailings) < filter.Limit) {
+			route.Sailings = append(route.Sailings, sailing)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("getNonCapacityRoutes: row iteration error: %v", err)
+	}
+
+	return routes
+}
+
+// allSailings is the filter that keeps every sailing
+var allSailings = models.SailingFilter{After: -1, Before: -1}
+
+/*
+ * sailingConditions
+ *
+ * Builds the conditions on sailings s and vessels v for a filter, numbering
+ * their placeholders after the arguments already bound. Times are compared
+ * with departure_minutes, and tomorrow's sailings are after any time today.
+ *
+ * @param models.SailingFilter filter
+ * @param []interface{} args - the query's arguments so far
+ *
+ * @return string - " AND ..." for each condition, or empty
+ * @return []interface{} - args with the filter's values appended
+ */
+func sailingConditions(filter models.SailingFilter, args []interface{}) (string, []interface{}) {
+	var conditions strings.Builder
+	bind := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = bind(status)
+		}
+		conditions.WriteString(" AND s.sailing_status IN (" + strings.Join(placeholders, ", ") + ")")
+	}
+	// Only sailings yet to leave have space; the rest report a fill of 0
+	if filter.MinAvailable > 0 {
+		conditions.WriteString(" AND s.sailing_status = 'future' AND s.fill <= " + bind(100-filter.MinAvailable))
+	}
+	if filter.After >= 0 {
+		conditions.WriteString(" AND (s.is_tomorrow OR s.departure_minutes >= " + bind(filter.After) + ")")
+	}
+	if filter.Before >= 0 {
+		conditions.WriteString(" AND NOT s.is_tomorrow AND s.departure_minutes <= " + bind(filter.Before))
+	}
+	if filter.Vessel != "" {
+		conditions.WriteString(" AND LOWER(v.name) = LOWER(" + bind(filter.Vessel) + ")")
+	}
+
+	return conditions.String(), args
+}
+
+/*
+ * SaveCapacityRoute
+ *
+ * Inserts or replaces a capacity route and all of its sailings in a single
+ * transaction. The route's LastUpdated is stored as the scrape time, defaulting to now.
+ *
+ * @param models.CapacityRoute route
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveCapacityRoute(route models.CapacityRoute) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveRoute(tx, route.RouteCode, route.FromTerminalCode, route.ToTerminalCode); err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		INSERT INTO capacity_routes (route_code, sailing_duration, scraped_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (route_code) DO UPDATE SET
+			sailing_duration = EXCLUDED.sailing_duration,
+			scraped_at = EXCLUDED.scraped_at`
+	_, err = tx.Exec(sqlStatement, route.RouteCode, route.SailingDuration, dbTime(scrapedAt(route.LastUpdated)))
+	if err != nil {
+		return err
+	}
+
+	sailings := make([]sailingRow, len(route.Sailings))
+	for i, sailing := range route.Sailings {
+		sailings[i] = sailingRow{
+			departureTime:          sailing.DepartureTime,
+			scheduledDepartureTime: sailing.ScheduledDepartureTime,
+			actualDepartureTime:    sailing.ActualDepartureTime,
+			delayMinutes:           sailing.DelayMinutes,
+			arrivalTime:            sailing.ArrivalTime,
+			sailingStatus:          sailing.SailingStatus,
+			fill:                   sailing.Fill,
+			carFill:                sailing.CarFill,
+			oversizeFill:           sailing.OversizeFill,
+			vesselName:             sailing.VesselName,
+			vesselStatus:           sailing.VesselStatus,
+			isTomorrow:             sailing.IsTomorrow,
+		}
+	}
+	if err := replaceSailings(tx, route.RouteCode, models.CapacityJob, sailings); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * SaveNonCapacityRoute
+ *
+ * Inserts or replaces a non-capacity route and all of its sailings in a single
+ * transaction. The route's LastUpdated is stored as the scrape time, defaulting to now.
+ *
+ * @param models.NonCapacityRoute route
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveNonCapacityRoute(route models.NonCapacityRoute) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveRoute(tx, route.RouteCode, route.FromTerminalCode, route.ToTerminalCode); err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		INSERT INTO non_capacity_routes (route_code, sailing_duration, scraped_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (route_code) DO UPDATE SET
+			sailing_duration = EXCLUDED.sailing_duration,
+			scraped_at = EXCLUDED.scraped_at`
+	_, err = tx.Exec(sqlStatement, route.RouteCode, route.SailingDuration, dbTime(scrapedAt(route.LastUpdated)))
+	if err != nil {
+		return err
+	}
+
+	sailings := make([]sailingRow, len(route.Sailings))
+	for i, sailing := range route.Sailings {
+		sailings[i] = sailingRow{
+			departureTime: sailing.DepartureTime,
+			arrivalTime:   sailing.ArrivalTime,
+			vesselName:    sailing.VesselName,
+			vesselStatus:  sailing.VesselStatus,
 		}
+	}
+	if err := replaceSailings(tx, route.RouteCode, models.NonCapacityJob, sailings); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * scrapedAt
+ *
+ * Returns the scrape time to store for a route, defaulting to now when unset.
+ *
+ * @param *time.Time lastUpdated
+ *
+ * @return time.Time
+ */
+func scrapedAt(lastUpdated *time.Time) time.Time {
+	if lastUpdated == nil || lastUpdated.IsZero() {
+		return time.Now()
+	}
+	return *lastUpdated
+}
+
+// routeInfo is a row of capacity_routes or non_capacity_routes joined to routes
+type routeInfo struct {
+	routeCode        string
+	fromTerminalCode string
+	toTerminalCode   string
+	sailingDuration  string
+	lastUpdated      *time.Time
+}
+
+/*
+ * getRouteInfo
+ *
+ * @param string table - "capacity_routes" or "non_capacity_routes"
+ * @param string routeCode - a single route, or "" for all of them
+ *
+ * @return []routeInfo - sorted by route code
+ */
+func (s *SQLStore) getRouteInfo(table string, routeCode string) []routeInfo {
+	var routes []routeInfo
+
+	sqlStatement := `
+		SELECT r.route_code, r.from_terminal_code, r.to_terminal_code, t.sailing_duration, t.scraped_at
+		FROM ` + table + ` t
+		JOIN routes r ON r.route_code = t.route_code
+		WHERE $1 = '' OR r.route_code = $1
+		ORDER BY r.route_code`
 
-		route.Sailings = content
+	rows, err := s.db.Query(sqlStatement, routeCode)
+	if err != nil {
+		log.Printf("getRouteInfo: %s query failed: %v", table, err)
+		return routes
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var route routeInfo
+		var scrapedAt nullTime
+
+		if err := rows.Scan(&route.routeCode, &route.fromTerminalCode, &route.toTerminalCode, &route.sailingDuration, &scrapedAt); err != nil {
+			log.Printf("getRouteInfo: %s row scan failed: %v", table, err)
+			continue
+		}
+		route.lastUpdated = scrapedAt.ptr()
 		routes = append(routes, route)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("GetNonCapacitySailings: row iteration error: %v", err)
+		log.Printf("getRouteInfo: %s row iteration error: %v", table, err)
 	}
 
 	return routes
 }
+
+/*
+ * saveRoute
+ *
+ * Inserts a route and its terminals if they are new, and updates the route's
+ * terminals if they changed.
+ *
+ * @param *sql.Tx tx
+ * @param string routeCode
+ * @param string fromTerminalCode
+ * @param string toTerminalCode
+ *
+ * @return error
+ */
+func saveRoute(tx *sql.Tx, routeCode string, fromTerminalCode string, toTerminalCode string) error {
+	_, err := tx.Exec(`INSERT INTO terminals (code) VALUES ($1), ($2) ON CONFLICT (code) DO NOTHING`, fromTerminalCode, toTerminalCode)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+		INSERT INTO routes (route_code, from_terminal_code, to_terminal_code)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (route_code) DO UPDATE SET
+			from_terminal_code = EXCLUDED.from_terminal_code,
+			to_terminal_code = EXCLUDED.to_terminal_code`
+	_, err = tx.Exec(sqlStatement, routeCode, fromTerminalCode, toTerminalCode)
+	return err
+}
+
+// sailingRow holds the columns of the sailings table shared by both kinds of sailing
+type sailingRow struct {
+	departureTime          string
+	scheduledDepartureTime string
+	actualDepartureTime    string
+	delayMinutes           int
+	arrivalTime            string
+	sailingStatus          string
+	fill                   int
+	carFill                int
+	oversizeFill           int
+	vesselName             string
+	vesselStatus           string
+	isTomorrow             bool
+}
+
+// scheduledTime is the time the sailing was timetabled to leave; non-capacity
+// sailings only have the one time
+func (s sailingRow) scheduledTime() string {
+	if s.scheduledDepartureTime != "" {
+		return s.scheduledDepartureTime
+	}
+	return s.departureTime
+}
+
+/*
+ * replaceSailings
+ *
+ * Replaces every sailing of one kind on a route, keeping them in the given order.
+ *
+ * @param *sql.Tx tx
+ * @param string routeCode
+ * @param string kind - models.CapacityJob or models.NonCapacityJob
+ * @param []sailingRow sailings
+ *
+ * @return error
+ */
+func replaceSailings(tx *sql.Tx, routeCode string, kind string, sailings []sailingRow) error {
+	_, err := tx.Exec(`DELETE FROM sailings WHERE route_code = $1 AND kind = $2`, routeCode, kind)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO sailings (
+			route_code,
+			kind,
+			position,
+			departure_time,
+			departure_minutes,
+			arrival_time,
+			sailing_status,
+			fill,
+			car_fill,
+			oversize_fill,
+			vessel_id,
+			vessel_status,
+			is_tomorrow,
+			scheduled_departure_time,
+			actual_departure_time,
+			delay_minutes
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	vesselIDs := make(map[string]sql.NullInt64)
+	for i, s := range sailings {
+		vesselID, ok := vesselIDs[s.vesselName]
+		if !ok {
+			if vesselID, err = saveVessel(tx, s.vesselName); err != nil {
+				return err
+			}
+			vesselIDs[s.vesselName] = vesselID
+		}
+
+		_, err := stmt.Exec(routeCode, kind, i+1, s.departureTime, departureMinutes(s.scheduledTime()), s.arrivalTime, s.sailingStatus, s.fill, s.carFill, s.oversizeFill, vesselID, s.vesselStatus, s.isTomorrow, s.scheduledDepartureTime, s.actualDepartureTime, s.delayMinutes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * saveVessel
+ *
+ * Returns the id of the named vessel, adding it if it is new.
+ *
+ * @param *sql.Tx tx
+ * @param string name
+ *
+ * @return sql.NullInt64 - null when name is empty
+ * @return error
+ */
+func saveVessel(tx *sql.Tx, name string) (sql.NullInt64, error) {
+	var id sql.NullInt64
+	if name == "" {
+		return id, nil
+	}
+
+	sqlStatement := `
+		INSERT INTO vessels (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id`
+	err := tx.QueryRow(sqlStatement, name).Scan(&id)
+	return id, err
+}
+
+/*
+ * departureMinutes
+ *
+ * Converts a scraped time such as "7:05 pm" to minutes after midnight, so
+ * sailings can be sorted and filtered by time in SQL.
+ *
+ * @param string departureTime
+ *
+ * @return sql.NullInt64 - null if the time can't be parsed
+ */
+func departureMinutes(departureTime string) sql.NullInt64 {
+	minutes, ok := sailingtime.ClockMinutes(departureTime)
+	if !ok {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(minutes), Valid: true}
+}
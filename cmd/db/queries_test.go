@@ -0,0 +1,25 @@
+package db
+
+import "testing"
+
+func TestDepartureMinutes(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  int64
+		valid bool
+	}{
+		{"12:05 am", 5, true},
+		{"7:00 am", 420, true},
+		{"12:00 pm", 720, true},
+		{"10:45 PM", 1365, true},
+		{"", 0, false},
+		{"Departed", 0, false},
+	}
+
+	for _, tt := range tests {
+		got := departureMinutes(tt.in)
+		if got.Valid != tt.valid || got.Int64 != tt.want {
+			t.Errorf("departureMinutes(%q) = %v, want %d (valid %v)", tt.in, got, tt.want, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"log"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+/*
+ * SaveScrapeRun
+ *
+ * Records a finished scrape run and the outcome for each of its routes in a
+ * single transaction. Sets run.ID on success.
+ *
+ * @param *models.ScrapeRun run
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveScrapeRun(run *models.ScrapeRun) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlStatement := `
+		INSERT INTO scrape_runs (job, started_at, finished_at, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+	err = tx.QueryRow(sqlStatement, run.Job, dbTime(run.StartedAt), dbTime(run.FinishedAt), run.Status).Scan(&run.ID)
+	if err != nil {
+		return err
+	}
+
+	routeStatement := `
+		INSERT INTO scrape_run_routes (
+			run_id,
+			route_code,
+			outcome,
+			http_status,
+			error,
+			warning_count,
+			sailing_count,
+			scraped_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (run_id, route_code) DO NOTHING`
+	for _, route := range run.Routes {
+		_, err := tx.Exec(routeStatement, run.ID, route.RouteCode, route.Outcome, route.HTTPStatus, route.Error, route.WarningCount, route.SailingCount, dbTime(route.ScrapedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * GetLatestScrapeRuns
+ *
+ * Retrieves the most recent run of each scrape job, including its route outcomes.
+ *
+ * @return map[string]models.ScrapeRun - runs keyed by job name
+ */
+func (s *SQLStore) GetLatestScrapeRuns() map[string]models.ScrapeRun {
+	runs := make(map[string]models.ScrapeRun)
+
+	sqlStatement := `
+		SELECT id, job, started_at, finished_at, status
+		FROM scrape_runs r
+		WHERE started_at = (SELECT MAX(started_at) FROM scrape_runs WHERE job = r.job)
+		ORDER BY id`
+
+	rows, err := s.db.Query(sqlStatement)
+	if err != nil {
+		log.Printf("GetLatestScrapeRuns: query failed: %v", err)
+		return runs
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var run models.ScrapeRun
+		if err := rows.Scan(&run.ID, &run.Job, &run.StartedAt, &run.FinishedAt, &run.Status); err != nil {
+			log.Printf("GetLatestScrapeRuns: row scan failed: %v", err)
+			continue
+		}
+		runs[run.Job] = run
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetLatestScrapeRuns: row iteration error: %v", err)
+	}
+
+	for job, run := range runs {
+		run.Routes = s.getScrapeRunRoutes(run.ID)
+		runs[job] = run
+	}
+
+	return runs
+}
+
+/*
+ * GetRouteScrapeStatuses
+ *
+ * Retrieves the latest scrape attempt for every route of every job, along with
+ * the time the route was last scraped successfully.
+ *
+ * @return []models.RouteScrapeStatus
+ */
+func (s *SQLStore) GetRouteScrapeStatuses() []models.RouteScrapeStatus {
+	var statuses []models.RouteScrapeStatus
+
+	sqlStatement := `
+		SELECT
+			r.job,
+			rr.route_code,
+			rr.outcome,
+			rr.http_status,
+			rr.error,
+			rr.warning_count,
+			rr.sailing_count,
+			rr.scraped_at,
+			(
+				SELECT MAX(ok.scraped_at)
+				FROM scrape_run_routes ok
+				JOIN scrape_runs okr ON okr.id = ok.run_id
+				WHERE okr.job = r.job AND ok.route_code = rr.route_code AND ok.outcome = $1
+			)
+		FROM scrape_run_routes rr
+		JOIN scrape_runs r ON r.id = rr.run_id
+		WHERE rr.run_id = (
+			SELECT latest.run_id
+			FROM scrape_run_routes latest
+			JOIN scrape_runs latestr ON latestr.id = latest.run_id
+			WHERE latestr.job = r.job AND latest.route_code = rr.route_code
+			ORDER BY latest.scraped_at DESC, latest.run_id DESC
+			LIMIT 1
+		)
+		ORDER BY r.job, rr.route_code`
+
+	rows, err := s.db.Query(sqlStatement, models.OutcomeOK)
+	if err != nil {
+		log.Printf("GetRouteScrapeStatuses: query failed: %v", err)
+		return statuses
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status models.RouteScrapeStatus
+		var lastSuccessAt nullTime
+		attempt := &status.LastAttempt
+
+		err := rows.Scan(&status.Job, &attempt.RouteCode, &attempt.Outcome, &attempt.HTTPStatus, &attempt.Error, &attempt.WarningCount, &attempt.SailingCount, &attempt.ScrapedAt, &lastSuccessAt)
+		if err != nil {
+			log.Printf("GetRouteScrapeStatuses: row scan failed: %v", err)
+			continue
+		}
+		status.LastSuccessAt = lastSuccessAt.ptr()
+
+		statuses = append(statuses, status)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetRouteScrapeStatuses: row iteration error: %v", err)
+	}
+
+	return statuses
+}
+
+/*
+ * PruneScrapeRuns
+ *
+ * Deletes scrape runs, and their route outcomes, that started before cutoff.
+ *
+ * @param time.Time cutoff
+ *
+ * @return int64 - number of runs deleted
+ * @return error
+ */
+func (s *SQLStore) PruneScrapeRuns(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM scrape_runs WHERE started_at < $1`, dbTime(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLStore) getScrapeRunRoutes(runID int64) []models.RouteScrapeResult {
+	var routes []models.RouteScrapeResult
+
+	sqlStatement := `
+		SELECT route_code, outcome, http_status, error, warning_count, sailing_count, scraped_at
+		FROM scrape_run_routes
+		WHERE run_id = $1
+		ORDER BY route_code`
+
+	rows, err := s.db.Query(sqlStatement, runID)
+	if err != nil {
+		log.Printf("getScrapeRunRoutes: query failed: %v", err)
+		return routes
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var route models.RouteScrapeResult
+		if err := rows.Scan(&route.RouteCode, &route.Outcome, &route.HTTPStatus, &route.Error, &route.WarningCount, &route.SailingCount, &route.ScrapedAt); err != nil {
+			log.Printf("getScrapeRunRoutes: row scan failed: %v", err)
+			continue
+		}
+		routes = append(routes, route)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("getScrapeRunRoutes: row iteration error: %v", err)
+	}
+
+	return routes
+}
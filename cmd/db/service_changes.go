@@ -0,0 +1,112 @@
+package db
+
+import (
+	"log"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+/*
+ * SaveServiceChanges
+ *
+ * Appends detected service changes in a single transaction, setting their IDs.
+ *
+ * @param []models.ServiceChange changes
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveServiceChanges(changes []models.ServiceChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO service_changes (route_code, kind, sailing_date, departure_time, previous, current, summary, detected_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := range changes {
+		c := &changes[i]
+		err := stmt.QueryRow(c.RouteCode, c.Kind, c.SailingDate, c.DepartureTime, c.Previous, c.Current, c.Summary, dbTime(c.DetectedAt)).Scan(&c.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * GetServiceChanges
+ *
+ * @param string routeCode - limits results to one route, or "" for all
+ * @param int limit - maximum number of changes to return
+ *
+ * @return []models.ServiceChange - newest first
+ */
+func (s *SQLStore) GetServiceChanges(routeCode string, limit int) []models.ServiceChange {
+	changes := []models.ServiceChange{}
+
+	sqlStatement := `
+		SELECT id, route_code, kind, ` + s.dialect.sailingDate + `, departure_time, previous, current, summary, detected_at
+		FROM service_changes
+		WHERE $1 = '' OR route_code = $1
+		ORDER BY detected_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := s.db.Query(sqlStatement, routeCode, limit)
+	if err != nil {
+		log.Printf("GetServiceChanges: query failed: %v", err)
+		return changes
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.ServiceChange
+		var detectedAt nullTime
+
+		err := rows.Scan(&c.ID, &c.RouteCode, &c.Kind, &c.SailingDate, &c.DepartureTime, &c.Previous, &c.Current, &c.Summary, &detectedAt)
+		if err != nil {
+			log.Printf("GetServiceChanges: row scan failed: %v", err)
+			continue
+		}
+		c.DetectedAt = detectedAt.Time
+
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetServiceChanges: row iteration error: %v", err)
+	}
+
+	return changes
+}
+
+/*
+ * PruneServiceChanges
+ *
+ * Deletes service changes detected before cutoff.
+ *
+ * @param time.Time cutoff
+ *
+ * @return int64 - number of changes deleted
+ * @return error
+ */
+func (s *SQLStore) PruneServiceChanges(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM service_changes WHERE detected_at < $1`, dbTime(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
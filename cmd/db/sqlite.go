@@ -0,0 +1,46 @@
+package db
+
+import (
+	"database/sql"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+var sqliteDialect = &dialect{
+	name:          DriverSQLite,
+	migrations:    "migrations/sqlite",
+	timestampType: "TIMESTAMP",
+	sailingDate:   "sailing_date",
+	timeBucket: func(column string, interval string) string {
+		return "CAST(strftime('%s', " + column + ") AS INTEGER) / " + interval
+	},
+}
+
+/*
+ * OpenSQLite
+ *
+ * Opens the SQLite database file at path, creating it if needed. A path of
+ * ":memory:" gives a private in-memory database.
+ *
+ * SQLite allows one writer at a time, so the store uses a single connection.
+ *
+ * @param string path
+ *
+ * @return *SQLStore
+ * @return error
+ */
+func OpenSQLite(path string) (*SQLStore, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_time_format", "sqlite")
+
+	conn, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1)
+
+	return &SQLStore{db: conn, dialect: sqliteDialect}, nil
+}
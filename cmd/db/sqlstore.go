@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLStore is a Store backed by a database/sql connection. Queries are written
+// to run on both Postgres and SQLite; the few differences live in its dialect.
+type SQLStore struct {
+	db      *sql.DB
+	dialect *dialect
+}
+
+type dialect struct {
+	name          string
+	migrations    string // directory of migrationFiles holding this dialect's migrations
+	timestampType string // column type for times
+
+	// Statement run at the start of every migration transaction, if any
+	migrationLock string
+
+	// SQL expression for a sailing_date column as YYYY-MM-DD
+	sailingDate string
+
+	// Returns a SQL expression numbering the interval-sized bucket column falls in,
+	// where interval is the given query parameter in seconds
+	timeBucket func(column string, interval string) string
+}
+
+/*
+ * DB
+ *
+ * Returns the underlying connection pool.
+ *
+ * @return *sql.DB
+ */
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+/*
+ * Close
+ *
+ * @return error
+ */
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// dbTime converts a time to UTC before binding it. SQLite stores times as text,
+// which only compares correctly when every value has the same offset.
+func dbTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// nullTime scans a nullable time that SQLite may return as text, e.g. from an
+// aggregate, where the driver can't tell it is a time.
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (n *nullTime) Scan(value any) error {
+	n.Time, n.Valid = time.Time{}, false
+
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		n.Time, n.Valid = v, true
+		return nil
+	case []byte:
+		value = string(v)
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("can't scan %T into a time", value)
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			n.Time, n.Valid = t, true
+			return nil
+		}
+	}
+	return fmt.Errorf("can't parse %q as a time", text)
+}
+
+// ptr returns a pointer to the time, or nil if it is null
+func (n nullTime) ptr() *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := n.Time
+	return &t
+}
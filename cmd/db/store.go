@@ -0,0 +1,331 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/config"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+// Store is everything the API keeps between scrapes: the latest routes and
+// sailings, the scrape run log, capacity history, departure records,
+// cancellations, detected service changes and webhook subscriptions.
+type Store interface {
+	// Routes
+	GetCapacitySailings() []models.CapacityRoute
+	GetNonCapacitySailings() []models.NonCapacityRoute
+	GetCapacityRoute(routeCode string) (models.CapacityRoute, bool)
+	GetNonCapacityRoute(routeCode string) (models.NonCapacityRoute, bool)
+	FilterCapacitySailings(routeCode string, filter models.SailingFilter) []models.CapacityRoute
+	FilterNonCapacitySailings(routeCode string, filter models.SailingFilter) []models.NonCapacityRoute
+	SaveCapacityRoute(route models.CapacityRoute) error
+	SaveNonCapacityRoute(route models.NonCapacityRoute) error
+
+	// Scrape runs
+	SaveScrapeRun(run *models.ScrapeRun) error
+	GetLatestScrapeRuns() map[string]models.ScrapeRun
+	GetRouteScrapeStatuses() []models.RouteScrapeStatus
+	PruneScrapeRuns(cutoff time.Time) (int64, error)
+
+	// Capacity history
+	SaveCapacityObservations(observations []models.CapacityObservation) error
+	GetSailingHistory(routeCode string, sailingDate string, departureTime string) models.SailingHistory
+	GetCapacityObservationsSince(routeCode string, since time.Time) []models.CapacityObservation
+	DownsampleCapacityObservations(cutoff time.Time, interval time.Duration) (int64, error)
+	PruneCapacityObservations(cutoff time.Time) (int64, error)
+
+	// Departure records
+	SaveDepartureRecords(records []models.DepartureRecord) error
+	GetDepartureRecords(from string, to string) []models.DepartureRecord
+	PruneDepartureRecords(cutoff time.Time) (int64, error)
+
+	// Cancellations
+	SaveCancellationEvents(events []models.CancellationEvent) error
+	GetCancellations(from string, to string, routeCode string) []models.CancellationEvent
+	PruneCancellationEvents(cutoff time.Time) (int64, error)
+
+	// Service changes
+	SaveServiceChanges(changes []models.ServiceChange) error
+	GetServiceChanges(routeCode string, limit int) []models.ServiceChange
+	PruneServiceChanges(cutoff time.Time) (int64, error)
+
+	// Webhook subscriptions
+	SaveSubscription(subscription *models.Subscription) error
+	GetSubscription(id int64) (models.Subscription, bool)
+	GetSubscriptions() []models.Subscription
+	DeleteSubscription(id int64) (bool, error)
+	SaveDeadLetter(letter *models.DeadLetter) error
+	GetDeadLetters(subscriptionID int64, limit int) []models.DeadLetter
+	PruneDeadLetters(cutoff time.Time) (int64, error)
+
+	Close() error
+}
+
+// Migrator is implemented by stores with a versioned schema.
+type Migrator interface {
+	MigrateUp() ([]Migration, error)
+	MigrateDown(steps int) ([]Migration, error)
+	MigrationStatus() ([]MigrationStatus, error)
+}
+
+// Storage backends, selected with DB_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// ErrNoMigrations is returned by the migrate functions for stores without a schema.
+var ErrNoMigrations = errors.New("store has no schema migrations")
+
+var store Store
+
+/*
+ * Init
+ *
+ * Opens the store selected by config.DB.Driver and brings its schema up to
+ * date by applying any pending migrations.
+ *
+ * Panics if the store cannot be opened, a migration fails, or the schema is
+ * newer than this build supports.
+ *
+ * @return void
+ */
+func Init() {
+	Open()
+
+	applied, err := MigrateUp()
+	if err != nil && !errors.Is(err, ErrNoMigrations) {
+		panic(err)
+	}
+	for _, m := range applied {
+		log.Printf("db: applied migration %d_%s", m.Version, m.Name)
+	}
+}
+
+/*
+ * Open
+ *
+ * Opens the store selected by config.DB.Driver without touching its schema.
+ * Panics if it cannot be opened.
+ *
+ * @return void
+ */
+func Open() {
+	var err error
+
+	switch config.DB.Driver {
+	case "", DriverPostgres:
+		store, err = OpenPostgres(config.DB.URL)
+	case DriverSQLite:
+		store, err = OpenSQLite(config.DB.Path)
+	case DriverMemory:
+		store = NewMemoryStore()
+	default:
+		err = fmt.Errorf("unknown DB_DRIVER %q", config.DB.Driver)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+/*
+ * SetStore
+ *
+ * Replaces the store used by the package-level functions, e.g. with a
+ * MemoryStore in tests.
+ *
+ * @param Store s
+ *
+ * @return void
+ */
+func SetStore(s Store) {
+	store = s
+}
+
+/*
+ * Close
+ *
+ * Closes the current store.
+ *
+ * @return error
+ */
+func Close() error {
+	if store == nil {
+		return nil
+	}
+	return store.Close()
+}
+
+/*
+ * MigrateUp, MigrateDown, GetMigrationStatus
+ *
+ * Manage the current store's schema. They return ErrNoMigrations for stores,
+ * like MemoryStore, that don't have one.
+ */
+
+func MigrateUp() ([]Migration, error) {
+	migrator, ok := store.(Migrator)
+	if !ok {
+		return nil, ErrNoMigrations
+	}
+	return migrator.MigrateUp()
+}
+
+func MigrateDown(steps int) ([]Migration, error) {
+	migrator, ok := store.(Migrator)
+	if !ok {
+		return nil, ErrNoMigrations
+	}
+	return migrator.MigrateDown(steps)
+}
+
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	migrator, ok := store.(Migrator)
+	if !ok {
+		return nil, ErrNoMigrations
+	}
+	return migrator.MigrationStatus()
+}
+
+/********************/
+/* Store Shorthands */
+/********************/
+
+// The functions below call the same method on the current store.
+
+func GetCapacitySailings() []models.CapacityRoute {
+	return store.GetCapacitySailings()
+}
+
+func GetNonCapacitySailings() []models.NonCapacityRoute {
+	return store.GetNonCapacitySailings()
+}
+
+func GetCapacityRoute(routeCode string) (models.CapacityRoute, bool) {
+	return store.GetCapacityRoute(routeCode)
+}
+
+func GetNonCapacityRoute(routeCode string) (models.NonCapacityRoute, bool) {
+	return store.GetNonCapacityRoute(routeCode)
+}
+
+func FilterCapacitySailings(routeCode string, filter models.SailingFilter) []models.CapacityRoute {
+	return store.FilterCapacitySailings(routeCode, filter)
+}
+
+func FilterNonCapacitySailings(routeCode string, filter models.SailingFilter) []models.NonCapacityRoute {
+	return store.FilterNonCapacitySailings(routeCode, filter)
+}
+
+func SaveCapacityRoute(route models.CapacityRoute) error {
+	return store.SaveCapacityRoute(route)
+}
+
+func SaveNonCapacityRoute(route models.NonCapacityRoute) error {
+	return store.SaveNonCapacityRoute(route)
+}
+
+func SaveScrapeRun(run *models.ScrapeRun) error {
+	return store.SaveScrapeRun(run)
+}
+
+func GetLatestScrapeRuns() map[string]models.ScrapeRun {
+	return store.GetLatestScrapeRuns()
+}
+
+func GetRouteScrapeStatuses() []models.RouteScrapeStatus {
+	return store.GetRouteScrapeStatuses()
+}
+
+func PruneScrapeRuns(cutoff time.Time) (int64, error) {
+	return store.PruneScrapeRuns(cutoff)
+}
+
+func SaveCapacityObservations(observations []models.CapacityObservation) error {
+	return store.SaveCapacityObservations(observations)
+}
+
+func GetSailingHistory(routeCode string, sailingDate string, departureTime string) models.SailingHistory {
+	return store.GetSailingHistory(routeCode, sailingDate, departureTime)
+}
+
+func GetCapacityObservationsSince(routeCode string, since time.Time) []models.CapacityObservation {
+	return store.GetCapacityObservationsSince(routeCode, since)
+}
+
+func DownsampleCapacityObservations(cutoff time.Time, interval time.Duration) (int64, error) {
+	return store.DownsampleCapacityObservations(cutoff, interval)
+}
+
+func PruneCapacityObservations(cutoff time.Time) (int64, error) {
+	return store.PruneCapacityObservations(cutoff)
+}
+
+func SaveDepartureRecords(records []models.DepartureRecord) error {
+	return store.SaveDepartureRecords(records)
+}
+
+func GetDepartureRecords(from string, to string) []models.DepartureRecord {
+	return store.GetDepartureRecords(from, to)
+}
+
+func PruneDepartureRecords(cutoff time.Time) (int64, error) {
+	return store.PruneDepartureRecords(cutoff)
+}
+
+func SaveCancellationEvents(events []models.CancellationEvent) error {
+	return store.SaveCancellationEvents(events)
+}
+
+func GetCancellations(from string, to string, routeCode string) []models.CancellationEvent {
+	return store.GetCancellations(from, to, routeCode)
+}
+
+func PruneCancellationEvents(cutoff time.Time) (int64, error) {
+	return store.PruneCancellationEvents(cutoff)
+}
+
+func SaveServiceChanges(changes []models.ServiceChange) error {
+	return store.SaveServiceChanges(changes)
+}
+
+func GetServiceChanges(routeCode string, limit int) []models.ServiceChange {
+	return store.GetServiceChanges(routeCode, limit)
+}
+
+func PruneServiceChanges(cutoff time.Time) (int64, error) {
+	return store.PruneServiceChanges(cutoff)
+}
+
+func SaveSubscription(subscription *models.Subscription) error {
+	return store.SaveSubscription(subscription)
+}
+
+func GetSubscription(id int64) (models.Subscription, bool) {
+	return store.GetSubscription(id)
+}
+
+func GetSubscriptions() []models.Subscription {
+	return store.GetSubscriptions()
+}
+
+func DeleteSubscription(id int64) (bool, error) {
+	return store.DeleteSubscription(id)
+}
+
+func SaveDeadLetter(letter *models.DeadLetter) error {
+	return store.SaveDeadLetter(letter)
+}
+
+func GetDeadLetters(subscriptionID int64, limit int) []models.DeadLetter {
+	return store.GetDeadLetters(subscriptionID, limit)
+}
+
+func PruneDeadLetters(cutoff time.Time) (int64, error) {
+	return store.PruneDeadLetters(cutoff)
+}
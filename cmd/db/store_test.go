@@ -0,0 +1,443 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+// testStores returns a fresh instance of every backend that can run without a server
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	sqlite, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlite.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+
+	return map[string]Store{
+		DriverMemory: NewMemoryStore(),
+		DriverSQLite: sqlite,
+	}
+}
+
+func TestStore_Routes(t *testing.T) {
+	scrapedAt := time.Date(2024, 6, 1, 19, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			capacity := models.CapacityRoute{
+				RouteCode:        "TSASWB",
+				FromTerminalCode: "TSA",
+				ToTerminalCode:   "SWB",
+				SailingDuration:  "1h 35m",
+				LastUpdated:      &scrapedAt,
+				Sailings: []models.CapacitySailing{
+					{DepartureTime: "11:00 am", ScheduledDepartureTime: "10:55 am", ActualDepartureTime: "11:00 am", DelayMinutes: 5, SailingStatus: "current", IsTomorrow: true, Fill: 100, CarFill: 100, OversizeFill: 90, VesselName: "Spirit of British Columbia"},
+					{DepartureTime: "1:00 pm", SailingStatus: "cancelled"},
+				},
+			}
+			if err := s.SaveCapacityRoute(capacity); err != nil {
+				t.Fatal(err)
+			}
+
+			// Saving again replaces the sailings
+			capacity.Sailings = capacity.Sailings[:1]
+			if err := s.SaveCapacityRoute(capacity); err != nil {
+				t.Fatal(err)
+			}
+
+			nonCapacity := models.NonCapacityRoute{
+				RouteCode:        "SWBFUL",
+				FromTerminalCode: "SWB",
+				ToTerminalCode:   "FUL",
+				SailingDuration:  "35m",
+				LastUpdated:      &scrapedAt,
+				Sailings:         []models.NonCapacitySailing{{DepartureTime: "7:00 am", ArrivalTime: "7:35 am"}},
+			}
+			if err := s.SaveNonCapacityRoute(nonCapacity); err != nil {
+				t.Fatal(err)
+			}
+
+			routes := s.GetCapacitySailings()
+			if len(routes) != 1 {
+				t.Fatalf("got %d capacity routes, want 1", len(routes))
+			}
+			got := routes[0]
+			if got.RouteCode != "TSASWB" || got.FromTerminalCode != "TSA" || got.ToTerminalCode != "SWB" || got.SailingDuration != "1h 35m" {
+				t.Errorf("route = %+v", got)
+			}
+			if got.LastUpdated == nil || !got.LastUpdated.Equal(scrapedAt) {
+				t.Errorf("LastUpdated = %v, want %v", got.LastUpdated, scrapedAt)
+			}
+			if len(got.Sailings) != 1 || got.Sailings[0] != capacity.Sailings[0] {
+				t.Errorf("sailings = %+v, want %+v", got.Sailings, capacity.Sailings)
+			}
+
+			if route, ok := s.GetCapacityRoute("TSASWB"); !ok || len(route.Sailings) != 1 {
+				t.Errorf("GetCapacityRoute(TSASWB) = %+v, %v", route, ok)
+			}
+			if _, ok := s.GetCapacityRoute("SWBFUL"); ok {
+				t.Error("GetCapacityRoute found a non-capacity route")
+			}
+
+			nonCapacityRoutes := s.GetNonCapacitySailings()
+			if len(nonCapacityRoutes) != 1 || len(nonCapacityRoutes[0].Sailings) != 1 || nonCapacityRoutes[0].Sailings[0] != nonCapacity.Sailings[0] {
+				t.Errorf("non-capacity routes = %+v", nonCapacityRoutes)
+			}
+		})
+	}
+}
+
+func TestStore_FilterSailings(t *testing.T) {
+	scrapedAt := time.Date(2024, 6, 1, 19, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			capacity := models.CapacityRoute{
+				RouteCode:   "TSASWB",
+				LastUpdated: &scrapedAt,
+				Sailings: []models.CapacitySailing{
+					{DepartureTime: "7:10 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "past", Fill: 100},
+					{DepartureTime: "1:00 pm", ScheduledDepartureTime: "1:00 pm", SailingStatus: "future", Fill: 90, VesselName: "Coastal Celebration"},
+					{DepartureTime: "3:00 pm", ScheduledDepartureTime: "3:00 pm", SailingStatus: "cancelled"},
+					{DepartureTime: "5:00 pm", ScheduledDepartureTime: "5:00 pm", SailingStatus: "future", Fill: 40, VesselName: "Spirit of British Columbia"},
+					{DepartureTime: "7:00 pm", ScheduledDepartureTime: "7:00 pm", SailingStatus: "future", Fill: 10, VesselName: "Spirit of British Columbia"},
+					{DepartureTime: "6:00 am", ScheduledDepartureTime: "6:00 am", SailingStatus: "future", IsTomorrow: true},
+				},
+			}
+			if err := s.SaveCapacityRoute(capacity); err != nil {
+				t.Fatal(err)
+			}
+			nonCapacity := models.NonCapacityRoute{
+				RouteCode:   "SWBFUL",
+				LastUpdated: &scrapedAt,
+				Sailings: []models.NonCapacitySailing{
+					{DepartureTime: "7:00 am", VesselName: "Queen of Cumberland"},
+					{DepartureTime: "4:00 pm", VesselName: "Queen of Cumberland"},
+				},
+			}
+			if err := s.SaveNonCapacityRoute(nonCapacity); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				filter      models.SailingFilter
+				capacity    []string
+				nonCapacity []string
+			}{
+				{allSailings, []string{"7:10 am", "1:00 pm", "3:00 pm", "5:00 pm", "7:00 pm", "6:00 am"}, []string{"7:00 am", "4:00 pm"}},
+				{models.SailingFilter{Statuses: []string{"future", "cancelled"}, After: -1, Before: -1}, []string{"1:00 pm", "3:00 pm", "5:00 pm", "7:00 pm", "6:00 am"}, []string{"7:00 am", "4:00 pm"}},
+				{models.SailingFilter{After: 780, Before: 1020}, []string{"1:00 pm", "3:00 pm", "5:00 pm"}, []string{"4:00 pm"}},
+				{models.SailingFilter{After: 1200, Before: -1}, []string{"6:00 am"}, nil},
+				{models.SailingFilter{After: -1, Before: 420}, []string{"7:10 am"}, []string{"7:00 am"}},
+				{models.SailingFilter{After: -1, Before: -1, Vessel: "spirit of british columbia"}, []string{"5:00 pm", "7:00 pm"}, nil},
+				{models.SailingFilter{Statuses: []string{"future"}, After: -1, Before: -1, MinAvailable: 20, Limit: 1}, []string{"5:00 pm"}, []string{"7:00 am"}},
+				{models.SailingFilter{After: -1, Before: -1, MinAvailable: 20}, []string{"5:00 pm", "7:00 pm", "6:00 am"}, []string{"7:00 am", "4:00 pm"}},
+			}
+
+			for _, tt := range tests {
+				routes := s.FilterCapacitySailings("TSASWB", tt.filter)
+				if len(routes) != 1 {
+					t.Fatalf("%+v: got %d capacity routes, want 1", tt.filter, len(routes))
+				}
+				var got []string
+				for _, sailing := range routes[0].Sailings {
+					got = append(got, sailing.DepartureTime)
+				}
+				if !reflect.DeepEqual(got, tt.capacity) {
+					t.Errorf("%+v: capacity sailings %v, want %v", tt.filter, got, tt.capacity)
+				}
+
+				nonCapacityRoutes := s.FilterNonCapacitySailings("", tt.filter)
+				if len(nonCapacityRoutes) != 1 {
+					t.Fatalf("%+v: got %d non-capacity routes, want 1", tt.filter, len(nonCapacityRoutes))
+				}
+				got = nil
+				for _, sailing := range nonCapacityRoutes[0].Sailings {
+					got = append(got, sailing.DepartureTime)
+				}
+				if !reflect.DeepEqual(got, tt.nonCapacity) {
+					t.Errorf("%+v: non-capacity sailings %v, want %v", tt.filter, got, tt.nonCapacity)
+				}
+			}
+
+			if routes := s.FilterCapacitySailings("SWBFUL", allSailings); len(routes) != 0 {
+				t.Errorf("FilterCapacitySailings(SWBFUL) = %+v, want none", routes)
+			}
+		})
+	}
+}
+
+func TestStore_ScrapeRuns(t *testing.T) {
+	start := time.Date(2024, 6, 1, 19, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			runs := []models.ScrapeRun{
+				{Job: models.CapacityJob, StartedAt: start, FinishedAt: start.Add(time.Second), Status: models.RunSucceeded, Routes: []models.RouteScrapeResult{
+					{RouteCode: "TSASWB", Outcome: models.OutcomeOK, ScrapedAt: start},
+				}},
+				{Job: models.CapacityJob, StartedAt: start.Add(time.Minute), FinishedAt: start.Add(time.Minute + time.Second), Status: models.RunFailed, Routes: []models.RouteScrapeResult{
+					{RouteCode: "TSASWB", Outcome: models.OutcomeFetchFailed, HTTPStatus: 503, Error: "unavailable", ScrapedAt: start.Add(time.Minute)},
+				}},
+			}
+			for i := range runs {
+				if err := s.SaveScrapeRun(&runs[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if runs[0].ID == 0 || runs[0].ID == runs[1].ID {
+				t.Errorf("run IDs = %d, %d", runs[0].ID, runs[1].ID)
+			}
+
+			latest := s.GetLatestScrapeRuns()[models.CapacityJob]
+			if latest.ID != runs[1].ID || latest.Status != models.RunFailed || len(latest.Routes) != 1 || latest.Routes[0].HTTPStatus != 503 {
+				t.Errorf("latest run = %+v", latest)
+			}
+
+			statuses := s.GetRouteScrapeStatuses()
+			if len(statuses) != 1 {
+				t.Fatalf("got %d route statuses, want 1", len(statuses))
+			}
+			if statuses[0].LastAttempt.Outcome != models.OutcomeFetchFailed || statuses[0].LastSuccessAt == nil || !statuses[0].LastSuccessAt.Equal(start) {
+				t.Errorf("route status = %+v", statuses[0])
+			}
+
+			deleted, err := s.PruneScrapeRuns(start.Add(30 * time.Second))
+			if err != nil || deleted != 1 {
+				t.Errorf("PruneScrapeRuns = %d, %v; want 1", deleted, err)
+			}
+		})
+	}
+}
+
+func TestStore_CapacityHistory(t *testing.T) {
+	base := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var observations []models.CapacityObservation
+			for minute := 0; minute < 30; minute += 5 {
+				observations = append(observations, models.CapacityObservation{
+					RouteCode:     "TSASWB",
+					SailingDate:   "2024-06-01",
+					DepartureTime: "3:00 pm",
+					ObservedAt:    base.Add(time.Duration(minute) * time.Minute),
+					SailingStatus: "future",
+					Fill:          40 + minute,
+				})
+			}
+			if err := s.SaveCapacityObservations(observations); err != nil {
+				t.Fatal(err)
+			}
+			// Saving the same observations again is a no-op
+			if err := s.SaveCapacityObservations(observations[:1]); err != nil {
+				t.Fatal(err)
+			}
+
+			history := s.GetSailingHistory("TSASWB", "2024-06-01", "3:00 pm")
+			if len(history.Observations) != 6 || history.Observations[0].Fill != 40 || history.Observations[5].Fill != 65 {
+				t.Fatalf("history = %+v", history)
+			}
+
+			since := s.GetCapacityObservationsSince("TSASWB", base.Add(20*time.Minute))
+			if len(since) != 2 || since[0].SailingDate != "2024-06-01" || !since[0].ObservedAt.Equal(base.Add(20*time.Minute)) {
+				t.Errorf("observations since = %+v", since)
+			}
+
+			// Two 15 minute buckets, keeping the last observation of each
+			deleted, err := s.DownsampleCapacityObservations(base.Add(time.Hour), 15*time.Minute)
+			if err != nil || deleted != 4 {
+				t.Fatalf("DownsampleCapacityObservations = %d, %v; want 4", deleted, err)
+			}
+			history = s.GetSailingHistory("TSASWB", "2024-06-01", "3:00 pm")
+			if len(history.Observations) != 2 || history.Observations[0].Fill != 50 || history.Observations[1].Fill != 65 {
+				t.Errorf("downsampled history = %+v", history.Observations)
+			}
+
+			deleted, err = s.PruneCapacityObservations(base.Add(20 * time.Minute))
+			if err != nil || deleted != 1 {
+				t.Errorf("PruneCapacityObservations = %d, %v; want 1", deleted, err)
+			}
+		})
+	}
+}
+
+func TestStore_DepartureRecords(t *testing.T) {
+	recordedAt := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			underway := models.DepartureRecord{
+				RouteCode:              "TSASWB",
+				SailingDate:            "2024-06-01",
+				ScheduledDepartureTime: "9:00 am",
+				Outcome:                models.DepartureDeparted,
+				ActualDepartureTime:    "9:12 am",
+				DelayMinutes:           12,
+				VesselName:             "Coastal Renaissance",
+				RecordedAt:             recordedAt,
+			}
+			records := []models.DepartureRecord{
+				underway,
+				{RouteCode: "TSASWB", SailingDate: "2024-05-01", ScheduledDepartureTime: "9:00 am", Outcome: models.DepartureCancelled, RecordedAt: recordedAt.AddDate(0, -1, 0)},
+			}
+			if err := s.SaveDepartureRecords(records); err != nil {
+				t.Fatal(err)
+			}
+
+			// A later scrape sees it arrive
+			arrived := underway
+			arrived.ArrivalTime = "10:47 am"
+			arrived.RecordedAt = recordedAt.Add(time.Hour)
+			if err := s.SaveDepartureRecords([]models.DepartureRecord{arrived}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.GetDepartureRecords("2024-06-01", "2024-06-07")
+			if len(got) != 1 || got[0].ArrivalTime != "10:47 am" || got[0].DelayMinutes != 12 || !got[0].RecordedAt.Equal(arrived.RecordedAt) {
+				t.Errorf("departure records = %+v", got)
+			}
+
+			deleted, err := s.PruneDepartureRecords(recordedAt)
+			if err != nil || deleted != 1 {
+				t.Errorf("PruneDepartureRecords = %d, %v; want 1", deleted, err)
+			}
+		})
+	}
+}
+
+func TestStore_Cancellations(t *testing.T) {
+	firstSeen := time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			events := []models.CancellationEvent{
+				{RouteCode: "TSASWB", SailingDate: "2024-06-01", ScheduledDepartureTime: "3:00 pm", VesselName: "Queen of Oak Bay", Reason: "Mechanical difficulties", LastSeenAt: firstSeen},
+				{RouteCode: "HSBNAN", SailingDate: "2024-05-01", ScheduledDepartureTime: "8:00 am", LastSeenAt: firstSeen.AddDate(0, -1, 0)},
+			}
+			if err := s.SaveCancellationEvents(events); err != nil {
+				t.Fatal(err)
+			}
+
+			// Seen again later without a reason
+			again := events[0]
+			again.Reason = ""
+			again.LastSeenAt = firstSeen.Add(time.Hour)
+			if err := s.SaveCancellationEvents([]models.CancellationEvent{again}); err != nil {
+				t.Fatal(err)
+			}
+
+			got := s.GetCancellations("2024-06-01", "2024-06-01", "")
+			if len(got) != 1 || got[0].Reason != "Mechanical difficulties" || !got[0].FirstSeenAt.Equal(firstSeen) || !got[0].LastSeenAt.Equal(again.LastSeenAt) {
+				t.Errorf("cancellations = %+v", got)
+			}
+			if got := s.GetCancellations("2024-05-01", "2024-06-30", "HSBNAN"); len(got) != 1 || got[0].RouteCode != "HSBNAN" {
+				t.Errorf("HSBNAN cancellations = %+v", got)
+			}
+
+			deleted, err := s.PruneCancellationEvents(firstSeen)
+			if err != nil || deleted != 1 {
+				t.Errorf("PruneCancellationEvents = %d, %v; want 1", deleted, err)
+			}
+		})
+	}
+}
+
+func TestStore_ServiceChanges(t *testing.T) {
+	detectedAt := time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			changes := []models.ServiceChange{
+				{RouteCode: "TSASWB", Kind: models.ChangeCancelled, SailingDate: "2024-06-01", DepartureTime: "3:00 pm", Summary: "TSASWB 3:00 pm sailing on 2024-06-01 cancelled", DetectedAt: detectedAt},
+				{RouteCode: "HSBNAN", Kind: models.ChangeVesselChanged, SailingDate: "2024-06-01", DepartureTime: "8:00 am", Previous: "Queen of Oak Bay", Current: "Queen of Cowichan", Summary: "HSBNAN 8:00 am sailing on 2024-06-01 vessel changed", DetectedAt: detectedAt.Add(time.Hour)},
+			}
+			if err := s.SaveServiceChanges(changes); err != nil {
+				t.Fatal(err)
+			}
+			if changes[0].ID == 0 || changes[1].ID <= changes[0].ID {
+				t.Errorf("IDs = %d, %d; want increasing", changes[0].ID, changes[1].ID)
+			}
+
+			got := s.GetServiceChanges("", 10)
+			if len(got) != 2 || got[0].RouteCode != "HSBNAN" || got[0].Previous != "Queen of Oak Bay" || got[1].SailingDate != "2024-06-01" || !got[1].DetectedAt.Equal(detectedAt) {
+				t.Errorf("changes = %+v", got)
+			}
+			if got := s.GetServiceChanges("TSASWB", 10); len(got) != 1 || got[0].ID != changes[0].ID {
+				t.Errorf("TSASWB changes = %+v", got)
+			}
+			if got := s.GetServiceChanges("", 1); len(got) != 1 {
+				t.Errorf("limited changes = %+v", got)
+			}
+
+			deleted, err := s.PruneServiceChanges(detectedAt.Add(time.Minute))
+			if err != nil || deleted != 1 {
+				t.Errorf("PruneServiceChanges = %d, %v; want 1", deleted, err)
+			}
+		})
+	}
+}
+
+func TestStore_Subscriptions(t *testing.T) {
+	createdAt := time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			subscription := models.Subscription{
+				URL:           "https://example.com/hook",
+				Secret:        "s3cret",
+				RouteCodes:    []string{"TSASWB", "SWBTSA"},
+				EventTypes:    []string{models.ChangeCancelled, models.EventFillThreshold},
+				FillThreshold: 90,
+				CreatedAt:     createdAt,
+			}
+			if err := s.SaveSubscription(&subscription); err != nil {
+				t.Fatal(err)
+			}
+			everyRoute := models.Subscription{URL: "https://example.com/other", Secret: "other", RouteCodes: []string{}, EventTypes: []string{models.ChangeAdded}, CreatedAt: createdAt}
+			if err := s.SaveSubscription(&everyRoute); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := s.GetSubscription(subscription.ID)
+			if !ok || got.Secret != "s3cret" || len(got.RouteCodes) != 2 || got.EventTypes[1] != models.EventFillThreshold || got.FillThreshold != 90 || !got.CreatedAt.Equal(createdAt) {
+				t.Errorf("GetSubscription = %+v, %v", got, ok)
+			}
+			if all := s.GetSubscriptions(); len(all) != 2 || all[1].RouteCodes == nil || len(all[1].RouteCodes) != 0 {
+				t.Errorf("GetSubscriptions = %+v", all)
+			}
+
+			letter := models.DeadLetter{SubscriptionID: subscription.ID, EventID: "change:1", EventType: models.ChangeCancelled, Payload: []byte(`{"id":"change:1"}`), Attempts: 3, LastStatus: 500, LastError: "500 Internal Server Error", FailedAt: createdAt}
+			if err := s.SaveDeadLetter(&letter); err != nil {
+				t.Fatal(err)
+			}
+			letters := s.GetDeadLetters(subscription.ID, 10)
+			if len(letters) != 1 || letters[0].ID != letter.ID || string(letters[0].Payload) != `{"id":"change:1"}` || letters[0].LastStatus != 500 {
+				t.Errorf("GetDeadLetters = %+v", letters)
+			}
+
+			deleted, err := s.DeleteSubscription(subscription.ID)
+			if err != nil || !deleted {
+				t.Errorf("DeleteSubscription = %v, %v; want true", deleted, err)
+			}
+			if _, ok := s.GetSubscription(subscription.ID); ok {
+				t.Error("subscription still exists after delete")
+			}
+			if letters := s.GetDeadLetters(subscription.ID, 10); len(letters) != 0 {
+				t.Errorf("dead letters after delete = %+v", letters)
+			}
+			if deleted, _ := s.DeleteSubscription(subscription.ID); deleted {
+				t.Error("DeleteSubscription of a missing subscription = true")
+			}
+		})
+	}
+}
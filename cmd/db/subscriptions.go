@@ -0,0 +1,236 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+/*
+ * SaveSubscription
+ *
+ * Registers a webhook subscription. Sets subscription.ID on success.
+ *
+ * @param *models.Subscription subscription
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveSubscription(subscription *models.Subscription) error {
+	sqlStatement := `
+		INSERT INTO webhook_subscriptions (url, secret, route_codes, event_types, fill_threshold, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	return s.db.QueryRow(
+		sqlStatement,
+		subscription.URL,
+		subscription.Secret,
+		strings.Join(subscription.RouteCodes, ","),
+		strings.Join(subscription.EventTypes, ","),
+		subscription.FillThreshold,
+		dbTime(subscription.CreatedAt),
+	).Scan(&subscription.ID)
+}
+
+/*
+ * GetSubscription
+ *
+ * @param int64 id
+ *
+ * @return models.Subscription - including its secret
+ * @return bool - false if there is no such subscription
+ */
+func (s *SQLStore) GetSubscription(id int64) (models.Subscription, bool) {
+	row := s.db.QueryRow(`
+		SELECT id, url, secret, route_codes, event_types, fill_threshold, created_at
+		FROM webhook_subscriptions
+		WHERE id = $1`, id)
+
+	subscription, err := scanSubscription(row)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("GetSubscription: query failed: %v", err)
+		}
+		return models.Subscription{}, false
+	}
+
+	return subscription, true
+}
+
+/*
+ * GetSubscriptions
+ *
+ * @return []models.Subscription - every subscription, including secrets, oldest first
+ */
+func (s *SQLStore) GetSubscriptions() []models.Subscription {
+	subscriptions := []models.Subscription{}
+
+	rows, err := s.db.Query(`
+		SELECT id, url, secret, route_codes, event_types, fill_threshold, created_at
+		FROM webhook_subscriptions
+		ORDER BY id`)
+	if err != nil {
+		log.Printf("GetSubscriptions: query failed: %v", err)
+		return subscriptions
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			log.Printf("GetSubscriptions: row scan failed: %v", err)
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetSubscriptions: row iteration error: %v", err)
+	}
+
+	return subscriptions
+}
+
+/*
+ * DeleteSubscription
+ *
+ * Deletes a subscription and its dead letters.
+ *
+ * @param int64 id
+ *
+ * @return bool - false if there was no such subscription
+ * @return error
+ */
+func (s *SQLStore) DeleteSubscription(id int64) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+/*
+ * SaveDeadLetter
+ *
+ * Records a webhook delivery that failed every attempt. Sets letter.ID on success.
+ *
+ * @param *models.DeadLetter letter
+ *
+ * @return error
+ */
+func (s *SQLStore) SaveDeadLetter(letter *models.DeadLetter) error {
+	sqlStatement := `
+		INSERT INTO webhook_dead_letters (subscription_id, event_id, event_type, payload, attempts, last_status, last_error, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+
+	return s.db.QueryRow(
+		sqlStatement,
+		letter.SubscriptionID,
+		letter.EventID,
+		letter.EventType,
+		string(letter.Payload),
+		letter.Attempts,
+		letter.LastStatus,
+		letter.LastError,
+		dbTime(letter.FailedAt),
+	).Scan(&letter.ID)
+}
+
+/*
+ * GetDeadLetters
+ *
+ * @param int64 subscriptionID
+ * @param int limit - maximum number of dead letters to return
+ *
+ * @return []models.DeadLetter - newest first
+ */
+func (s *SQLStore) GetDeadLetters(subscriptionID int64, limit int) []models.DeadLetter {
+	letters := []models.DeadLetter{}
+
+	sqlStatement := `
+		SELECT id, subscription_id, event_id, event_type, payload, attempts, last_status, last_error, failed_at
+		FROM webhook_dead_letters
+		WHERE subscription_id = $1
+		ORDER BY failed_at DESC, id DESC
+		LIMIT $2`
+
+	rows, err := s.db.Query(sqlStatement, subscriptionID, limit)
+	if err != nil {
+		log.Printf("GetDeadLetters: query failed: %v", err)
+		return letters
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var letter models.DeadLetter
+		var payload string
+		var failedAt nullTime
+
+		err := rows.Scan(&letter.ID, &letter.SubscriptionID, &letter.EventID, &letter.EventType, &payload, &letter.Attempts, &letter.LastStatus, &letter.LastError, &failedAt)
+		if err != nil {
+			log.Printf("GetDeadLetters: row scan failed: %v", err)
+			continue
+		}
+		letter.Payload = []byte(payload)
+		letter.FailedAt = failedAt.Time
+
+		letters = append(letters, letter)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("GetDeadLetters: row iteration error: %v", err)
+	}
+
+	return letters
+}
+
+/*
+ * PruneDeadLetters
+ *
+ * Deletes dead letters that failed before cutoff.
+ *
+ * @param time.Time cutoff
+ *
+ * @return int64 - number of dead letters deleted
+ * @return error
+ */
+func (s *SQLStore) PruneDeadLetters(cutoff time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM webhook_dead_letters WHERE failed_at < $1`, dbTime(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scanSubscription reads a webhook_subscriptions row from a *sql.Row or *sql.Rows
+func scanSubscription(row interface{ Scan(...interface{}) error }) (models.Subscription, error) {
+	var subscription models.Subscription
+	var routeCodes, eventTypes string
+	var createdAt nullTime
+
+	err := row.Scan(&subscription.ID, &subscription.URL, &subscription.Secret, &routeCodes, &eventTypes, &subscription.FillThreshold, &createdAt)
+	if err != nil {
+		return subscription, err
+	}
+
+	subscription.RouteCodes = splitList(routeCodes)
+	subscription.EventTypes = splitList(eventTypes)
+	subscription.CreatedAt = createdAt.Time
+
+	return subscription, nil
+}
+
+// splitList reverses strings.Join(list, ","), keeping an empty list non-nil
+func splitList(joined string) []string {
+	if joined == "" {
+		return []string{}
+	}
+	return strings.Split(joined, ",")
+}
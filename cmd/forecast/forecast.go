@@ -0,0 +1,283 @@
+package forecast
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+const (
+	// Fewer past sailings than this on the same weekday falls back to every day
+	MinSamples = 3
+
+	// Past sailings count as comparable when their fill at the same point
+	// before departure was within this many percentage points
+	FillTolerance = 15
+)
+
+const (
+	BasisWeekday = "weekday"
+	BasisAllDays = "all days"
+)
+
+// Timeline is every observation of one past or upcoming departure, oldest first.
+type Timeline struct {
+	SailingDate   string
+	DepartureTime string
+	Departure     time.Time
+	Observations  []models.CapacityObservation
+}
+
+/*
+ * Timelines
+ *
+ * Groups capacity observations by departure. Observations whose date or time
+ * cannot be parsed are dropped.
+ *
+ * @param []models.CapacityObservation observations
+ * @param *time.Location loc - zone the sailing dates and times are in
+ *
+ * @return []Timeline - sorted by departure
+ */
+func Timelines(observations []models.CapacityObservation, loc *time.Location) []Timeline {
+	byDeparture := make(map[string]*Timeline)
+
+	for _, o := range observations {
+		key := o.SailingDate + " " + o.DepartureTime
+
+		timeline, ok := byDeparture[key]
+		if !ok {
+			departure, err := Departure(o.SailingDate, o.DepartureTime, loc)
+			if err != nil {
+				continue
+			}
+			timeline = &Timeline{SailingDate: o.SailingDate, DepartureTime: o.DepartureTime, Departure: departure}
+			byDeparture[key] = timeline
+		}
+		timeline.Observations = append(timeline.Observations, o)
+	}
+
+	timelines := make([]Timeline, 0, len(byDeparture))
+	for _, timeline := range byDeparture {
+		sort.Slice(timeline.Observations, func(i, j int) bool {
+			return timeline.Observations[i].ObservedAt.Before(timeline.Observations[j].ObservedAt)
+		})
+		timelines = append(timelines, *timeline)
+	}
+	sort.Slice(timelines, func(i, j int) bool {
+		return timelines[i].Departure.Before(timelines[j].Departure)
+	})
+
+	return timelines
+}
+
+/*
+ * Departure
+ *
+ * @param string sailingDate - YYYY-MM-DD
+ * @param string departureTime - e.g. "7:00 am"
+ * @param *time.Location loc
+ *
+ * @return time.Time
+ * @return error
+ */
+func Departure(sailingDate string, departureTime string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 3:04 pm", sailingDate+" "+departureTime, loc)
+}
+
+/*
+ * ForecastRoute
+ *
+ * Forecasts every upcoming, non-cancelled sailing of a capacity route from the
+ * route's fill history.
+ *
+ * Sailings are on the day the route was scraped, or the next if marked as
+ * tomorrow's, so one running late is still forecast for today.
+ *
+ * @param models.CapacityRoute route - the latest scrape of the route
+ * @param []Timeline history - the route's past departures
+ * @param time.Time now
+ * @param *time.Location loc
+ *
+ * @return []models.SailingForecast
+ */
+func ForecastRoute(route models.CapacityRoute, history []Timeline, now time.Time, loc *time.Location) []models.SailingForecast {
+	forecasts := []models.SailingForecast{}
+
+	scrapedAt := now
+	if route.LastUpdated != nil {
+		scrapedAt = *route.LastUpdated
+	}
+	today := scrapedAt.In(loc).Format("2006-01-02")
+	tomorrow := scrapedAt.In(loc).AddDate(0, 0, 1).Format("2006-01-02")
+
+	for _, sailing := range route.Sailings {
+		if sailing.SailingStatus != "future" {
+			continue
+		}
+
+		sailingDate := today
+		if sailing.IsTomorrow {
+			sailingDate = tomorrow
+		}
+
+		departure, err := Departure(sailingDate, sailing.DepartureTime, loc)
+		if err != nil {
+			continue
+		}
+
+		forecasts = append(forecasts, Forecast(history, sailing, departure, now))
+	}
+
+	return forecasts
+}
+
+/*
+ * Forecast
+ *
+ * Estimates the chance that a sailing will be full by departure, and when it
+ * will fill, from past departures at the same time of day.
+ *
+ * Past sailings on the same weekday are preferred, falling back to every day of
+ * the week when there are fewer than MinSamples of them. Of those, the ones that
+ * were about as full as this sailing is now, at the same time before departure,
+ * are used if there are enough of them.
+ *
+ * FullProbability is nil when there is no history to go on. ExpectedFullAt is
+ * only set when the sailing is more likely than not to fill, and is the median
+ * time before departure at which comparable sailings filled.
+ *
+ * @param []Timeline history
+ * @param models.CapacitySailing sailing
+ * @param time.Time departure
+ * @param time.Time now
+ *
+ * @return models.SailingForecast
+ */
+func Forecast(history []Timeline, sailing models.CapacitySailing, departure time.Time, now time.Time) models.SailingForecast {
+	forecast := models.SailingForecast{
+		SailingDate:   departure.Format("2006-01-02"),
+		DepartureTime: sailing.DepartureTime,
+		Fill:          sailing.Fill,
+	}
+
+	if sailing.Fill >= 100 {
+		probability := 1.0
+		forecast.FullProbability = &probability
+		forecast.ExpectedFullAt = &now
+		return forecast
+	}
+
+	// A sailing running late has no time left before departure
+	lead := departure.Sub(now)
+	if lead < 0 {
+		lead = 0
+	}
+
+	var weekday, allDays []sample
+	for _, timeline := range history {
+		if timeline.DepartureTime != sailing.DepartureTime || !timeline.Departure.Before(now) || len(timeline.Observations) == 0 {
+			continue
+		}
+
+		s := sampleAt(timeline, lead)
+		allDays = append(allDays, s)
+		if timeline.Departure.Weekday() == departure.Weekday() {
+			weekday = append(weekday, s)
+		}
+	}
+
+	samples, basis := weekday, BasisWeekday
+	if len(samples) < MinSamples {
+		samples, basis = allDays, BasisAllDays
+	}
+	if len(samples) == 0 {
+		return forecast
+	}
+
+	var comparable []sample
+	for _, s := range samples {
+		if s.known && abs(s.fill-sailing.Fill) <= FillTolerance {
+			comparable = append(comparable, s)
+		}
+	}
+	if len(comparable) >= MinSamples {
+		samples = comparable
+	}
+
+	var fullLeads []time.Duration
+	for _, s := range samples {
+		if s.full {
+			fullLeads = append(fullLeads, s.fullLead)
+		}
+	}
+
+	probability := math.Round(float64(len(fullLeads))/float64(len(samples))*100) / 100
+	forecast.FullProbability = &probability
+	forecast.SampleSize = len(samples)
+	forecast.Basis = basis
+
+	if probability >= 0.5 {
+		fullAt := departure.Add(-median(fullLeads))
+		if fullAt.Before(now) {
+			fullAt = now
+		}
+		forecast.ExpectedFullAt = &fullAt
+	}
+
+	return forecast
+}
+
+// sample is how a past departure looked lead before it left, and how it ended up
+type sample struct {
+	fill     int
+	known    bool          // false if it hadn't been observed yet at lead
+	full     bool          // reached 100% before departure
+	fullLead time.Duration // time before departure it first reached 100%, at most lead
+}
+
+func sampleAt(timeline Timeline, lead time.Duration) sample {
+	var s sample
+	at := timeline.Departure.Add(-lead)
+
+	for _, o := range timeline.Observations {
+		if !o.ObservedAt.After(at) {
+			s.fill = o.Fill
+			s.known = true
+		}
+		if o.Fill >= 100 && !s.full {
+			s.full = true
+			s.fullLead = timeline.Departure.Sub(o.ObservedAt)
+		}
+	}
+
+	if s.fullLead > lead {
+		s.fullLead = lead
+	}
+
+	return s
+}
+
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,100 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+// observe returns observations of a departure at the given minutes before it left
+func observe(t *testing.T, date string, fills map[int]int) []models.CapacityObservation {
+	t.Helper()
+
+	departure, err := Departure(date, "3:00 pm", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var observations []models.CapacityObservation
+	for minutesBefore, fill := range fills {
+		observations = append(observations, models.CapacityObservation{
+			RouteCode:     "TSASWB",
+			SailingDate:   date,
+			DepartureTime: "3:00 pm",
+			ObservedAt:    departure.Add(-time.Duration(minutesBefore) * time.Minute),
+			SailingStatus: "future",
+			Fill:          fill,
+		})
+	}
+	return observations
+}
+
+func TestForecast_UsesSameWeekdayHistory(t *testing.T) {
+	var observations []models.CapacityObservation
+	// Three previous Fridays: two filled 30 and 60 minutes out, one didn't
+	observations = append(observations, observe(t, "2024-05-10", map[int]int{120: 50, 60: 80, 30: 100})...)
+	observations = append(observations, observe(t, "2024-05-17", map[int]int{120: 55, 60: 100, 10: 100})...)
+	observations = append(observations, observe(t, "2024-05-24", map[int]int{120: 45, 60: 60, 10: 90})...)
+	// A Monday that stayed empty, which should be ignored
+	observations = append(observations, observe(t, "2024-05-27", map[int]int{120: 10, 10: 20})...)
+
+	history := Timelines(observations, time.UTC)
+	if len(history) != 4 {
+		t.Fatalf("got %d timelines, want 4", len(history))
+	}
+
+	departure := time.Date(2024, 5, 31, 15, 0, 0, 0, time.UTC)
+	now := departure.Add(-2 * time.Hour)
+	sailing := models.CapacitySailing{DepartureTime: "3:00 pm", SailingStatus: "future", Fill: 50}
+
+	forecast := Forecast(history, sailing, departure, now)
+
+	if forecast.FullProbability == nil || *forecast.FullProbability != 0.67 {
+		t.Fatalf("FullProbability = %v, want 0.67", forecast.FullProbability)
+	}
+	if forecast.SampleSize != 3 || forecast.Basis != BasisWeekday {
+		t.Errorf("SampleSize, Basis = %d, %q; want 3, %q", forecast.SampleSize, forecast.Basis, BasisWeekday)
+	}
+	if want := departure.Add(-45 * time.Minute); forecast.ExpectedFullAt == nil || !forecast.ExpectedFullAt.Equal(want) {
+		t.Errorf("ExpectedFullAt = %v, want %v", forecast.ExpectedFullAt, want)
+	}
+}
+
+func TestForecast_NoHistory(t *testing.T) {
+	departure := time.Date(2024, 5, 31, 15, 0, 0, 0, time.UTC)
+	sailing := models.CapacitySailing{DepartureTime: "3:00 pm", SailingStatus: "future", Fill: 20}
+
+	forecast := Forecast(nil, sailing, departure, departure.Add(-time.Hour))
+
+	if forecast.FullProbability != nil || forecast.ExpectedFullAt != nil || forecast.SampleSize != 0 {
+		t.Errorf("forecast = %+v, want no estimate", forecast)
+	}
+}
+
+func TestForecastRoute_DatesSailingsFromScrape(t *testing.T) {
+	now := time.Date(2024, 5, 31, 15, 10, 0, 0, time.UTC)
+	scrapedAt := now.Add(-time.Minute)
+	route := models.CapacityRoute{
+		RouteCode:   "TSASWB",
+		LastUpdated: &scrapedAt,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "1:00 pm", SailingStatus: "past"},
+			// Running late, still today's
+			{DepartureTime: "3:00 pm", SailingStatus: "future", Fill: 70},
+			{DepartureTime: "7:00 am", SailingStatus: "future", IsTomorrow: true},
+		},
+	}
+
+	forecasts := ForecastRoute(route, nil, now, time.UTC)
+
+	if len(forecasts) != 2 {
+		t.Fatalf("got %d forecasts, want 2: %+v", len(forecasts), forecasts)
+	}
+	if forecasts[0].SailingDate != "2024-05-31" || forecasts[0].DepartureTime != "3:00 pm" {
+		t.Errorf("late sailing forecast for %s %s, want 2024-05-31 3:00 pm", forecasts[0].SailingDate, forecasts[0].DepartureTime)
+	}
+	if forecasts[1].SailingDate != "2024-06-01" {
+		t.Errorf("tomorrow's sailing forecast for %s, want 2024-06-01", forecasts[1].SailingDate)
+	}
+}
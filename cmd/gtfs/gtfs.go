@@ -0,0 +1,318 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/staticdata"
+)
+
+const (
+	AgencyID       = "BCF"
+	agencyName     = "BC Ferries"
+	agencyURL      = "https://www.bcferries.com"
+	agencyTimezone = sailingtime.Zone
+	agencyLang     = "en"
+
+	routeTypeFerry = "4"
+
+	// Only the day's schedule is scraped, so it is published as running every
+	// day for this many days from the day it was scraped
+	serviceDays = 7
+)
+
+// Trip is one scheduled sailing, as exported to trips.txt and stop_times.txt
+type Trip struct {
+	ID        string
+	RouteCode string
+	ServiceID string
+	From      string // Stop IDs, the route's terminal codes
+	To        string
+	Departure int // Minutes past midnight on the service day
+	Arrival   int // Past 1440 if it arrives the next day
+	Cancelled bool
+	FirstDay  time.Time // First and last days its service runs, set for exported trips
+	LastDay   time.Time
+}
+
+/*
+ * TripID
+ *
+ * Returns the ID a sailing is exported with, "<route code>-<HHMM>" from its
+ * scheduled departure. GTFS-Realtime updates use the same IDs.
+ *
+ * @param string routeCode
+ * @param string departureTime - "7:00 am"
+ *
+ * @return string
+ * @return bool - false if the departure time can't be parsed
+ */
+func TripID(routeCode string, departureTime string) (string, bool) {
+	departure, ok := sailingtime.ClockMinutes(departureTime)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s-%02d%02d", routeCode, departure/60, departure%60), true
+}
+
+/*
+ * Trips
+ *
+ * Returns a route's sailings as trips. Sailings without a departure time, or
+ * with neither an arrival time nor a route duration to work one out from, are
+ * left out.
+ *
+ * @param models.NonCapacityRoute route
+ *
+ * @return []Trip - in departure order
+ */
+func Trips(route models.NonCapacityRoute) []Trip {
+	duration, hasDuration := sailingtime.DurationMinutes(route.SailingDuration)
+	hasDuration = hasDuration && duration > 0
+
+	var trips []Trip
+	seen := map[string]bool{}
+	for _, sailing := range route.Sailings {
+		id, ok := TripID(route.RouteCode, sailing.DepartureTime)
+		if !ok || seen[id] {
+			continue
+		}
+
+		departure, _ := sailingtime.ClockMinutes(sailing.DepartureTime)
+		arrival, ok := sailingtime.ClockMinutes(sailing.ArrivalTime)
+		if ok {
+			if arrival <= departure {
+				arrival += 24 * 60
+			}
+		} else if hasDuration {
+			arrival = departure + duration
+		} else {
+			continue
+		}
+		seen[id] = true
+
+		trip := Trip{
+			ID:        id,
+			RouteCode: route.RouteCode,
+			ServiceID: route.RouteCode,
+			From:      route.FromTerminalCode,
+			To:        route.ToTerminalCode,
+			Departure: departure,
+			Arrival:   arrival,
+			Cancelled: strings.Contains(strings.ToLower(sailing.VesselStatus), "cancel"),
+		}
+		if trip.Cancelled {
+			// Cancelled sailings get their own service, so they can be removed
+			// on the scraped day without affecting the rest of the route's days
+			trip.ServiceID = id
+		}
+		trips = append(trips, trip)
+	}
+
+	sort.Slice(trips, func(i, j int) bool {
+		return trips[i].Departure < trips[j].Departure
+	})
+
+	return trips
+}
+
+/*
+ * Build
+ *
+ * Builds a GTFS static feed zip from the non-capacity schedules. Only the
+ * scraped day's sailings are known, so each route's service runs every day
+ * of the week from the day it was scraped, less any sailings cancelled that
+ * day. Routes with an unknown terminal or no usable sailings are left out.
+ *
+ * @param []models.NonCapacityRoute routes
+ *
+ * @return []byte - the zip
+ * @return error
+ */
+func Build(routes []models.NonCapacityRoute) ([]byte, error) {
+	loc := sailingtime.Location()
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].RouteCode < routes[j].RouteCode
+	})
+
+	agency := [][]string{
+		{"agency_id", "agency_name", "agency_url", "agency_timezone", "agency_lang"},
+		{AgencyID, agencyName, agencyURL, agencyTimezone, agencyLang},
+	}
+	stops := [][]string{{"stop_id", "stop_name", "stop_lat", "stop_lon"}}
+	routesTxt := [][]string{{"route_id", "agency_id", "route_short_name", "route_long_name", "route_type"}}
+	trips := [][]string{{"route_id", "service_id", "trip_id", "trip_headsign"}}
+	stopTimes := [][]string{{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"}}
+	calendar := [][]string{{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}}
+	calendarDates := [][]string{{"service_id", "date", "exception_type"}}
+
+	usedStops := map[string]staticdata.Terminal{}
+	var modified time.Time
+
+	for _, route := range routes {
+		from, to, routeTrips, ok := exportedRoute(route)
+		if !ok {
+			continue
+		}
+		usedStops[from.Code] = from
+		usedStops[to.Code] = to
+
+		day := ServiceDay(route.LastUpdated, loc)
+		lastDay := day.AddDate(0, 0, serviceDays-1)
+		if route.LastUpdated != nil && route.LastUpdated.After(modified) {
+			modified = *route.LastUpdated
+		}
+
+		routesTxt = append(routesTxt, []string{route.RouteCode, AgencyID, "", from.Name + " - " + to.Name, routeTypeFerry})
+		calendar = append(calendar, calendarRow(route.RouteCode, day, lastDay))
+
+		for _, trip := range routeTrips {
+			trips = append(trips, []string{route.RouteCode, trip.ServiceID, trip.ID, to.Name})
+			stopTimes = append(stopTimes,
+				[]string{trip.ID, gtfsTime(trip.Departure), gtfsTime(trip.Departure), trip.From, "1"},
+				[]string{trip.ID, gtfsTime(trip.Arrival), gtfsTime(trip.Arrival), trip.To, "2"},
+			)
+
+			if trip.Cancelled {
+				calendar = append(calendar, calendarRow(trip.ServiceID, day, lastDay))
+				calendarDates = append(calendarDates, []string{trip.ServiceID, day.Format("20060102"), "2"})
+			}
+		}
+	}
+
+	stopCodes := make([]string, 0, len(usedStops))
+	for code := range usedStops {
+		stopCodes = append(stopCodes, code)
+	}
+	sort.Strings(stopCodes)
+	for _, code := range stopCodes {
+		terminal := usedStops[code]
+		stops = append(stops, []string{
+			terminal.Code,
+			terminal.Name,
+			strconv.FormatFloat(terminal.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(terminal.Longitude, 'f', -1, 64),
+		})
+	}
+
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		records [][]string
+	}{
+		{"agency.txt", agency},
+		{"stops.txt", stops},
+		{"routes.txt", routesTxt},
+		{"trips.txt", trips},
+		{"stop_times.txt", stopTimes},
+		{"calendar.txt", calendar},
+		{"calendar_dates.txt", calendarDates},
+	}
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return nil, err
+		}
+
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.WriteAll(file.records); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+ * StaticTrips
+ *
+ * Returns the trips Build exports for the non-capacity schedules, keyed by ID,
+ * for matching realtime updates to them.
+ *
+ * @param []models.NonCapacityRoute routes
+ *
+ * @return map[string]Trip
+ */
+func StaticTrips(routes []models.NonCapacityRoute) map[string]Trip {
+	trips := map[string]Trip{}
+	for _, route := range routes {
+		_, _, routeTrips, ok := exportedRoute(route)
+		if !ok {
+			continue
+		}
+		for _, trip := range routeTrips {
+			trips[trip.ID] = trip
+		}
+	}
+	return trips
+}
+
+// exportedRoute returns a route's terminals and trips, or false if it is left out of the feed
+func exportedRoute(route models.NonCapacityRoute) (staticdata.Terminal, staticdata.Terminal, []Trip, bool) {
+	from, fromOK := staticdata.GetTerminal(route.FromTerminalCode)
+	to, toOK := staticdata.GetTerminal(route.ToTerminalCode)
+	if !fromOK || !toOK {
+		return from, to, nil, false
+	}
+	trips := Trips(route)
+
+	firstDay := ServiceDay(route.LastUpdated, sailingtime.Location())
+	lastDay := firstDay.AddDate(0, 0, serviceDays-1)
+	for i := range trips {
+		trips[i].FirstDay = firstDay
+		trips[i].LastDay = lastDay
+	}
+	return from, to, trips, len(trips) > 0
+}
+
+/*
+ * ServiceDay
+ *
+ * Returns the day a route was scraped in loc, or today if unknown. The
+ * exported calendar starts on this day.
+ *
+ * @param *time.Time lastUpdated
+ * @param *time.Location loc
+ *
+ * @return time.Time - midnight at the start of the day
+ */
+func ServiceDay(lastUpdated *time.Time, loc *time.Location) time.Time {
+	scrapedAt := time.Now()
+	if lastUpdated != nil {
+		scrapedAt = *lastUpdated
+	}
+	return sailingtime.StartOfDay(scrapedAt, loc)
+}
+
+// calendarRow returns a calendar.txt row for a service running every day from firstDay to lastDay
+func calendarRow(serviceID string, firstDay time.Time, lastDay time.Time) []string {
+	row := []string{serviceID, "0", "0", "0", "0", "0", "0", "0", firstDay.Format("20060102"), lastDay.Format("20060102")}
+	for day := firstDay; !day.After(lastDay); day = day.AddDate(0, 0, 1) {
+		// Columns run monday to sunday, time.Weekday from sunday
+		row[1+(int(day.Weekday())+6)%7] = "1"
+	}
+	return row
+}
+
+// gtfsTime formats minutes past midnight as HH:MM:SS, going past 24:00:00 for the next day
+func gtfsTime(minutes int) string {
+	return fmt.Sprintf("%02d:%02d:00", minutes/60, minutes%60)
+}
@@ -0,0 +1,125 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestTrips(t *testing.T) {
+	route := models.NonCapacityRoute{
+		RouteCode:       "TSASWB",
+		SailingDuration: "1h 35m",
+		Sailings: []models.NonCapacitySailing{
+			{DepartureTime: "9:00 am", ArrivalTime: "10:35 am"},
+			{DepartureTime: "7:00 am"},
+			{DepartureTime: "11:00 pm", ArrivalTime: "12:35 am"},
+			{DepartureTime: "1:00 pm", VesselStatus: "Cancelled due to weather"},
+			{DepartureTime: "Variable"},
+		},
+	}
+
+	got := Trips(route)
+
+	want := []Trip{
+		{ID: "TSASWB-0700", RouteCode: "TSASWB", ServiceID: "TSASWB", Departure: 7 * 60, Arrival: 8*60 + 35},
+		{ID: "TSASWB-0900", RouteCode: "TSASWB", ServiceID: "TSASWB", Departure: 9 * 60, Arrival: 10*60 + 35},
+		{ID: "TSASWB-1300", RouteCode: "TSASWB", ServiceID: "TSASWB-1300", Departure: 13 * 60, Arrival: 14*60 + 35, Cancelled: true},
+		{ID: "TSASWB-2300", RouteCode: "TSASWB", ServiceID: "TSASWB", Departure: 23 * 60, Arrival: 24*60 + 35},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d trips, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("trip %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Without a duration, sailings need an arrival time
+	route.SailingDuration = ""
+	if got := Trips(route); len(got) != 2 {
+		t.Errorf("without duration got %d trips, want 2: %+v", len(got), got)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	scrapedAt := time.Date(2024, 6, 1, 6, 30, 0, 0, time.UTC) // 2024-05-31 in Vancouver
+
+	feed, err := Build([]models.NonCapacityRoute{
+		{
+			RouteCode:        "TSASWB",
+			FromTerminalCode: "TSA",
+			ToTerminalCode:   "SWB",
+			SailingDuration:  "1:35",
+			LastUpdated:      &scrapedAt,
+			Sailings: []models.NonCapacitySailing{
+				{DepartureTime: "7:00 am"},
+				{DepartureTime: "11:00 pm", VesselStatus: "Cancelled"},
+			},
+		},
+		// Unknown terminal
+		{RouteCode: "TSAXXX", FromTerminalCode: "TSA", ToTerminalCode: "XXX", SailingDuration: "1:00", Sailings: []models.NonCapacitySailing{{DepartureTime: "7:00 am"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(feed), int64(len(feed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][][]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(reader).ReadAll()
+		reader.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		files[file.Name] = records
+	}
+
+	for _, name := range []string{"agency.txt", "stops.txt", "routes.txt", "trips.txt", "stop_times.txt", "calendar.txt", "calendar_dates.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+
+	if stops := files["stops.txt"]; len(stops) != 3 || stops[1][0] != "SWB" || stops[2][0] != "TSA" {
+		t.Errorf("stops.txt = %v", stops)
+	}
+	if routes := files["routes.txt"]; len(routes) != 2 || routes[1][3] != "Tsawwassen - Swartz Bay" || routes[1][4] != "4" {
+		t.Errorf("routes.txt = %v", routes)
+	}
+	if trips := files["trips.txt"]; len(trips) != 3 || trips[2][1] != "TSASWB-2300" || trips[2][2] != "TSASWB-2300" {
+		t.Errorf("trips.txt = %v", trips)
+	}
+
+	stopTimes := files["stop_times.txt"]
+	if len(stopTimes) != 5 || stopTimes[3][1] != "23:00:00" || stopTimes[4][1] != "24:35:00" || stopTimes[4][3] != "SWB" {
+		t.Errorf("stop_times.txt = %v", stopTimes)
+	}
+
+	calendar := files["calendar.txt"]
+	if len(calendar) != 3 || calendar[1][8] != "20240531" || calendar[1][9] != "20240606" || calendar[2][8] != "20240531" || calendar[2][9] != "20240606" {
+		t.Errorf("calendar.txt = %v", calendar)
+	}
+	// Runs every day of the week from the scraped Friday
+	for i := 1; i <= 7; i++ {
+		if calendar[1][i] != "1" {
+			t.Errorf("calendar.txt %s = %q, want 1", calendar[0][i], calendar[1][i])
+		}
+	}
+	// The cancelled sailing is removed on the scraped day only
+	if dates := files["calendar_dates.txt"]; len(dates) != 2 || dates[1][0] != "TSASWB-2300" || dates[1][1] != "20240531" || dates[1][2] != "2" {
+		t.Errorf("calendar_dates.txt = %v", dates)
+	}
+}
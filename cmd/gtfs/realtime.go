@@ -0,0 +1,430 @@
+package gtfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const realtimeVersion = "2.0"
+
+// Alert causes, as numbered in gtfs-realtime.proto
+const (
+	CauseUnknown          = 1
+	CauseOther            = 2
+	CauseTechnicalProblem = 3
+	CauseWeather          = 8
+	CauseMedicalEmergency = 12
+)
+
+// Alert effects, as numbered in gtfs-realtime.proto
+const (
+	EffectNoService = 1
+)
+
+// The subset of GTFS-Realtime the feeds use. Each type's Marshal encodes it in
+// the protobuf wire format with the field numbers from gtfs-realtime.proto,
+// leaving out fields that aren't set.
+
+type FeedMessage struct {
+	Timestamp time.Time
+	Entities  []FeedEntity
+}
+
+type FeedEntity struct {
+	ID         string
+	TripUpdate *TripUpdate
+	Alert      *Alert
+}
+
+type TripDescriptor struct {
+	TripID    string
+	RouteID   string
+	StartDate string // YYYYMMDD
+	Cancelled bool
+}
+
+type TripUpdate struct {
+	Trip            TripDescriptor
+	VehicleLabel    string
+	StopTimeUpdates []StopTimeUpdate
+	Timestamp       time.Time
+}
+
+type StopTimeUpdate struct {
+	StopSequence int
+	StopID       string
+	Arrival      *StopTimeEvent
+	Departure    *StopTimeEvent
+}
+
+type StopTimeEvent struct {
+	Time  time.Time
+	Delay *int // Seconds, if known
+}
+
+type Alert struct {
+	Start           time.Time
+	End             time.Time
+	RouteID         string
+	Trip            *TripDescriptor
+	Cause           int
+	Effect          int
+	HeaderText      string
+	DescriptionText string
+}
+
+/*
+ * TripUpdates
+ *
+ * Builds a GTFS-Realtime TripUpdates feed from the capacity routes. Cancelled
+ * sailings are marked CANCELED; sailings that have left get their actual
+ * departure and delay, and sailings with an arrival time or ETA get their
+ * arrival. Only sailings with a trip in the static feed are included, keyed by
+ * its trip ID and the day the sailing departs.
+ *
+ * @param []models.CapacityRoute routes
+ * @param map[string]Trip trips - from StaticTrips
+ * @param time.Time now
+ *
+ * @return FeedMessage
+ */
+func TripUpdates(routes []models.CapacityRoute, trips map[string]Trip, now time.Time) FeedMessage {
+	loc := sailingtime.Location()
+	feed := FeedMessage{Timestamp: feedTimestamp(routes, now)}
+
+	for _, route := range sortedCapacityRoutes(routes) {
+		updatedAt := now
+		if route.LastUpdated != nil {
+			updatedAt = *route.LastUpdated
+		}
+
+		for _, sailing := range route.Sailings {
+			trip, date, ok := matchTrip(route, sailing, trips, loc)
+			if !ok {
+				continue
+			}
+
+			update := TripUpdate{
+				Trip:         descriptor(trip, date),
+				VehicleLabel: sailing.VesselName,
+				Timestamp:    updatedAt,
+			}
+
+			if sailing.SailingStatus == "cancelled" {
+				update.Trip.Cancelled = true
+			} else {
+				if departed, ok := sailingtime.ClockMinutes(sailing.ActualDepartureTime); ok {
+					// Early departures may be a few minutes before the scheduled time,
+					// anything much earlier is past midnight
+					if departed < trip.Departure-12*60 {
+						departed += 24 * 60
+					}
+					delay := sailing.DelayMinutes * 60
+					update.StopTimeUpdates = append(update.StopTimeUpdates, StopTimeUpdate{
+						StopSequence: 1,
+						StopID:       trip.From,
+						Departure:    &StopTimeEvent{Time: at(date, departed), Delay: &delay},
+					})
+				}
+
+				if arrival, ok := sailingtime.ClockMinutes(sailing.ArrivalTime); ok {
+					if arrival < trip.Departure {
+						arrival += 24 * 60
+					}
+					delay := (arrival - trip.Arrival) * 60
+					update.StopTimeUpdates = append(update.StopTimeUpdates, StopTimeUpdate{
+						StopSequence: 2,
+						StopID:       trip.To,
+						Arrival:      &StopTimeEvent{Time: at(date, arrival), Delay: &delay},
+					})
+				}
+
+				if len(update.StopTimeUpdates) == 0 {
+					continue
+				}
+			}
+
+			feed.Entities = append(feed.Entities, FeedEntity{
+				ID:         update.Trip.TripID + ":" + update.Trip.StartDate,
+				TripUpdate: &update,
+			})
+		}
+	}
+
+	return feed
+}
+
+/*
+ * ServiceAlerts
+ *
+ * Builds a GTFS-Realtime ServiceAlerts feed with an alert for each cancelled
+ * capacity sailing that has a trip in the static feed. The cause is guessed
+ * from the vessel status BC Ferries gives.
+ *
+ * @param []models.CapacityRoute routes
+ * @param map[string]Trip trips - from StaticTrips
+ * @param time.Time now
+ *
+ * @return FeedMessage
+ */
+func ServiceAlerts(routes []models.CapacityRoute, trips map[string]Trip, now time.Time) FeedMessage {
+	loc := sailingtime.Location()
+	feed := FeedMessage{Timestamp: feedTimestamp(routes, now)}
+
+	for _, route := range sortedCapacityRoutes(routes) {
+		for _, sailing := range route.Sailings {
+			if sailing.SailingStatus != "cancelled" {
+				continue
+			}
+			trip, date, ok := matchTrip(route, sailing, trips, loc)
+			if !ok {
+				continue
+			}
+
+			tripDescriptor := descriptor(trip, date)
+			feed.Entities = append(feed.Entities, FeedEntity{
+				ID: "cancelled:" + tripDescriptor.TripID + ":" + tripDescriptor.StartDate,
+				Alert: &Alert{
+					Start:           at(date, trip.Departure),
+					End:             at(date, trip.Arrival),
+					RouteID:         route.RouteCode,
+					Trip:            &tripDescriptor,
+					Cause:           cause(sailing.VesselStatus),
+					Effect:          EffectNoService,
+					HeaderText:      fmt.Sprintf("%s %s sailing on %s cancelled", route.RouteCode, sailingTime(sailing), date.Format("2006-01-02")),
+					DescriptionText: sailing.VesselStatus,
+				},
+			})
+		}
+	}
+
+	return feed
+}
+
+/*
+ * matchTrip
+ *
+ * Finds a capacity sailing's trip in the static feed. Sailings on days the
+ * trip's service doesn't run, such as tomorrow's sailings when the schedule
+ * hasn't been scraped for a week, have no trip that consumers could match.
+ *
+ * @param models.CapacityRoute route
+ * @param models.CapacitySailing sailing
+ * @param map[string]Trip trips
+ * @param *time.Location loc
+ *
+ * @return Trip
+ * @return time.Time - midnight on the day the sailing departs
+ * @return bool - false if the sailing has no trip running that day
+ */
+func matchTrip(route models.CapacityRoute, sailing models.CapacitySailing, trips map[string]Trip, loc *time.Location) (Trip, time.Time, bool) {
+	id, ok := TripID(route.RouteCode, sailingTime(sailing))
+	if !ok {
+		return Trip{}, time.Time{}, false
+	}
+	trip, ok := trips[id]
+	if !ok {
+		return Trip{}, time.Time{}, false
+	}
+
+	date := ServiceDay(route.LastUpdated, loc)
+	if sailing.IsTomorrow {
+		date = date.AddDate(0, 0, 1)
+	}
+	if date.Before(trip.FirstDay) || date.After(trip.LastDay) {
+		return Trip{}, time.Time{}, false
+	}
+	return trip, date, true
+}
+
+func descriptor(trip Trip, date time.Time) TripDescriptor {
+	return TripDescriptor{TripID: trip.ID, RouteID: trip.RouteCode, StartDate: date.Format("20060102")}
+}
+
+// sailingTime returns a capacity sailing's scheduled departure
+func sailingTime(sailing models.CapacitySailing) string {
+	if sailing.ScheduledDepartureTime != "" {
+		return sailing.ScheduledDepartureTime
+	}
+	return sailing.DepartureTime
+}
+
+// at returns the time minutes past midnight on date, which may be past 1440
+func at(date time.Time, minutes int) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, minutes, 0, 0, date.Location())
+}
+
+func cause(status string) int {
+	status = strings.ToLower(status)
+	switch {
+	case status == "":
+		return CauseUnknown
+	case strings.Contains(status, "weather") || strings.Contains(status, "wind") || strings.Contains(status, "tide"):
+		return CauseWeather
+	case strings.Contains(status, "mechanical") || strings.Contains(status, "technical") || strings.Contains(status, "maintenance"):
+		return CauseTechnicalProblem
+	case strings.Contains(status, "medical"):
+		return CauseMedicalEmergency
+	}
+	return CauseOther
+}
+
+// feedTimestamp is when the newest route was scraped, or now if none have been
+func feedTimestamp(routes []models.CapacityRoute, now time.Time) time.Time {
+	var latest time.Time
+	for _, route := range routes {
+		if route.LastUpdated != nil && route.LastUpdated.After(latest) {
+			latest = *route.LastUpdated
+		}
+	}
+	if latest.IsZero() {
+		return now
+	}
+	return latest
+}
+
+func sortedCapacityRoutes(routes []models.CapacityRoute) []models.CapacityRoute {
+	sorted := append([]models.CapacityRoute{}, routes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].RouteCode < sorted[j].RouteCode
+	})
+	return sorted
+}
+
+/*****************/
+/* Wire Encoding */
+/*****************/
+
+func (m FeedMessage) Marshal() []byte {
+	var header []byte
+	header = appendString(header, 1, realtimeVersion)
+	header = appendVarint(header, 2, 0) // FULL_DATASET
+	header = appendVarint(header, 3, uint64(m.Timestamp.Unix()))
+
+	var b []byte
+	b = appendMessage(b, 1, header)
+	for _, entity := range m.Entities {
+		b = appendMessage(b, 2, entity.Marshal())
+	}
+	return b
+}
+
+func (e FeedEntity) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, e.ID)
+	if e.TripUpdate != nil {
+		b = appendMessage(b, 3, e.TripUpdate.Marshal())
+	}
+	if e.Alert != nil {
+		b = appendMessage(b, 5, e.Alert.Marshal())
+	}
+	return b
+}
+
+func (d TripDescriptor) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, d.TripID)
+	if d.StartDate != "" {
+		b = appendString(b, 3, d.StartDate)
+	}
+	if d.Cancelled {
+		b = appendVarint(b, 4, 3) // CANCELED
+	}
+	if d.RouteID != "" {
+		b = appendString(b, 5, d.RouteID)
+	}
+	return b
+}
+
+func (u TripUpdate) Marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, u.Trip.Marshal())
+	for _, stopTimeUpdate := range u.StopTimeUpdates {
+		b = appendMessage(b, 2, stopTimeUpdate.Marshal())
+	}
+	if u.VehicleLabel != "" {
+		b = appendMessage(b, 3, appendString(nil, 2, u.VehicleLabel))
+	}
+	if !u.Timestamp.IsZero() {
+		b = appendVarint(b, 4, uint64(u.Timestamp.Unix()))
+	}
+	return b
+}
+
+func (u StopTimeUpdate) Marshal() []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(u.StopSequence))
+	if u.Arrival != nil {
+		b = appendMessage(b, 2, u.Arrival.Marshal())
+	}
+	if u.Departure != nil {
+		b = appendMessage(b, 3, u.Departure.Marshal())
+	}
+	if u.StopID != "" {
+		b = appendString(b, 4, u.StopID)
+	}
+	return b
+}
+
+func (e StopTimeEvent) Marshal() []byte {
+	var b []byte
+	if e.Delay != nil {
+		b = appendVarint(b, 1, uint64(int64(*e.Delay)))
+	}
+	b = appendVarint(b, 2, uint64(e.Time.Unix()))
+	return b
+}
+
+func (a Alert) Marshal() []byte {
+	var period []byte
+	period = appendVarint(period, 1, uint64(a.Start.Unix()))
+	period = appendVarint(period, 2, uint64(a.End.Unix()))
+
+	var entity []byte
+	entity = appendString(entity, 1, AgencyID)
+	if a.RouteID != "" {
+		entity = appendString(entity, 2, a.RouteID)
+	}
+	if a.Trip != nil {
+		entity = appendMessage(entity, 4, a.Trip.Marshal())
+	}
+
+	var b []byte
+	b = appendMessage(b, 1, period)
+	b = appendMessage(b, 5, entity)
+	b = appendVarint(b, 6, uint64(a.Cause))
+	b = appendVarint(b, 7, uint64(a.Effect))
+	b = appendMessage(b, 10, translatedString(a.HeaderText))
+	if a.DescriptionText != "" {
+		b = appendMessage(b, 11, translatedString(a.DescriptionText))
+	}
+	return b
+}
+
+func translatedString(text string) []byte {
+	var translation []byte
+	translation = appendString(translation, 1, text)
+	translation = appendString(translation, 2, agencyLang)
+	return appendMessage(nil, 1, translation)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
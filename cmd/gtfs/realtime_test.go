@@ -0,0 +1,228 @@
+package gtfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// message is a decoded protobuf message: each field number's varints or bytes
+type message map[protowire.Number][]interface{}
+
+func decode(t *testing.T, b []byte) message {
+	t.Helper()
+	m := message{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				t.Fatalf("bad varint in field %d", num)
+			}
+			m[num] = append(m[num], v)
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatalf("bad bytes in field %d", num)
+			}
+			m[num] = append(m[num], v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d in field %d", typ, num)
+		}
+	}
+	return m
+}
+
+func (m message) message(t *testing.T, num protowire.Number, i int) message {
+	t.Helper()
+	if len(m[num]) <= i {
+		t.Fatalf("field %d has %d values, want at least %d", num, len(m[num]), i+1)
+	}
+	return decode(t, m[num][i].([]byte))
+}
+
+func (m message) string(num protowire.Number) string {
+	if len(m[num]) == 0 {
+		return ""
+	}
+	return string(m[num][0].([]byte))
+}
+
+func (m message) varint(num protowire.Number) int64 {
+	if len(m[num]) == 0 {
+		return 0
+	}
+	return int64(m[num][0].(uint64))
+}
+
+func realtimeFixture() ([]models.CapacityRoute, map[string]Trip, time.Time) {
+	loc := sailingtime.Location()
+	scrapedAt := time.Date(2024, 6, 1, 22, 0, 0, 0, loc)
+
+	trips := StaticTrips([]models.NonCapacityRoute{{
+		RouteCode:        "TSASWB",
+		FromTerminalCode: "TSA",
+		ToTerminalCode:   "SWB",
+		SailingDuration:  "1h 35m",
+		LastUpdated:      &scrapedAt,
+		Sailings: []models.NonCapacitySailing{
+			{DepartureTime: "7:00 pm"},
+			{DepartureTime: "9:00 pm"},
+			{DepartureTime: "11:00 pm"},
+			{DepartureTime: "7:00 am"},
+		},
+	}})
+
+	routes := []models.CapacityRoute{
+		{
+			RouteCode:   "TSASWB",
+			LastUpdated: &scrapedAt,
+			Sailings: []models.CapacitySailing{
+				{DepartureTime: "7:05 pm", ScheduledDepartureTime: "7:00 pm", ActualDepartureTime: "7:05 pm", DelayMinutes: 5, ArrivalTime: "8:45 pm", SailingStatus: "past", VesselName: "Spirit of British Columbia"},
+				{DepartureTime: "9:00 pm", ScheduledDepartureTime: "9:00 pm", SailingStatus: "future"},
+				{DepartureTime: "11:00 pm", ScheduledDepartureTime: "11:00 pm", SailingStatus: "cancelled", VesselStatus: "Cancelled due to adverse weather"},
+				{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "cancelled", IsTomorrow: true},
+			},
+		},
+		// Not in the static feed
+		{RouteCode: "TSASGI", LastUpdated: &scrapedAt, Sailings: []models.CapacitySailing{{DepartureTime: "9:00 pm", SailingStatus: "cancelled"}}},
+	}
+
+	return routes, trips, scrapedAt
+}
+
+func TestTripUpdates(t *testing.T) {
+	routes, trips, scrapedAt := realtimeFixture()
+
+	feed := decode(t, TripUpdates(routes, trips, time.Now()).Marshal())
+
+	header := feed.message(t, 1, 0)
+	if header.string(1) != "2.0" || header.varint(3) != scrapedAt.Unix() {
+		t.Errorf("header = %v", header)
+	}
+
+	if len(feed[2]) != 3 {
+		t.Fatalf("got %d entities, want 3", len(feed[2]))
+	}
+
+	// Departed late, arrived 10 minutes after the scheduled 8:35 pm
+	entity := feed.message(t, 2, 0)
+	if entity.string(1) != "TSASWB-1900:20240601" {
+		t.Errorf("entity id = %q", entity.string(1))
+	}
+	update := entity.message(t, 3, 0)
+	trip := update.message(t, 1, 0)
+	if trip.string(1) != "TSASWB-1900" || trip.string(3) != "20240601" || trip.string(5) != "TSASWB" || len(trip[4]) != 0 {
+		t.Errorf("trip = %v", trip)
+	}
+	if vehicle := update.message(t, 3, 0); vehicle.string(2) != "Spirit of British Columbia" {
+		t.Errorf("vehicle = %v", vehicle)
+	}
+	departure := update.message(t, 2, 0)
+	if departure.varint(1) != 1 || departure.string(4) != "TSA" {
+		t.Errorf("departure stop time update = %v", departure)
+	}
+	if event := departure.message(t, 3, 0); event.varint(1) != 300 || event.varint(2) != time.Date(2024, 6, 1, 19, 5, 0, 0, sailingtime.Location()).Unix() {
+		t.Errorf("departure = %v", event)
+	}
+	arrival := update.message(t, 2, 1)
+	if event := arrival.message(t, 2, 0); arrival.string(4) != "SWB" || event.varint(1) != 600 {
+		t.Errorf("arrival = %v", event)
+	}
+
+	// Cancelled tonight and tomorrow; the 9:00 pm has nothing to report
+	for i, want := range []string{"TSASWB-2300:20240601", "TSASWB-0700:20240602"} {
+		entity := feed.message(t, 2, i+1)
+		trip := entity.message(t, 3, 0).message(t, 1, 0)
+		if entity.string(1) != want || trip.varint(4) != 3 {
+			t.Errorf("entity %d = %q, schedule relationship %d; want %q, CANCELED", i+1, entity.string(1), trip.varint(4), want)
+		}
+	}
+}
+
+func TestTripUpdatesNegativeDelay(t *testing.T) {
+	routes, trips, _ := realtimeFixture()
+	routes[0].Sailings = []models.CapacitySailing{
+		{DepartureTime: "6:58 pm", ScheduledDepartureTime: "7:00 pm", ActualDepartureTime: "6:58 pm", DelayMinutes: -2, SailingStatus: "current"},
+	}
+
+	feed := decode(t, TripUpdates(routes, trips, time.Now()).Marshal())
+	event := feed.message(t, 2, 0).message(t, 3, 0).message(t, 2, 0).message(t, 3, 0)
+	if event.varint(1) != -120 {
+		t.Errorf("delay = %d, want -120", event.varint(1))
+	}
+}
+
+func TestTripUpdatesInactiveService(t *testing.T) {
+	routes, trips, scrapedAt := realtimeFixture()
+
+	// The static schedule was last scraped a week before, so its service ends on the capacity scrape's day
+	for id, trip := range trips {
+		trip.FirstDay = trip.FirstDay.AddDate(0, 0, -serviceDays+1)
+		trip.LastDay = trip.LastDay.AddDate(0, 0, -serviceDays+1)
+		trips[id] = trip
+	}
+
+	feed := decode(t, TripUpdates(routes, trips, scrapedAt).Marshal())
+	if len(feed[2]) != 2 {
+		t.Fatalf("got %d entities, want 2", len(feed[2]))
+	}
+	for i := range feed[2] {
+		if id := feed.message(t, 2, i).string(1); id == "TSASWB-0700:20240602" {
+			t.Errorf("got update %q for a day the static service doesn't run", id)
+		}
+	}
+}
+
+func TestServiceAlerts(t *testing.T) {
+	routes, trips, _ := realtimeFixture()
+
+	feed := decode(t, ServiceAlerts(routes, trips, time.Now()).Marshal())
+
+	if len(feed[2]) != 2 {
+		t.Fatalf("got %d entities, want 2", len(feed[2]))
+	}
+
+	entity := feed.message(t, 2, 0)
+	if entity.string(1) != "cancelled:TSASWB-2300:20240601" {
+		t.Errorf("entity id = %q", entity.string(1))
+	}
+	alert := entity.message(t, 5, 0)
+	if alert.varint(6) != CauseWeather || alert.varint(7) != EffectNoService {
+		t.Errorf("cause = %d, effect = %d", alert.varint(6), alert.varint(7))
+	}
+
+	period := alert.message(t, 1, 0)
+	loc := sailingtime.Location()
+	if period.varint(1) != time.Date(2024, 6, 1, 23, 0, 0, 0, loc).Unix() || period.varint(2) != time.Date(2024, 6, 2, 0, 35, 0, 0, loc).Unix() {
+		t.Errorf("active period = %v", period)
+	}
+
+	informed := alert.message(t, 5, 0)
+	if informed.string(1) != AgencyID || informed.string(2) != "TSASWB" || informed.message(t, 4, 0).string(1) != "TSASWB-2300" {
+		t.Errorf("informed entity = %v", informed)
+	}
+
+	header := alert.message(t, 10, 0).message(t, 1, 0)
+	if header.string(1) != "TSASWB 11:00 pm sailing on 2024-06-01 cancelled" || header.string(2) != "en" {
+		t.Errorf("header = %v", header)
+	}
+	if description := alert.message(t, 11, 0).message(t, 1, 0); description.string(1) != "Cancelled due to adverse weather" {
+		t.Errorf("description = %v", description)
+	}
+
+	if alert := feed.message(t, 2, 1).message(t, 5, 0); alert.varint(6) != CauseUnknown || len(alert[11]) != 0 {
+		t.Errorf("alert without status = %v", alert)
+	}
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // For shared structs
 
 /**************/
@@ -12,17 +17,23 @@ type CapacityRoute struct {
 	ToTerminalCode   string            `json:"toTerminalCode"`
 	SailingDuration  string            `json:"sailingDuration"`
 	Sailings         []CapacitySailing `json:"sailings"`
+	LastUpdated      *time.Time        `json:"lastUpdated"`
+	IsStale          bool              `json:"isStale"`
 }
 
 type CapacitySailing struct {
-	DepartureTime string `json:"time"`
-	ArrivalTime   string `json:"arrivalTime"`
-	SailingStatus string `json:"sailingStatus"`
-	Fill          int    `json:"fill"`
-	CarFill       int    `json:"carFill"`
-	OversizeFill  int    `json:"oversizeFill"`
-	VesselName    string `json:"vesselName"`
-	VesselStatus  string `json:"vesselStatus"`
+	DepartureTime          string `json:"time"` // Actual departure once departed, otherwise scheduled
+	ScheduledDepartureTime string `json:"scheduledDepartureTime"`
+	ActualDepartureTime    string `json:"actualDepartureTime"` // Empty until departed
+	DelayMinutes           int    `json:"delayMinutes"`        // Actual minus scheduled departure, 0 until departed
+	ArrivalTime            string `json:"arrivalTime"`
+	SailingStatus          string `json:"sailingStatus"`
+	Fill                   int    `json:"fill"`
+	CarFill                int    `json:"carFill"`
+	OversizeFill           int    `json:"oversizeFill"`
+	VesselName             string `json:"vesselName"`
+	VesselStatus           string `json:"vesselStatus"`
+	IsTomorrow             bool   `json:"-"` // Marked "(Tomorrow)" on the page; only exposed through v3 timestamps
 }
 
 type NonCapacityResponse struct {
@@ -35,6 +46,8 @@ type NonCapacityRoute struct {
 	ToTerminalCode   string               `json:"toTerminalCode"`
 	SailingDuration  string               `json:"sailingDuration"`
 	Sailings         []NonCapacitySailing `json:"sailings"`
+	LastUpdated      *time.Time           `json:"lastUpdated"`
+	IsStale          bool                 `json:"isStale"`
 }
 
 type NonCapacitySailing struct {
@@ -44,6 +57,18 @@ type NonCapacitySailing struct {
 	VesselStatus  string `json:"vesselStatus"`
 }
 
+// SailingFilter narrows the sailings a route is read with. Status and
+// MinAvailable only apply to capacity sailings. Times are compared with the
+// scheduled departure, and tomorrow's sailings are after any time today.
+type SailingFilter struct {
+	Statuses     []string // capacity sailing statuses to keep, e.g. "future"
+	After        int      // keep departures at or after this many minutes past midnight today, -1 for any
+	Before       int      // keep departures at or before this many minutes past midnight today, -1 for any
+	Vessel       string   // vessel name, case-insensitive
+	MinAvailable int      // minimum percentage of space left on future capacity sailings
+	Limit        int      // maximum sailings per route, 0 for all
+}
+
 /**************/
 /* V1 Structs */
 /**************/
@@ -63,3 +88,278 @@ type Sailing struct {
 	VesselName    string `json:"vesselName"`
 	VesselStatus  string `json:"vesselStatus"`
 }
+
+/**********************/
+/* Scrape Run Structs */
+/**********************/
+
+// Scrape jobs
+const (
+	CapacityJob    = "capacity"
+	NonCapacityJob = "noncapacity"
+)
+
+// Scrape run statuses
+const (
+	RunSucceeded = "succeeded"
+	RunPartial   = "partial"
+	RunFailed    = "failed"
+)
+
+// Per-route scrape outcomes
+const (
+	OutcomeOK          = "ok"
+	OutcomeSkipped     = "skipped"
+	OutcomeFetchFailed = "fetch_failed"
+	OutcomeParseFailed = "parse_failed"
+	OutcomeSaveFailed  = "save_failed"
+)
+
+type ScrapeRun struct {
+	ID         int64               `json:"id"`
+	Job        string              `json:"job"`
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+	Status     string              `json:"status"`
+	Routes     []RouteScrapeResult `json:"routes,omitempty"`
+}
+
+type RouteScrapeResult struct {
+	RouteCode    string    `json:"routeCode"`
+	Outcome      string    `json:"outcome"`
+	HTTPStatus   int       `json:"httpStatus,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	WarningCount int       `json:"warningCount"`
+	SailingCount int       `json:"sailingCount"`
+	ScrapedAt    time.Time `json:"scrapedAt"`
+
+	// What changed since the previous scrape, for webhook subscribers. Not stored
+	Changes     []ServiceChange `json:"-"`
+	FillChanges []FillChange    `json:"-"`
+}
+
+type RouteScrapeStatus struct {
+	Job           string            `json:"job"`
+	LastAttempt   RouteScrapeResult `json:"lastAttempt"`
+	LastSuccessAt *time.Time        `json:"lastSuccessAt"`
+}
+
+/****************************/
+/* Capacity History Structs */
+/****************************/
+
+// A single scrape's view of how full a scheduled sailing was
+type CapacityObservation struct {
+	RouteCode     string    `json:"routeCode"`
+	SailingDate   string    `json:"sailingDate"` // YYYY-MM-DD in America/Vancouver
+	DepartureTime string    `json:"time"`
+	ObservedAt    time.Time `json:"observedAt"`
+	SailingStatus string    `json:"sailingStatus"`
+	Fill          int       `json:"fill"`
+	CarFill       int       `json:"carFill"`
+	OversizeFill  int       `json:"oversizeFill"`
+	VesselName    string    `json:"vesselName"`
+}
+
+// Fill levels seen for one sailing at one point in time
+type FillSnapshot struct {
+	ObservedAt   time.Time `json:"observedAt"`
+	Fill         int       `json:"fill"`
+	CarFill      int       `json:"carFill"`
+	OversizeFill int       `json:"oversizeFill"`
+	VesselName   string    `json:"vesselName"`
+}
+
+// How a scheduled departure filled up, oldest observation first
+type SailingHistory struct {
+	RouteCode     string         `json:"routeCode"`
+	SailingDate   string         `json:"sailingDate"`
+	DepartureTime string         `json:"time"`
+	Observations  []FillSnapshot `json:"observations"`
+}
+
+/********************/
+/* Forecast Structs */
+/********************/
+
+type RouteForecast struct {
+	RouteCode   string            `json:"routeCode"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	Sailings    []SailingForecast `json:"sailings"`
+}
+
+// Chance an upcoming sailing fills up, estimated from past departures
+type SailingForecast struct {
+	SailingDate     string     `json:"sailingDate"`
+	DepartureTime   string     `json:"time"`
+	Fill            int        `json:"fill"`
+	FullProbability *float64   `json:"fullProbability"` // nil when there is no history
+	ExpectedFullAt  *time.Time `json:"expectedFullAt"`  // nil unless likely to fill
+	SampleSize      int        `json:"sampleSize"`
+	Basis           string     `json:"basis,omitempty"` // "weekday" or "all days"
+}
+
+/*************************/
+/* On-Time Stats Structs */
+/*************************/
+
+// Departure record outcomes
+const (
+	DepartureDeparted  = "departed"
+	DepartureCancelled = "cancelled"
+)
+
+// How a scheduled capacity sailing turned out, as last seen by the scraper
+type DepartureRecord struct {
+	RouteCode              string    `json:"routeCode"`
+	SailingDate            string    `json:"sailingDate"` // YYYY-MM-DD in America/Vancouver
+	ScheduledDepartureTime string    `json:"scheduledDepartureTime"`
+	Outcome                string    `json:"outcome"`
+	ActualDepartureTime    string    `json:"actualDepartureTime"`
+	DelayMinutes           int       `json:"delayMinutes"`
+	ArrivalTime            string    `json:"arrivalTime"` // Empty until arrived
+	VesselName             string    `json:"vesselName"`
+	RecordedAt             time.Time `json:"recordedAt"`
+}
+
+type OnTimeStats struct {
+	From             string          `json:"from"` // First sailing date included
+	To               string          `json:"to"`   // Last sailing date included
+	ThresholdMinutes int             `json:"thresholdMinutes"`
+	Overall          OnTimeSummary   `json:"overall"`
+	Routes           []OnTimeSummary `json:"routes"`
+	Vessels          []OnTimeSummary `json:"vessels"`
+}
+
+// On-time performance of a route, a vessel or everything. Rates are nil when
+// there are no sailings to base them on.
+type OnTimeSummary struct {
+	RouteCode        string   `json:"routeCode,omitempty"`
+	VesselName       string   `json:"vesselName,omitempty"`
+	Sailings         int      `json:"sailings"`
+	Departed         int      `json:"departed"`
+	OnTime           int      `json:"onTime"`
+	Cancelled        int      `json:"cancelled"`
+	OnTimePercent    *float64 `json:"onTimePercent"`
+	MeanDelayMinutes *float64 `json:"meanDelayMinutes"`
+	P90DelayMinutes  *float64 `json:"p90DelayMinutes"`
+	CancellationRate *float64 `json:"cancellationRate"` // 0 to 1
+}
+
+/************************/
+/* Cancellation Structs */
+/************************/
+
+// A cancelled sailing, from the first scrape that saw it cancelled to the last
+type CancellationEvent struct {
+	RouteCode              string    `json:"routeCode"`
+	SailingDate            string    `json:"sailingDate"` // YYYY-MM-DD in America/Vancouver
+	ScheduledDepartureTime string    `json:"scheduledDepartureTime"`
+	VesselName             string    `json:"vesselName"`
+	Reason                 string    `json:"reason"`
+	FirstSeenAt            time.Time `json:"firstSeenAt"`
+	LastSeenAt             time.Time `json:"lastSeenAt"`
+}
+
+/**************************/
+/* Service Change Structs */
+/**************************/
+
+// Kinds of service change
+const (
+	ChangeCancelled     = "cancelled"
+	ChangeAdded         = "added"
+	ChangeRemoved       = "removed"
+	ChangeVesselChanged = "vessel_changed"
+	ChangeStatusChanged = "status_changed"
+)
+
+// A difference between two scrapes of a route that riders would want to know about
+type ServiceChange struct {
+	ID            int64     `json:"id"`
+	RouteCode     string    `json:"routeCode"`
+	Kind          string    `json:"kind"`
+	SailingDate   string    `json:"sailingDate"` // YYYY-MM-DD in America/Vancouver
+	DepartureTime string    `json:"time"`
+	Previous      string    `json:"previous,omitempty"` // Old vessel or status text
+	Current       string    `json:"current,omitempty"`  // New vessel or status text
+	Summary       string    `json:"summary"`
+	DetectedAt    time.Time `json:"detectedAt"`
+}
+
+/**************************/
+/* Sailing Update Structs */
+/**************************/
+
+// Sailing update types, from consecutive scrapes of a capacity sailing
+const (
+	SailingUpdated   = "sailing_updated"
+	SailingCancelled = "sailing_cancelled"
+	SailingDeparted  = "sailing_departed"
+	SailingArrived   = "sailing_arrived"
+)
+
+// A capacity sailing that changed between two scrapes
+type SailingUpdate struct {
+	Type        string           `json:"type"`
+	RouteCode   string           `json:"routeCode"`
+	SailingDate string           `json:"sailingDate"` // YYYY-MM-DD in America/Vancouver
+	Sailing     CapacitySailing  `json:"sailing"`
+	Previous    *CapacitySailing `json:"previous"` // Null for a sailing that wasn't listed before
+	DetectedAt  time.Time        `json:"detectedAt"`
+}
+
+/************************/
+/* Subscription Structs */
+/************************/
+
+// Webhook event types, besides the service change kinds
+const (
+	EventFillThreshold = "fill_threshold"
+)
+
+// A webhook an integrator registered to hear about changes to capacity routes
+type Subscription struct {
+	ID            int64     `json:"id"`
+	URL           string    `json:"url"`
+	Secret        string    `json:"secret,omitempty"` // Signs deliveries; only returned when the subscription is created
+	RouteCodes    []string  `json:"routeCodes"`       // Empty for every capacity route
+	EventTypes    []string  `json:"eventTypes"`
+	FillThreshold int       `json:"fillThreshold,omitempty"` // Percent full at which fill_threshold fires
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// A capacity sailing whose fill changed between two scrapes
+type FillChange struct {
+	RouteCode     string    `json:"routeCode"`
+	SailingDate   string    `json:"sailingDate"` // YYYY-MM-DD in America/Vancouver
+	DepartureTime string    `json:"time"`
+	VesselName    string    `json:"vesselName"`
+	PreviousFill  int       `json:"previousFill"`
+	CurrentFill   int       `json:"currentFill"`
+	DetectedAt    time.Time `json:"detectedAt"`
+}
+
+// The body of a webhook delivery
+type WebhookEvent struct {
+	ID         string         `json:"id"` // The same on every retry
+	Type       string         `json:"type"`
+	RouteCode  string         `json:"routeCode"`
+	OccurredAt time.Time      `json:"occurredAt"`
+	Change     *ServiceChange `json:"change,omitempty"`
+	Fill       *FillChange    `json:"fill,omitempty"`
+	Threshold  int            `json:"threshold,omitempty"` // For fill_threshold events
+}
+
+// A webhook delivery that still failed after every retry
+type DeadLetter struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscriptionId"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastStatus     int             `json:"lastStatus,omitempty"` // HTTP status of the last attempt, 0 if there was no response
+	LastError      string          `json:"lastError"`
+	FailedAt       time.Time       `json:"failedAt"`
+}
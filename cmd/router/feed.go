@@ -0,0 +1,229 @@
+package router
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/staticdata"
+)
+
+// feedLength is how many of the most recent service changes a feed lists
+const feedLength = 50
+
+/********/
+/* Atom */
+/********/
+
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    AtomLink    `xml:"link"`
+	Author  AtomAuthor  `xml:"author"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type AtomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Category AtomCategory `xml:"category"`
+	Summary  string       `xml:"summary"`
+}
+
+/*******/
+/* RSS */
+/*******/
+
+type RSSFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []RSSItem `xml:"item"`
+}
+
+type RSSGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type RSSItem struct {
+	Title       string  `xml:"title"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category"`
+	GUID        RSSGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+/*
+ * GetServiceChangesFeed
+ *
+ * Returns the most recent service changes detected between scrapes, such as
+ * cancellations, added sailings and vessel swaps, as an Atom or RSS 2.0 feed.
+ * The format is `atom` or `rss`; the optional route code limits the feed to one
+ * route
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetServiceChangesFeed(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	format := strings.ToLower(ps.ByName("format"))
+	if format != "atom" && format != "rss" {
+		writeError(w, http.StatusNotFound, ErrInvalidFormat, "Unknown feed format "+format+", expected atom or rss")
+		return
+	}
+
+	routeCode := strings.ToUpper(ps.ByName("routeCode"))
+	title := "BC Ferries service changes"
+	if routeCode != "" {
+		fromTerminal, toTerminal, ok := staticdata.SplitRouteCode(routeCode)
+		if !ok || (!staticdata.IsCapacityRoute(fromTerminal, toTerminal) && !staticdata.IsNonCapacityRoute(fromTerminal, toTerminal)) {
+			writeError(w, http.StatusNotFound, ErrRouteNotFound, "No route "+routeCode)
+			return
+		}
+		title += " for " + routeCode
+	}
+
+	changes := db.GetServiceChanges(routeCode, feedLength)
+	link := requestURL(r)
+
+	var body interface{}
+	if format == "atom" {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		body = atomFeed(title, link, changes)
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		body = rssFeed(title, link, changes)
+	}
+
+	xmlString, _ := xml.MarshalIndent(body, "", "  ")
+	w.Write([]byte(xml.Header))
+	w.Write(xmlString)
+}
+
+/*
+ * atomFeed
+ *
+ * @param string title
+ * @param string link - URL the feed was requested from
+ * @param []models.ServiceChange changes - newest first
+ *
+ * @return AtomFeed
+ */
+func atomFeed(title string, link string, changes []models.ServiceChange) AtomFeed {
+	feed := AtomFeed{
+		ID:      link,
+		Title:   title,
+		Updated: feedUpdated(changes).Format(time.RFC3339),
+		Link:    AtomLink{Href: link, Rel: "self"},
+		Author:  AtomAuthor{Name: "BC Ferries API"},
+		Entries: []AtomEntry{},
+	}
+
+	for _, change := range changes {
+		feed.Entries = append(feed.Entries, AtomEntry{
+			ID:       changeID(change),
+			Title:    change.Summary,
+			Updated:  change.DetectedAt.UTC().Format(time.RFC3339),
+			Category: AtomCategory{Term: change.Kind},
+			Summary:  changeDescription(change),
+		})
+	}
+
+	return feed
+}
+
+/*
+ * rssFeed
+ *
+ * @param string title
+ * @param string link - URL the feed was requested from
+ * @param []models.ServiceChange changes - newest first
+ *
+ * @return RSSFeed
+ */
+func rssFeed(title string, link string, changes []models.ServiceChange) RSSFeed {
+	channel := RSSChannel{
+		Title:         title,
+		Link:          link,
+		Description:   "Cancellations, added and removed sailings, vessel swaps and status changes detected on BC Ferries routes",
+		LastBuildDate: feedUpdated(changes).Format(time.RFC1123Z),
+		Items:         []RSSItem{},
+	}
+
+	for _, change := range changes {
+		channel.Items = append(channel.Items, RSSItem{
+			Title:       change.Summary,
+			Description: changeDescription(change),
+			Category:    change.Kind,
+			GUID:        RSSGUID{IsPermaLink: "false", Value: changeID(change)},
+			PubDate:     change.DetectedAt.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return RSSFeed{Version: "2.0", Channel: channel}
+}
+
+// feedUpdated is when the newest change was detected, or now for an empty feed
+func feedUpdated(changes []models.ServiceChange) time.Time {
+	if len(changes) == 0 {
+		return time.Now().UTC()
+	}
+	return changes[0].DetectedAt.UTC()
+}
+
+// changeID identifies a change across every feed it appears in
+func changeID(change models.ServiceChange) string {
+	return "urn:bc-ferries-api:service-change:" + strconv.FormatInt(change.ID, 10)
+}
+
+// changeDescription is the summary with what the sailing changed from and to
+func changeDescription(change models.ServiceChange) string {
+	description := change.Summary
+	if change.Previous != "" && change.Current != "" {
+		description += " (was: " + change.Previous + ", now: " + change.Current + ")"
+	}
+	return description
+}
+
+// requestURL rebuilds the absolute URL of r, honouring a TLS terminating proxy
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
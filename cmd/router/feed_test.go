@@ -0,0 +1,54 @@
+package router
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestGetServiceChangesFeed(t *testing.T) {
+	db.SetStore(db.NewMemoryStore())
+	detectedAt := time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)
+	if err := db.SaveServiceChanges([]models.ServiceChange{
+		{RouteCode: "TSASWB", Kind: models.ChangeCancelled, SailingDate: "2024-06-01", DepartureTime: "3:00 pm", Summary: "TSASWB 3:00 pm sailing on 2024-06-01 cancelled", DetectedAt: detectedAt},
+		{RouteCode: "SWBTSA", Kind: models.ChangeVesselChanged, SailingDate: "2024-06-01", DepartureTime: "5:00 pm", Previous: "Queen of Oak Bay", Current: "Queen of Cowichan", Summary: "SWBTSA 5:00 pm sailing on 2024-06-01 vessel changed", DetectedAt: detectedAt.Add(time.Minute)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := SetupRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/feed/atom", nil))
+	if got := rec.Header().Get("Content-Type"); got != "application/atom+xml; charset=utf-8" {
+		t.Errorf("atom Content-Type = %q", got)
+	}
+	var atom AtomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &atom); err != nil {
+		t.Fatal(err)
+	}
+	if len(atom.Entries) != 2 || atom.Entries[0].Category.Term != models.ChangeVesselChanged || atom.Updated != "2024-06-01T22:01:00Z" {
+		t.Errorf("atom feed = %+v", atom)
+	}
+	if atom.Entries[0].Summary != "SWBTSA 5:00 pm sailing on 2024-06-01 vessel changed (was: Queen of Oak Bay, now: Queen of Cowichan)" {
+		t.Errorf("atom summary = %q", atom.Entries[0].Summary)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/feed/rss/tsaswb", nil))
+	if got := rec.Header().Get("Content-Type"); got != "application/rss+xml; charset=utf-8" {
+		t.Errorf("rss Content-Type = %q", got)
+	}
+	var rss RSSFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &rss); err != nil {
+		t.Fatal(err)
+	}
+	if len(rss.Channel.Items) != 1 || rss.Channel.Items[0].GUID.Value != atom.Entries[1].ID || rss.Channel.Items[0].PubDate != "Sat, 01 Jun 2024 22:00:00 +0000" {
+		t.Errorf("rss feed = %+v", rss)
+	}
+}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+// allSailings is the filter that keeps every sailing
+var allSailings = models.SailingFilter{After: -1, Before: -1}
+
+// sailingStatuses are the capacity sailing statuses the status filter accepts
+var sailingStatuses = []string{"future", "current", "past", "cancelled"}
+
+/*
+ * parseSailingFilter
+ *
+ * Reads a models.SailingFilter from the query parameters status (comma separated),
+ * after, before, vessel, minAvailable and limit. after and before are times
+ * today, so tomorrow's sailings are after any of them.
+ *
+ * @param url.Values query
+ *
+ * @return models.SailingFilter
+ * @return error - describes the first invalid parameter
+ */
+func parseSailingFilter(query url.Values) (models.SailingFilter, error) {
+	filter := allSailings
+
+	if status := query.Get("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "" {
+				continue
+			}
+			if !contains(sailingStatuses, s) {
+				return filter, fmt.Errorf("Invalid status %s, expected one of %s", s, strings.Join(sailingStatuses, ", "))
+			}
+			filter.Statuses = append(filter.Statuses, s)
+		}
+	}
+
+	for _, name := range []string{"after", "before"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		minutes, ok := departureMinutes(value)
+		if !ok {
+			return filter, fmt.Errorf("Invalid %s, expected e.g. 2:00 pm or 14:00", name)
+		}
+		if name == "after" {
+			filter.After = minutes
+		} else {
+			filter.Before = minutes
+		}
+	}
+
+	filter.Vessel = strings.TrimSpace(query.Get("vessel"))
+
+	if value := query.Get("minAvailable"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 100 {
+			return filter, errors.New("Invalid minAvailable, expected a percentage from 0 to 100")
+		}
+		filter.MinAvailable = n
+	}
+
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return filter, errors.New("Invalid limit, expected a positive number")
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+// capacityOnly reports whether the filter uses status or minAvailable, which only capacity sailings have
+func capacityOnly(filter models.SailingFilter) bool {
+	return len(filter.Statuses) > 0 || filter.MinAvailable > 0
+}
+
+// filtersSailings reports whether the filter can leave out any sailings
+func filtersSailings(filter models.SailingFilter) bool {
+	return capacityOnly(filter) || filter.After >= 0 || filter.Before >= 0 || filter.Vessel != "" || filter.Limit > 0
+}
+
+// departureMinutes returns a time of day as minutes past midnight
+func departureMinutes(s string) (int, bool) {
+	normalized, ok := normalizeDepartureTime(s)
+	if !ok {
+		return 0, false
+	}
+	return sailingtime.ClockMinutes(normalized)
+}
@@ -0,0 +1,40 @@
+package router
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestParseSailingFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  models.SailingFilter
+	}{
+		{"", models.SailingFilter{After: -1, Before: -1}},
+		{"status=future,Cancelled", models.SailingFilter{Statuses: []string{"future", "cancelled"}, After: -1, Before: -1}},
+		{"after=13:00&before=5:00pm", models.SailingFilter{After: 780, Before: 1020}},
+		{"vessel=+spirit+of+british+columbia", models.SailingFilter{After: -1, Before: -1, Vessel: "spirit of british columbia"}},
+		{"minAvailable=20&limit=1", models.SailingFilter{After: -1, Before: -1, MinAvailable: 20, Limit: 1}},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		got, err := parseSailingFilter(query)
+		if err != nil {
+			t.Fatalf("parseSailingFilter(%q): %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSailingFilter(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"after=noon", "minAvailable=120", "limit=0", "status=bogus", "status=future,bogus"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseSailingFilter(values); err == nil {
+			t.Errorf("parseSailingFilter(%q) succeeded, want error", query)
+		}
+	}
+}
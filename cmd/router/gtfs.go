@@ -0,0 +1,89 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/gtfs"
+)
+
+/*
+ * GetGTFS
+ *
+ * Returns the non-capacity schedules as a GTFS static feed zip, for trip
+ * planners that only read GTFS. Each route's service covers the week from
+ * the day it was last scraped
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetGTFS(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	routes := db.GetNonCapacitySailings()
+	if len(routes) == 0 {
+		writeError(w, http.StatusServiceUnavailable, ErrNoData, "No schedule data yet")
+		return
+	}
+
+	feed, err := gtfs.Build(routes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, "Could not build GTFS feed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="gtfs.zip"`)
+	w.Write(feed)
+}
+
+/*
+ * GetGTFSRealtimeTripUpdates
+ *
+ * Returns a GTFS-Realtime TripUpdates feed, as protobuf, of capacity sailings
+ * that are cancelled, have left or have an arrival time or ETA. Trip IDs match
+ * /v2/gtfs.zip
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetGTFSRealtimeTripUpdates(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/x-protobuf")
+
+	trips := gtfs.StaticTrips(db.GetNonCapacitySailings())
+	feed := gtfs.TripUpdates(db.GetCapacitySailings(), trips, time.Now())
+
+	w.Write(feed.Marshal())
+}
+
+/*
+ * GetGTFSRealtimeAlerts
+ *
+ * Returns a GTFS-Realtime ServiceAlerts feed, as protobuf, with an alert for
+ * each cancelled capacity sailing. Trip IDs match /v2/gtfs.zip
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetGTFSRealtimeAlerts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/x-protobuf")
+
+	trips := gtfs.StaticTrips(db.GetNonCapacitySailings())
+	feed := gtfs.ServiceAlerts(db.GetCapacitySailings(), trips, time.Now())
+
+	w.Write(feed.Marshal())
+}
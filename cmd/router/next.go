@@ -0,0 +1,145 @@
+package router
+
+import (
+	"sort"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/forecast"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+// Where a NextSailing's details came from
+const (
+	SourceCapacity = "capacity"
+	SourceSchedule = "schedule"
+)
+
+/*
+ * nextSailings
+ *
+ * Returns the next count departures of a route after now, soonest first.
+ *
+ * Sailings come from the non capacity schedule, with fill and status from the
+ * capacity route where it has the same scheduled departure. Departures only in
+ * the capacity data are included, and ones it reports as cancelled or already
+ * gone are dropped. Either route may be nil.
+ *
+ * Capacity sailings are on the day they were scraped, or the next if marked
+ * as tomorrow's, so one running late is still today's until it leaves. The
+ * schedule only has times of day, so a scheduled sailing whose time has already
+ * passed is taken to be tomorrow's.
+ *
+ * @param *models.CapacityRoute capacity
+ * @param *models.NonCapacityRoute schedule
+ * @param time.Time now
+ * @param *time.Location loc - zone the sailing times are in
+ * @param int count
+ *
+ * @return []NextSailing
+ */
+func nextSailings(capacity *models.CapacityRoute, schedule *models.NonCapacityRoute, now time.Time, loc *time.Location, count int) []NextSailing {
+	today := sailingtime.StartOfDay(now, loc)
+
+	// Keyed by departure date and scheduled time
+	byDeparture := make(map[string]*NextSailing)
+	skip := make(map[string]bool)
+
+	if capacity != nil {
+		scrapedAt := now
+		if capacity.LastUpdated != nil {
+			scrapedAt = *capacity.LastUpdated
+		}
+		scrapeDay := sailingtime.StartOfDay(scrapedAt, loc)
+
+		for _, sailing := range capacity.Sailings {
+			day := scrapeDay
+			if sailing.IsTomorrow {
+				day = day.AddDate(0, 0, 1)
+			}
+
+			scheduledTime := sailing.ScheduledDepartureTime
+			if scheduledTime == "" {
+				scheduledTime = sailing.DepartureTime
+			}
+			key := day.Format("2006-01-02") + " " + scheduledTime
+
+			if sailing.SailingStatus != "future" {
+				skip[key] = true
+				continue
+			}
+			if day.Before(today) {
+				continue
+			}
+
+			departure, err := forecast.Departure(day.Format("2006-01-02"), scheduledTime, loc)
+			if err != nil {
+				continue
+			}
+
+			fill, carFill, oversizeFill := sailing.Fill, sailing.CarFill, sailing.OversizeFill
+			byDeparture[key] = &NextSailing{
+				Departure:     departure,
+				DepartureTime: sailing.DepartureTime,
+				ArrivalTime:   sailing.ArrivalTime,
+				SailingStatus: sailing.SailingStatus,
+				Fill:          &fill,
+				CarFill:       &carFill,
+				OversizeFill:  &oversizeFill,
+				VesselName:    sailing.VesselName,
+				Source:        SourceCapacity,
+			}
+		}
+	}
+
+	if schedule != nil {
+		for _, sailing := range schedule.Sailings {
+			day := today
+			departure, err := forecast.Departure(day.Format("2006-01-02"), sailing.DepartureTime, loc)
+			if err != nil {
+				continue
+			}
+			if departure.Before(now) {
+				day = day.AddDate(0, 0, 1)
+				if departure, err = forecast.Departure(day.Format("2006-01-02"), sailing.DepartureTime, loc); err != nil {
+					continue
+				}
+			}
+
+			key := day.Format("2006-01-02") + " " + sailing.DepartureTime
+			if skip[key] {
+				continue
+			}
+
+			if next, ok := byDeparture[key]; ok {
+				if next.ArrivalTime == "" {
+					next.ArrivalTime = sailing.ArrivalTime
+				}
+				if next.VesselName == "" {
+					next.VesselName = sailing.VesselName
+				}
+				continue
+			}
+
+			byDeparture[key] = &NextSailing{
+				Departure:     departure,
+				DepartureTime: sailing.DepartureTime,
+				ArrivalTime:   sailing.ArrivalTime,
+				VesselName:    sailing.VesselName,
+				Source:        SourceSchedule,
+			}
+		}
+	}
+
+	sailings := []NextSailing{}
+	for _, next := range byDeparture {
+		sailings = append(sailings, *next)
+	}
+
+	sort.Slice(sailings, func(i, j int) bool { return sailings[i].Departure.Before(sailings[j].Departure) })
+	if len(sailings) > count {
+		sailings = sailings[:count]
+	}
+
+	return sailings
+}
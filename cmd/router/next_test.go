@@ -0,0 +1,93 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+func TestNextSailings(t *testing.T) {
+	loc := sailingtime.Location()
+	now := time.Date(2024, 6, 1, 14, 30, 0, 0, loc)
+
+	capacity := &models.CapacityRoute{Sailings: []models.CapacitySailing{
+		{DepartureTime: "1:00 pm", SailingStatus: "past"},
+		{DepartureTime: "3:00 pm", SailingStatus: "cancelled"},
+		{DepartureTime: "5:00 pm", SailingStatus: "future", Fill: 80, VesselName: "Spirit of British Columbia"},
+	}}
+	schedule := &models.NonCapacityRoute{Sailings: []models.NonCapacitySailing{
+		{DepartureTime: "7:00 am", ArrivalTime: "8:35 am"},
+		{DepartureTime: "1:00 pm", ArrivalTime: "2:35 pm"},
+		{DepartureTime: "3:00 pm", ArrivalTime: "4:35 pm"},
+		{DepartureTime: "5:00 pm", ArrivalTime: "6:35 pm"},
+		{DepartureTime: "9:00 pm", ArrivalTime: "10:35 pm"},
+	}}
+
+	got := nextSailings(capacity, schedule, now, loc, 3)
+	if len(got) != 3 {
+		t.Fatalf("got %d sailings, want 3: %+v", len(got), got)
+	}
+
+	want := []struct {
+		departure time.Time
+		source    string
+	}{
+		{time.Date(2024, 6, 1, 17, 0, 0, 0, loc), SourceCapacity},
+		{time.Date(2024, 6, 1, 21, 0, 0, 0, loc), SourceSchedule},
+		{time.Date(2024, 6, 2, 7, 0, 0, 0, loc), SourceSchedule},
+	}
+	for i, w := range want {
+		if !got[i].Departure.Equal(w.departure) || got[i].Source != w.source {
+			t.Errorf("sailing %d = %v from %s, want %v from %s", i, got[i].Departure, got[i].Source, w.departure, w.source)
+		}
+	}
+
+	if got[0].Fill == nil || *got[0].Fill != 80 || got[0].ArrivalTime != "6:35 pm" {
+		t.Errorf("merged sailing = %+v", got[0])
+	}
+	if got[1].Fill != nil {
+		t.Errorf("schedule-only sailing has fill %d", *got[1].Fill)
+	}
+}
+
+func TestNextSailings_UsesScheduledTimesAndDays(t *testing.T) {
+	loc := sailingtime.Location()
+	now := time.Date(2024, 6, 1, 17, 10, 0, 0, loc)
+	scrapedAt := now.Add(-time.Minute)
+
+	capacity := &models.CapacityRoute{LastUpdated: &scrapedAt, Sailings: []models.CapacitySailing{
+		// Left early, so its time isn't the schedule's
+		{DepartureTime: "4:58 pm", ScheduledDepartureTime: "5:00 pm", ActualDepartureTime: "4:58 pm", SailingStatus: "current"},
+		// Running late, still today's
+		{DepartureTime: "5:05 pm", ScheduledDepartureTime: "5:05 pm", SailingStatus: "future", Fill: 90},
+		{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "cancelled", IsTomorrow: true},
+	}}
+	schedule := &models.NonCapacityRoute{Sailings: []models.NonCapacitySailing{
+		{DepartureTime: "7:00 am"},
+		{DepartureTime: "5:00 pm"},
+		{DepartureTime: "5:05 pm"},
+		{DepartureTime: "9:00 pm"},
+	}}
+
+	got := nextSailings(capacity, schedule, now, loc, 10)
+
+	want := []struct {
+		departure time.Time
+		source    string
+	}{
+		{time.Date(2024, 6, 1, 17, 5, 0, 0, loc), SourceCapacity},
+		{time.Date(2024, 6, 1, 21, 0, 0, 0, loc), SourceSchedule},
+		{time.Date(2024, 6, 2, 17, 0, 0, 0, loc), SourceSchedule},
+		{time.Date(2024, 6, 2, 17, 5, 0, 0, loc), SourceSchedule},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sailings, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if !got[i].Departure.Equal(w.departure) || got[i].Source != w.source {
+			t.Errorf("sailing %d = %v from %s, want %v from %s", i, got[i].Departure, got[i].Source, w.departure, w.source)
+		}
+	}
+}
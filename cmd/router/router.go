@@ -20,7 +20,34 @@ func SetupRouter() *httprouter.Router {
 	// V2 Routes
 	router.GET("/v2/", GetCapacityAndNonCapacitySailings)
 	router.GET("/v2/capacity/", GetCapacitySailings)
+	router.GET("/v2/capacity/:routeCode", GetCapacityRoute)
+	router.GET("/v2/capacity/:routeCode/forecast", GetCapacityForecast)
+	router.GET("/v2/capacity/:routeCode/sailings/:time/history", GetSailingHistory)
 	router.GET("/v2/noncapacity/", GetNonCapacitySailings)
+	router.GET("/v2/noncapacity/:routeCode", GetNonCapacityRoute)
+	router.GET("/v2/routes/:from/:to", GetRoute)
+	router.GET("/v2/next/:from/:to", GetNextSailings)
+	router.GET("/v2/status/", GetStatus)
+	router.GET("/v2/stats/ontime", GetOnTimeStats)
+	router.GET("/v2/cancellations", GetCancellations)
+	router.GET("/v2/feed/:format", GetServiceChangesFeed)
+	router.GET("/v2/feed/:format/:routeCode", GetServiceChangesFeed)
+	router.GET("/v2/stream", GetStream)
+	router.GET("/v2/ws", GetWebSocket)
+	router.GET("/v2/gtfs.zip", GetGTFS)
+	router.GET("/v2/gtfs-rt/trip-updates", GetGTFSRealtimeTripUpdates)
+	router.GET("/v2/gtfs-rt/alerts", GetGTFSRealtimeAlerts)
+	router.POST("/v2/subscriptions", CreateSubscription)
+	router.GET("/v2/subscriptions/:id", GetSubscription)
+	router.DELETE("/v2/subscriptions/:id", DeleteSubscription)
+	router.GET("/v2/subscriptions/:id/dead-letters", GetSubscriptionDeadLetters)
+
+	// V3 Routes
+	router.GET("/v3/", GetV3Sailings)
+	router.GET("/v3/capacity/", GetV3CapacitySailings)
+	router.GET("/v3/capacity/:routeCode", GetV3CapacityRoute)
+	router.GET("/v3/noncapacity/", GetV3NonCapacitySailings)
+	router.GET("/v3/noncapacity/:routeCode", GetV3NonCapacityRoute)
 
 	// V1 Routes
 	router.GET("/api/", GetAllSailings)
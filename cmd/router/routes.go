@@ -3,11 +3,19 @@ package router
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/config"
 	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/forecast"
 	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/scraper"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/staticdata"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/stats"
 )
 
 /**************/
@@ -23,6 +31,66 @@ type CapacityResponse struct {
 	Routes []models.CapacityRoute `json:"routes"`
 }
 
+type RouteResponse struct {
+	CapacityRoute    *models.CapacityRoute    `json:"capacityRoute,omitempty"`
+	NonCapacityRoute *models.NonCapacityRoute `json:"nonCapacityRoute,omitempty"`
+}
+
+type NextSailingsResponse struct {
+	RouteCode        string        `json:"routeCode"`
+	FromTerminalCode string        `json:"fromTerminalCode"`
+	ToTerminalCode   string        `json:"toTerminalCode"`
+	GeneratedAt      time.Time     `json:"generatedAt"`
+	Sailings         []NextSailing `json:"sailings"`
+}
+
+type NextSailing struct {
+	Departure     time.Time `json:"departure"` // RFC 3339 in America/Vancouver
+	DepartureTime string    `json:"time"`
+	ArrivalTime   string    `json:"arrivalTime"`
+	SailingStatus string    `json:"sailingStatus,omitempty"`
+	Fill          *int      `json:"fill"` // nil when only the schedule is known
+	CarFill       *int      `json:"carFill"`
+	OversizeFill  *int      `json:"oversizeFill"`
+	VesselName    string    `json:"vesselName"`
+	Source        string    `json:"source"`
+}
+
+type CancellationsResponse struct {
+	From          string                     `json:"from"`
+	To            string                     `json:"to"`
+	Cancellations []models.CancellationEvent `json:"cancellations"`
+}
+
+type ErrorResponse struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes returned in ErrorResponse.Code
+const (
+	ErrRouteNotFound = "route_not_found"
+	ErrNoData        = "no_data"
+	ErrInvalidTime   = "invalid_time"
+	ErrInvalidDate   = "invalid_date"
+	ErrInvalidFilter = "invalid_filter"
+	ErrInvalidCount  = "invalid_count"
+	ErrInvalidFormat = "invalid_format"
+
+	ErrInvalidSubscription  = "invalid_subscription"
+	ErrSubscriptionNotFound = "subscription_not_found"
+	ErrUnauthorized         = "unauthorized"
+	ErrInternal             = "internal_error"
+	ErrInvalidMessage       = "invalid_message"
+)
+
+type StatusResponse struct {
+	Upstream   scraper.BreakerStatus       `json:"upstream"`
+	LatestRuns map[string]models.ScrapeRun `json:"latestRuns"`
+	Routes     []models.RouteScrapeStatus  `json:"routes"`
+}
+
 /*************/
 /* V2 Routes */
 /*************/
@@ -39,20 +107,21 @@ type CapacityResponse struct {
  * @return void
  */
 func GetCapacityAndNonCapacitySailings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	capacityRoute := db.GetCapacitySailings()
-	nonCapacityRoute := db.GetNonCapacitySailings()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
 
 	response := AllDataResponse{
-		CapacityRoutes:    capacityRoute,
-		NonCapacityRoutes: nonCapacityRoute,
+		CapacityRoutes:    markCapacityFreshness(db.FilterCapacitySailings("", filter), time.Now()),
+		NonCapacityRoutes: markNonCapacityFreshness(db.FilterNonCapacitySailings("", filter), time.Now()),
 	}
 
 	jsonString, _ := json.Marshal(response)
-
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonString)
-
 }
 
 /*
@@ -67,23 +136,26 @@ func GetCapacityAndNonCapacitySailings(w http.ResponseWriter, r *http.Request, p
  * @return void
  */
 func GetCapacitySailings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	routes := db.GetCapacitySailings()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	routes := markCapacityFreshness(db.FilterCapacitySailings("", filter), time.Now())
 
 	response := CapacityResponse{
 		Routes: routes,
 	}
 
-	if len(response.Routes[0].Sailings) == 0 {
+	// A filter can leave a route without sailings; only an unfiltered empty route means the scrape failed
+	if len(response.Routes) == 0 || (len(response.Routes[0].Sailings) == 0 && !filtersSailings(filter)) {
 		jsonString, _ := json.Marshal("BC Ferries Data Currently Down")
-
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Content-Type", "application/json")
 		w.Write(jsonString)
 	} else {
 		jsonString, _ := json.Marshal(response)
-
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Content-Type", "application/json")
 		w.Write(jsonString)
 	}
 }
@@ -100,18 +172,446 @@ func GetCapacitySailings(w http.ResponseWriter, r *http.Request, ps httprouter.P
  * @return void
  */
 func GetNonCapacitySailings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	routes := db.GetNonCapacitySailings()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := nonCapacityFilter(w, r)
+	if !ok {
+		return
+	}
 
 	response := models.NonCapacityResponse{
-		Routes: routes,
+		Routes: markNonCapacityFreshness(db.FilterNonCapacitySailings("", filter), time.Now()),
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
+
+/*
+ * GetCapacityRoute
+ *
+ * Returns sailing data for a single capacity route, e.g. /v2/capacity/TSASWB
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetCapacityRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	route, ok := findCapacityRoute(w, strings.ToUpper(ps.ByName("routeCode")), filter)
+	if !ok {
+		return
+	}
+
+	routes := markCapacityFreshness([]models.CapacityRoute{route}, time.Now())
+	jsonString, _ := json.Marshal(routes[0])
+	w.Write(jsonString)
+}
+
+/*
+ * GetNonCapacityRoute
+ *
+ * Returns sailing data for a single non capacity route, e.g. /v2/noncapacity/SWBFUL
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetNonCapacityRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := nonCapacityFilter(w, r)
+	if !ok {
+		return
+	}
+
+	route, ok := findNonCapacityRoute(w, strings.ToUpper(ps.ByName("routeCode")), filter)
+	if !ok {
+		return
+	}
+
+	routes := markNonCapacityFreshness([]models.NonCapacityRoute{route}, time.Now())
+	jsonString, _ := json.Marshal(routes[0])
+	w.Write(jsonString)
+}
+
+/*
+ * GetRoute
+ *
+ * Returns the capacity and non capacity data for sailings between two
+ * terminals, e.g. /v2/routes/TSA/SWB. Either is omitted if BC Ferries doesn't
+ * publish it for the route
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	from := strings.ToUpper(ps.ByName("from"))
+	to := strings.ToUpper(ps.ByName("to"))
+	routeCode := from + to
+
+	isCapacity := staticdata.IsCapacityRoute(from, to)
+	isNonCapacity := staticdata.IsNonCapacityRoute(from, to)
+	if !isCapacity && !isNonCapacity {
+		writeError(w, http.StatusNotFound, ErrRouteNotFound, "No route from "+from+" to "+to)
+		return
+	}
+
+	var response RouteResponse
+	if isCapacity {
+		if routes := markCapacityFreshness(db.FilterCapacitySailings(routeCode, filter), time.Now()); len(routes) > 0 {
+			response.CapacityRoute = &routes[0]
+		}
+	}
+	if isNonCapacity {
+		if routes := markNonCapacityFreshness(db.FilterNonCapacitySailings(routeCode, filter), time.Now()); len(routes) > 0 {
+			response.NonCapacityRoute = &routes[0]
+		}
+	}
+	if response.CapacityRoute == nil && response.NonCapacityRoute == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrNoData, "No data for route "+routeCode+" yet")
+		return
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
+
+/*
+ * GetNextSailings
+ *
+ * Returns the next sailing from one terminal to another, or the next `count`
+ * (default 1, at most 50), e.g. /v2/next/TSA/SWB?count=3. Capacity data is used
+ * where BC Ferries publishes it, falling back to the non capacity schedule
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetNextSailings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	count := 1
+	if value := r.URL.Query().Get("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 50 {
+			writeError(w, http.StatusBadRequest, ErrInvalidCount, "Invalid count, expected a number from 1 to 50")
+			return
+		}
+		count = n
+	}
+
+	from := strings.ToUpper(ps.ByName("from"))
+	to := strings.ToUpper(ps.ByName("to"))
+	routeCode := from + to
+
+	isCapacity := staticdata.IsCapacityRoute(from, to)
+	isNonCapacity := staticdata.IsNonCapacityRoute(from, to)
+	if !isCapacity && !isNonCapacity {
+		writeError(w, http.StatusNotFound, ErrRouteNotFound, "No route from "+from+" to "+to)
+		return
+	}
+
+	var capacity *models.CapacityRoute
+	var schedule *models.NonCapacityRoute
+	if isCapacity {
+		if route, ok := db.GetCapacityRoute(routeCode); ok {
+			capacity = &route
+		}
+	}
+	if isNonCapacity {
+		if route, ok := db.GetNonCapacityRoute(routeCode); ok {
+			schedule = &route
+		}
+	}
+	if capacity == nil && schedule == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrNoData, "No data for route "+routeCode+" yet")
+		return
+	}
+
+	now := time.Now().In(sailingtime.Location())
+
+	response := NextSailingsResponse{
+		RouteCode:        routeCode,
+		FromTerminalCode: from,
+		ToTerminalCode:   to,
+		GeneratedAt:      now,
+		Sailings:         nextSailings(capacity, schedule, now, sailingtime.Location(), count),
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
+
+/*
+ * GetStatus
+ *
+ * Returns the health of the scraper: whether requests to bcferries.com are
+ * currently suspended by the circuit breaker, the latest run of each scrape job,
+ * and when each route was last attempted and last scraped successfully
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	response := StatusResponse{
+		Upstream:   scraper.UpstreamStatus(),
+		LatestRuns: db.GetLatestScrapeRuns(),
+		Routes:     db.GetRouteScrapeStatuses(),
+	}
+
+	jsonString, _ := json.Marshal(response)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonString)
+}
+
+/*
+ * GetOnTimeStats
+ *
+ * Returns on-time performance overall, per route and per vessel for sailings in
+ * the last `days` days (default 7, at most 365) in America/Vancouver, today
+ * included. A sailing is on time if it left at most `threshold` minutes late
+ * (default 5). `route` limits the stats to one route
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetOnTimeStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	days := 7
+	if value := query.Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 365 {
+			writeError(w, http.StatusBadRequest, ErrInvalidFilter, "Invalid days, expected a number from 1 to 365")
+			return
+		}
+		days = n
+	}
+
+	threshold := 5
+	if value := query.Get("threshold"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, ErrInvalidFilter, "Invalid threshold, expected a number of minutes")
+			return
+		}
+		threshold = n
+	}
+
+	routeCode := strings.ToUpper(query.Get("route"))
+	if routeCode != "" {
+		from, to, ok := staticdata.SplitRouteCode(routeCode)
+		if !ok || !staticdata.IsCapacityRoute(from, to) {
+			writeError(w, http.StatusNotFound, ErrRouteNotFound, "No capacity route "+routeCode)
+			return
+		}
+	}
+
+	today := time.Now().In(sailingtime.Location())
+	from := today.AddDate(0, 0, 1-days).Format("2006-01-02")
+	to := today.Format("2006-01-02")
+
+	records := db.GetDepartureRecords(from, to)
+	if routeCode != "" {
+		var routeRecords []models.DepartureRecord
+		for _, record := range records {
+			if record.RouteCode == routeCode {
+				routeRecords = append(routeRecords, record)
+			}
+		}
+		records = routeRecords
 	}
 
+	response := stats.OnTime(records, threshold)
+	response.From = from
+	response.To = to
+
 	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
 
+/*
+ * GetCancellations
+ *
+ * Returns cancelled capacity sailings and their reasons, most recently seen
+ * first. `from` and `to` (YYYY-MM-DD) select sailing dates, defaulting to the
+ * last 7 days through tomorrow in America/Vancouver; `route` limits results to
+ * one route
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetCancellations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	today := time.Now().In(sailingtime.Location())
+
+	from := today.AddDate(0, 0, -6).Format("2006-01-02")
+	to := today.AddDate(0, 0, 1).Format("2006-01-02")
+	for _, param := range []struct {
+		name string
+		date *string
+	}{{"from", &from}, {"to", &to}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			writeError(w, http.StatusBadRequest, ErrInvalidDate, "Invalid "+param.name+", expected YYYY-MM-DD")
+			return
+		}
+		*param.date = value
+	}
+	if from > to {
+		writeError(w, http.StatusBadRequest, ErrInvalidDate, "from must not be after to")
+		return
+	}
+
+	routeCode := strings.ToUpper(query.Get("route"))
+	if routeCode != "" {
+		fromTerminal, toTerminal, ok := staticdata.SplitRouteCode(routeCode)
+		if !ok || !staticdata.IsCapacityRoute(fromTerminal, toTerminal) {
+			writeError(w, http.StatusNotFound, ErrRouteNotFound, "No capacity route "+routeCode)
+			return
+		}
+	}
+
+	response := CancellationsResponse{
+		From:          from,
+		To:            to,
+		Cancellations: db.GetCancellations(from, to, routeCode),
+	}
+
+	jsonString, _ := json.Marshal(response)
 	w.Write(jsonString)
+}
 
+/*
+ * GetSailingHistory
+ *
+ * Returns how full a capacity route's scheduled departure was each time it was
+ * scraped. The departure is given as a time of day, e.g. "7:00 am" or "07:00",
+ * and the date by the optional `date` query parameter (YYYY-MM-DD, default today
+ * in America/Vancouver)
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetSailingHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	routeCode := strings.ToUpper(ps.ByName("routeCode"))
+	from, to, ok := staticdata.SplitRouteCode(routeCode)
+	if !ok || !staticdata.IsCapacityRoute(from, to) {
+		writeError(w, http.StatusNotFound, ErrRouteNotFound, "No capacity route "+routeCode)
+		return
+	}
+
+	departureTime, ok := normalizeDepartureTime(ps.ByName("time"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrInvalidTime, "Invalid departure time, expected e.g. 7:00 am or 07:00")
+		return
+	}
+
+	sailingDate := r.URL.Query().Get("date")
+	if sailingDate == "" {
+		sailingDate = time.Now().In(sailingtime.Location()).Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", sailingDate); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidDate, "Invalid date, expected YYYY-MM-DD")
+		return
+	}
+
+	jsonString, _ := json.Marshal(db.GetSailingHistory(routeCode, sailingDate, departureTime))
+	w.Write(jsonString)
+}
+
+/*
+ * GetCapacityForecast
+ *
+ * Returns, for every upcoming sailing of a capacity route, the chance it will be
+ * full by departure and when it is expected to fill, based on the route's fill
+ * history over the last FORECAST_LOOKBACK
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetCapacityForecast(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	routeCode := strings.ToUpper(ps.ByName("routeCode"))
+
+	route, ok := findCapacityRoute(w, routeCode, allSailings)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	lookback := config.ForecastLookback
+	if lookback <= 0 {
+		lookback = 8 * 7 * 24 * time.Hour
+	}
+	history := forecast.Timelines(db.GetCapacityObservationsSince(routeCode, now.Add(-lookback)), sailingtime.Location())
+
+	response := models.RouteForecast{
+		RouteCode:   routeCode,
+		GeneratedAt: now,
+		Sailings:    forecast.ForecastRoute(route, history, now, sailingtime.Location()),
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
 }
 
 /**************/
@@ -342,6 +842,204 @@ func ConvertV1ResponseToV2Response(allData AllDataResponse) map[string]map[strin
 	return schedule
 }
 
+/*
+ * markCapacityFreshness
+ *
+ * Flags capacity routes whose data is older than config.CapacityStaleAfter,
+ * or whose scrape time is unknown, as stale.
+ *
+ * @param []models.CapacityRoute routes
+ * @param time.Time now
+ *
+ * @return []models.CapacityRoute - the same slice, updated in place
+ */
+func markCapacityFreshness(routes []models.CapacityRoute, now time.Time) []models.CapacityRoute {
+	for i := range routes {
+		routes[i].IsStale = isStale(routes[i].LastUpdated, staleAfter(config.CapacityStaleAfter, 5*time.Minute), now)
+	}
+	return routes
+}
+
+/*
+ * markNonCapacityFreshness
+ *
+ * Flags non-capacity routes whose data is older than config.NonCapacityStaleAfter,
+ * or whose scrape time is unknown, as stale.
+ *
+ * @param []models.NonCapacityRoute routes
+ * @param time.Time now
+ *
+ * @return []models.NonCapacityRoute - the same slice, updated in place
+ */
+func markNonCapacityFreshness(routes []models.NonCapacityRoute, now time.Time) []models.NonCapacityRoute {
+	for i := range routes {
+		routes[i].IsStale = isStale(routes[i].LastUpdated, staleAfter(config.NonCapacityStaleAfter, 9*time.Hour), now)
+	}
+	return routes
+}
+
+/*
+ * isStale
+ *
+ * @param *time.Time lastUpdated - nil when the scrape time is unknown
+ * @param time.Duration maxAge
+ * @param time.Time now
+ *
+ * @return bool - true if lastUpdated is unknown or older than maxAge
+ */
+func isStale(lastUpdated *time.Time, maxAge time.Duration, now time.Time) bool {
+	return lastUpdated == nil || now.Sub(*lastUpdated) > maxAge
+}
+
+// staleAfter returns the configured threshold, or def when config has not been loaded
+func staleAfter(configured, def time.Duration) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	return def
+}
+
+/*
+ * normalizeDepartureTime
+ *
+ * Converts a time of day in 12 or 24 hour form ("7:00 am", "7:00AM", "07:00",
+ * "0700") into the "7:00 am" form the scraper stores.
+ *
+ * @param string s
+ *
+ * @return string
+ * @return bool - false if s is not a recognisable time
+ */
+func normalizeDepartureTime(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	for _, layout := range []string{"3:04 pm", "3:04pm", "15:04", "1504"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("3:04 pm"), true
+		}
+	}
+
+	return "", false
+}
+
+/*
+ * findCapacityRoute
+ *
+ * Looks up a capacity route with the sailings that match a filter, writing a
+ * 404 if the code isn't a capacity route or a 503 if it hasn't been scraped yet.
+ *
+ * @param http.ResponseWriter w
+ * @param string routeCode - upper case, e.g. "TSASWB"
+ * @param models.SailingFilter filter
+ *
+ * @return models.CapacityRoute
+ * @return bool - false if an error was written
+ */
+func findCapacityRoute(w http.ResponseWriter, routeCode string, filter models.SailingFilter) (models.CapacityRoute, bool) {
+	from, to, ok := staticdata.SplitRouteCode(routeCode)
+	if !ok || !staticdata.IsCapacityRoute(from, to) {
+		writeError(w, http.StatusNotFound, ErrRouteNotFound, "No capacity route "+routeCode)
+		return models.CapacityRoute{}, false
+	}
+
+	routes := db.FilterCapacitySailings(routeCode, filter)
+	if len(routes) == 0 {
+		writeError(w, http.StatusServiceUnavailable, ErrNoData, "No data for route "+routeCode+" yet")
+		return models.CapacityRoute{}, false
+	}
+	return routes[0], true
+}
+
+/*
+ * findNonCapacityRoute
+ *
+ * Looks up a non capacity route with the sailings that match a filter, writing
+ * a 404 if the code isn't a non capacity route or a 503 if it hasn't been
+ * scraped yet.
+ *
+ * @param http.ResponseWriter w
+ * @param string routeCode - upper case, e.g. "SWBFUL"
+ * @param models.SailingFilter filter
+ *
+ * @return models.NonCapacityRoute
+ * @return bool - false if an error was written
+ */
+func findNonCapacityRoute(w http.ResponseWriter, routeCode string, filter models.SailingFilter) (models.NonCapacityRoute, bool) {
+	from, to, ok := staticdata.SplitRouteCode(routeCode)
+	if !ok || !staticdata.IsNonCapacityRoute(from, to) {
+		writeError(w, http.StatusNotFound, ErrRouteNotFound, "No non capacity route "+routeCode)
+		return models.NonCapacityRoute{}, false
+	}
+
+	routes := db.FilterNonCapacitySailings(routeCode, filter)
+	if len(routes) == 0 {
+		writeError(w, http.StatusServiceUnavailable, ErrNoData, "No data for route "+routeCode+" yet")
+		return models.NonCapacityRoute{}, false
+	}
+	return routes[0], true
+}
+
+/*
+ * sailingFilter
+ *
+ * Parses the request's sailing filters, writing a 400 if they are invalid.
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ *
+ * @return models.SailingFilter
+ * @return bool - false if an error was written
+ */
+func sailingFilter(w http.ResponseWriter, r *http.Request) (models.SailingFilter, bool) {
+	filter, err := parseSailingFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidFilter, err.Error())
+		return filter, false
+	}
+	return filter, true
+}
+
+/*
+ * nonCapacityFilter
+ *
+ * Parses the request's sailing filters for an endpoint that only returns non
+ * capacity routes, writing a 400 if they are invalid or filter on status or
+ * space, which non capacity sailings don't have.
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ *
+ * @return models.SailingFilter
+ * @return bool - false if an error was written
+ */
+func nonCapacityFilter(w http.ResponseWriter, r *http.Request) (models.SailingFilter, bool) {
+	filter, ok := sailingFilter(w, r)
+	if ok && capacityOnly(filter) {
+		writeError(w, http.StatusBadRequest, ErrInvalidFilter, "status and minAvailable only apply to capacity routes")
+		return filter, false
+	}
+	return filter, ok
+}
+
+/*
+ * writeError
+ *
+ * Writes an ErrorResponse with the given HTTP status. Headers other than the
+ * status must already be set.
+ *
+ * @param http.ResponseWriter w
+ * @param int status
+ * @param string code - one of the Err* codes
+ * @param string message
+ *
+ * @return void
+ */
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.WriteHeader(status)
+	jsonString, _ := json.Marshal(ErrorResponse{Status: status, Code: code, Message: message})
+	w.Write(jsonString)
+}
+
 /*
  * contains
  *
@@ -0,0 +1,97 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestNormalizeDepartureTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"7:00 am", "7:00 am", true},
+		{"7:00AM", "7:00 am", true},
+		{" 12:15 pm ", "12:15 pm", true},
+		{"07:00", "7:00 am", true},
+		{"19:30", "7:30 pm", true},
+		{"1930", "7:30 pm", true},
+		{"noon", "", false},
+		{"25:00", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizeDepartureTime(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeDepartureTime(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRouteEndpoints(t *testing.T) {
+	db.SetStore(db.NewMemoryStore())
+	if err := db.SaveCapacityRoute(models.CapacityRoute{
+		RouteCode:        "TSASWB",
+		FromTerminalCode: "TSA",
+		ToTerminalCode:   "SWB",
+		Sailings:         []models.CapacitySailing{{DepartureTime: "7:00 am", SailingStatus: "future"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := SetupRouter()
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/v2/capacity/tsaswb", http.StatusOK, ""},
+		{"/v2/capacity/XXXYYY", http.StatusNotFound, ErrRouteNotFound},
+		{"/v2/capacity/SWBTSA", http.StatusServiceUnavailable, ErrNoData},
+		{"/v2/noncapacity/TSASWB", http.StatusServiceUnavailable, ErrNoData},
+		{"/v2/noncapacity/TSANAN", http.StatusNotFound, ErrRouteNotFound},
+		{"/v2/capacity/?status=bogus", http.StatusBadRequest, ErrInvalidFilter},
+		{"/v2/noncapacity/?minAvailable=10", http.StatusBadRequest, ErrInvalidFilter},
+		{"/v2/noncapacity/TSASWB?status=future", http.StatusBadRequest, ErrInvalidFilter},
+		{"/v2/routes/TSA/SWB", http.StatusOK, ""},
+		{"/v2/routes/TSA/NAN", http.StatusNotFound, ErrRouteNotFound},
+		{"/v2/capacity/XXXYYY/forecast", http.StatusNotFound, ErrRouteNotFound},
+		{"/v2/capacity/TSANAN/sailings/7:00%20am/history", http.StatusNotFound, ErrRouteNotFound},
+		{"/v2/stats/ontime?route=TSASWB&days=30", http.StatusOK, ""},
+		{"/v2/stats/ontime?days=0", http.StatusBadRequest, ErrInvalidFilter},
+		{"/v2/cancellations?from=2024-06-01&to=2024-06-30", http.StatusOK, ""},
+		{"/v2/cancellations?from=2024-06-30&to=2024-06-01", http.StatusBadRequest, ErrInvalidDate},
+		{"/v2/feed/atom", http.StatusOK, ""},
+		{"/v2/feed/rss/tsanan", http.StatusNotFound, ErrRouteNotFound},
+		{"/v2/feed/json", http.StatusNotFound, ErrInvalidFormat},
+		{"/v2/stream?route=TSASWB,TSANAN", http.StatusNotFound, ErrRouteNotFound},
+		{"/v2/gtfs.zip", http.StatusServiceUnavailable, ErrNoData},
+		{"/v2/gtfs-rt/trip-updates", http.StatusOK, ""},
+		{"/v2/gtfs-rt/alerts", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, rec.Code, tt.status)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+
+		var response ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || response.Code != tt.code || response.Status != tt.status {
+			t.Errorf("GET %s: body = %s, want code %q", tt.path, rec.Body, tt.code)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/staticdata"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/stream"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment to keep proxies from closing it
+var streamHeartbeat = 15 * time.Second
+
+// streamRetryMillis is how long browsers wait before reconnecting a dropped stream
+const streamRetryMillis = 5000
+
+/*
+ * GetStream
+ *
+ * Streams capacity updates as Server-Sent Events. After each scrape, a `route`
+ * event carries the route's sailings, a `change` event each service change and
+ * a `sailing` event each sailing that was updated, cancelled, departed or arrived.
+ * New connections first get a `route` event for every route. `route` limits
+ * the stream to a comma separated list of capacity routes.
+ *
+ * Clients reconnecting with Last-Event-ID (or `lastEventId`) are sent what they
+ * missed instead, if it's still remembered.
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	routeCodes, ok := streamRoutes(w, r.URL.Query().Get("route"))
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrInternal, "Streaming is not supported")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	resumeFrom, err := strconv.ParseUint(lastEventID, 10, 64)
+
+	subscription, replay, resumed := stream.Subscribe(resumeFrom, err == nil)
+	defer stream.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+
+	if resumed {
+		for _, event := range replay {
+			writeStreamEvent(w, routeCodes, event)
+		}
+	} else {
+		for _, route := range db.GetCapacitySailings() {
+			data, _ := json.Marshal(route)
+			writeStreamEvent(w, routeCodes, stream.Event{ID: subscription.StartID, Type: stream.EventRoute, RouteCode: route.RouteCode, Data: data})
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// Fell too far behind; the client reconnects and resumes
+				return
+			}
+			if writeStreamEvent(w, routeCodes, event) {
+				flusher.Flush()
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+/*
+ * streamRoutes
+ *
+ * Parses a comma separated list of capacity route codes, writing an error
+ * response if any are unknown.
+ *
+ * @param http.ResponseWriter w
+ * @param string value
+ *
+ * @return []string - upper cased, empty for every route
+ * @return bool - false if an error response was written
+ */
+func streamRoutes(w http.ResponseWriter, value string) ([]string, bool) {
+	routeCodes := []string{}
+	if value == "" {
+		return routeCodes, true
+	}
+
+	for _, routeCode := range strings.Split(strings.ToUpper(value), ",") {
+		routeCode = strings.TrimSpace(routeCode)
+		fromTerminal, toTerminal, ok := staticdata.SplitRouteCode(routeCode)
+		if !ok || !staticdata.IsCapacityRoute(fromTerminal, toTerminal) {
+			writeError(w, http.StatusNotFound, ErrRouteNotFound, "No capacity route "+routeCode)
+			return nil, false
+		}
+		routeCodes = append(routeCodes, routeCode)
+	}
+
+	return routeCodes, true
+}
+
+// writeStreamEvent writes event if it's for one of routeCodes, reporting whether it did
+func writeStreamEvent(w http.ResponseWriter, routeCodes []string, event stream.Event) bool {
+	if len(routeCodes) > 0 && !contains(routeCodes, event.RouteCode) {
+		return false
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return true
+}
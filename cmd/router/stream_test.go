@@ -0,0 +1,100 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/stream"
+)
+
+// readStreamEvent reads lines up to the next blank line, skipping the retry hint
+func readStreamEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	t.Helper()
+
+	for {
+		fields := map[string]string{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading stream: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				break
+			}
+			if strings.HasPrefix(line, ":") {
+				fields["comment"] = strings.TrimSpace(line[1:])
+				continue
+			}
+			name, value, _ := strings.Cut(line, ": ")
+			fields[name] = value
+		}
+		if _, ok := fields["retry"]; !ok {
+			return fields
+		}
+	}
+}
+
+func TestGetStream(t *testing.T) {
+	db.SetStore(db.NewMemoryStore())
+	for _, routeCode := range []string{"TSASWB", "SWBTSA"} {
+		if err := db.SaveCapacityRoute(models.CapacityRoute{RouteCode: routeCode, FromTerminalCode: routeCode[:3], ToTerminalCode: routeCode[3:]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	heartbeat := streamHeartbeat
+	streamHeartbeat = 50 * time.Millisecond
+	defer func() { streamHeartbeat = heartbeat }()
+
+	server := httptest.NewServer(SetupRouter())
+	defer server.Close()
+
+	connect := func(lastEventID string) (*bufio.Reader, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v2/stream?route=tsaswb", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Fatalf("Content-Type = %q", got)
+		}
+		return bufio.NewReader(resp.Body), func() { cancel(); resp.Body.Close() }
+	}
+
+	// A new connection starts with the latest data for the route
+	reader, disconnect := connect("")
+	snapshot := readStreamEvent(t, reader)
+	if snapshot["event"] != stream.EventRoute || !strings.Contains(snapshot["data"], `"routeCode":"TSASWB"`) {
+		t.Errorf("snapshot = %v", snapshot)
+	}
+
+	stream.Publish(stream.EventRoute, "SWBTSA", models.CapacityRoute{RouteCode: "SWBTSA"})
+	stream.Publish(stream.EventChange, "TSASWB", models.ServiceChange{RouteCode: "TSASWB", Kind: models.ChangeCancelled})
+	change := readStreamEvent(t, reader)
+	if change["event"] != stream.EventChange || !strings.Contains(change["data"], `"kind":"cancelled"`) {
+		t.Errorf("change = %v", change)
+	}
+	if comment := readStreamEvent(t, reader)["comment"]; comment != "heartbeat" {
+		t.Errorf("expected a heartbeat, got comment %q", comment)
+	}
+	disconnect()
+
+	// Reconnecting from the snapshot replays what was missed, for the route only
+	reader, disconnect = connect(snapshot["id"])
+	defer disconnect()
+	if replayed := readStreamEvent(t, reader); replayed["id"] != change["id"] {
+		t.Errorf("replayed = %v, want id %s", replayed, change["id"])
+	}
+}
@@ -0,0 +1,258 @@
+package router
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/staticdata"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/webhooks"
+)
+
+// deadLettersLength is how many of a subscription's most recent dead letters are listed
+const deadLettersLength = 50
+
+type SubscriptionRequest struct {
+	URL           string   `json:"url"`
+	RouteCodes    []string `json:"routeCodes"`
+	EventTypes    []string `json:"eventTypes"`
+	FillThreshold int      `json:"fillThreshold"`
+}
+
+type DeadLettersResponse struct {
+	DeadLetters []models.DeadLetter `json:"deadLetters"`
+}
+
+/*
+ * CreateSubscription
+ *
+ * Registers a webhook for changes to capacity routes. The response includes
+ * the secret deliveries are signed with, which isn't shown again and is needed
+ * to view or delete the subscription
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func CreateSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	var request SubscriptionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidSubscription, "Invalid request body, expected JSON")
+		return
+	}
+
+	subscription, message := validateSubscription(r.Context(), request)
+	if message != "" {
+		writeError(w, http.StatusBadRequest, ErrInvalidSubscription, message)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, "Could not create subscription")
+		return
+	}
+	subscription.Secret = hex.EncodeToString(secret)
+	subscription.CreatedAt = time.Now().UTC()
+
+	if err := db.SaveSubscription(&subscription); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, "Could not create subscription")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	jsonString, _ := json.Marshal(subscription)
+	w.Write(jsonString)
+}
+
+/*
+ * GetSubscription
+ *
+ * Returns a webhook subscription, without its secret. Requires the secret as
+ * a bearer token
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	subscription, ok := authorizeSubscription(w, r, ps)
+	if !ok {
+		return
+	}
+	subscription.Secret = ""
+
+	jsonString, _ := json.Marshal(subscription)
+	w.Write(jsonString)
+}
+
+/*
+ * DeleteSubscription
+ *
+ * Deletes a webhook subscription and its dead letters. Requires the secret as
+ * a bearer token
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func DeleteSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	subscription, ok := authorizeSubscription(w, r, ps)
+	if !ok {
+		return
+	}
+
+	if _, err := db.DeleteSubscription(subscription.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, "Could not delete subscription")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+ * GetSubscriptionDeadLetters
+ *
+ * Returns the most recent deliveries to a webhook that failed every retry,
+ * newest first. Requires the subscription's secret as a bearer token
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetSubscriptionDeadLetters(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	subscription, ok := authorizeSubscription(w, r, ps)
+	if !ok {
+		return
+	}
+
+	response := DeadLettersResponse{
+		DeadLetters: db.GetDeadLetters(subscription.ID, deadLettersLength),
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
+
+/*
+ * validateSubscription
+ *
+ * @param context.Context ctx
+ * @param SubscriptionRequest request
+ *
+ * @return models.Subscription - with route codes upper cased
+ * @return string - why the request is invalid, or "" if it's valid
+ */
+func validateSubscription(ctx context.Context, request SubscriptionRequest) (models.Subscription, string) {
+	subscription := models.Subscription{
+		URL:           request.URL,
+		RouteCodes:    []string{},
+		EventTypes:    []string{},
+		FillThreshold: request.FillThreshold,
+	}
+
+	target, err := url.Parse(request.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return subscription, "Invalid url, expected an absolute http or https URL"
+	}
+	if err := webhooks.CheckURL(ctx, request.URL); err != nil {
+		return subscription, "Invalid url, it must not point to a loopback, private or link-local address"
+	}
+
+	for _, routeCode := range request.RouteCodes {
+		routeCode = strings.ToUpper(routeCode)
+		fromTerminal, toTerminal, ok := staticdata.SplitRouteCode(routeCode)
+		if !ok || !staticdata.IsCapacityRoute(fromTerminal, toTerminal) {
+			return subscription, "No capacity route " + routeCode
+		}
+		if !contains(subscription.RouteCodes, routeCode) {
+			subscription.RouteCodes = append(subscription.RouteCodes, routeCode)
+		}
+	}
+
+	if len(request.EventTypes) == 0 {
+		return subscription, "Invalid eventTypes, expected one or more of " + strings.Join(webhooks.EventTypes, ", ")
+	}
+	for _, eventType := range request.EventTypes {
+		if !contains(webhooks.EventTypes, eventType) {
+			return subscription, "Invalid event type " + eventType + ", expected one of " + strings.Join(webhooks.EventTypes, ", ")
+		}
+		if !contains(subscription.EventTypes, eventType) {
+			subscription.EventTypes = append(subscription.EventTypes, eventType)
+		}
+	}
+
+	if contains(subscription.EventTypes, models.EventFillThreshold) && (request.FillThreshold < 1 || request.FillThreshold > 100) {
+		return subscription, "Invalid fillThreshold, expected a percentage from 1 to 100"
+	}
+	if !contains(subscription.EventTypes, models.EventFillThreshold) {
+		subscription.FillThreshold = 0
+	}
+
+	return subscription, ""
+}
+
+/*
+ * authorizeSubscription
+ *
+ * Looks up the subscription named in the path and checks the request carries
+ * its secret as a bearer token, writing an error response if not.
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return models.Subscription
+ * @return bool - false if an error response was written
+ */
+func authorizeSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (models.Subscription, bool) {
+	id, err := strconv.ParseInt(ps.ByName("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrSubscriptionNotFound, "No subscription "+ps.ByName("id"))
+		return models.Subscription{}, false
+	}
+
+	subscription, ok := db.GetSubscription(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrSubscriptionNotFound, "No subscription "+ps.ByName("id"))
+		return models.Subscription{}, false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(subscription.Secret)) != 1 {
+		writeError(w, http.StatusUnauthorized, ErrUnauthorized, "Expected the subscription's secret as a bearer token")
+		return models.Subscription{}, false
+	}
+
+	return subscription, true
+}
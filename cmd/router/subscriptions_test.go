@@ -0,0 +1,86 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestSubscriptions(t *testing.T) {
+	db.SetStore(db.NewMemoryStore())
+	router := SetupRouter()
+
+	serve := func(method string, path string, body string, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"url": "ftp://example.com", "eventTypes": ["cancelled"]}`,
+		`{"url": "http://127.0.0.1:8080/hook", "eventTypes": ["cancelled"]}`,
+		`{"url": "http://169.254.169.254/latest/meta-data/", "eventTypes": ["cancelled"]}`,
+		`{"url": "https://10.0.0.5/hook", "eventTypes": ["cancelled"]}`,
+		`{"url": "http://[::1]/hook", "eventTypes": ["cancelled"]}`,
+		`{"url": "http://localhost/hook", "eventTypes": ["cancelled"]}`,
+		`{"url": "https://example.com/hook", "eventTypes": []}`,
+		`{"url": "https://example.com/hook", "eventTypes": ["delayed"]}`,
+		`{"url": "https://example.com/hook", "routeCodes": ["TSANAN"], "eventTypes": ["cancelled"]}`,
+		`{"url": "https://example.com/hook", "eventTypes": ["fill_threshold"]}`,
+	}
+	for _, body := range invalid {
+		rec := serve(http.MethodPost, "/v2/subscriptions", body, "")
+		var response ErrorResponse
+		if rec.Code != http.StatusBadRequest || json.Unmarshal(rec.Body.Bytes(), &response) != nil || response.Code != ErrInvalidSubscription {
+			t.Errorf("POST %s: %d %s, want 400 %s", body, rec.Code, rec.Body, ErrInvalidSubscription)
+		}
+	}
+
+	rec := serve(http.MethodPost, "/v2/subscriptions", `{"url": "https://example.com/hook", "routeCodes": ["tsaswb"], "eventTypes": ["cancelled", "fill_threshold"], "fillThreshold": 90}`, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: %d %s, want 201", rec.Code, rec.Body)
+	}
+	var created models.Subscription
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || len(created.Secret) != 64 || created.RouteCodes[0] != "TSASWB" || created.FillThreshold != 90 {
+		t.Errorf("created = %+v", created)
+	}
+
+	path := "/v2/subscriptions/" + strconv.FormatInt(created.ID, 10)
+	if rec := serve(http.MethodGet, path, "", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET with wrong secret: %d, want 401", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/v2/subscriptions/999", "", created.Secret); rec.Code != http.StatusNotFound {
+		t.Errorf("GET missing subscription: %d, want 404", rec.Code)
+	}
+
+	rec = serve(http.MethodGet, path, "", created.Secret)
+	var got models.Subscription
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.ID != created.ID || got.Secret != "" {
+		t.Errorf("GET: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(http.MethodGet, path+"/dead-letters", "", created.Secret); rec.Code != http.StatusOK || rec.Body.String() != `{"deadLetters":[]}` {
+		t.Errorf("GET dead letters: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(http.MethodDelete, path, "", created.Secret); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: %d, want 204", rec.Code)
+	}
+	if rec := serve(http.MethodGet, path, "", created.Secret); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after delete: %d, want 404", rec.Code)
+	}
+}
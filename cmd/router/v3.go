@@ -0,0 +1,428 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+// V3 responses carry the same data as V2, with sailings dated and timed as
+// RFC 3339 timestamps in America/Vancouver instead of "7:00 am" strings.
+
+/**************/
+/* V3 Structs */
+/**************/
+
+// V3 sailing statuses
+const (
+	StatusScheduled = "scheduled"
+	StatusUnderway  = "underway"
+	StatusArrived   = "arrived"
+	StatusCancelled = "cancelled"
+	StatusUnknown   = "unknown"
+)
+
+type V3Response struct {
+	CapacityRoutes    []V3Route `json:"capacityRoutes"`
+	NonCapacityRoutes []V3Route `json:"nonCapacityRoutes"`
+}
+
+type V3RoutesResponse struct {
+	Routes []V3Route `json:"routes"`
+}
+
+type V3Route struct {
+	RouteCode              string      `json:"routeCode"`
+	FromTerminalCode       string      `json:"fromTerminalCode"`
+	ToTerminalCode         string      `json:"toTerminalCode"`
+	SailingDurationMinutes *int        `json:"sailingDurationMinutes"`
+	Sailings               []V3Sailing `json:"sailings"`
+	LastUpdated            *time.Time  `json:"lastUpdated"`
+	IsStale                bool        `json:"isStale"`
+}
+
+// Timestamps are null when unknown, e.g. the actual departure of a sailing
+// that hasn't left, or an ETA given as "Variable". Fill is null for sailings
+// BC Ferries doesn't report fill for.
+type V3Sailing struct {
+	SailingDate        string     `json:"sailingDate"` // YYYY-MM-DD in America/Vancouver
+	Status             string     `json:"status"`
+	ScheduledDeparture *time.Time `json:"scheduledDeparture"`
+	ActualDeparture    *time.Time `json:"actualDeparture"`
+	ScheduledArrival   *time.Time `json:"scheduledArrival"`
+	EstimatedArrival   *time.Time `json:"estimatedArrival"`
+	ActualArrival      *time.Time `json:"actualArrival"`
+	DelayMinutes       *int       `json:"delayMinutes"` // null until departed
+	DurationMinutes    *int       `json:"durationMinutes"`
+	Fill               *int       `json:"fill"`
+	CarFill            *int       `json:"carFill"`
+	OversizeFill       *int       `json:"oversizeFill"`
+	VesselName         string     `json:"vesselName"`
+	VesselStatus       string     `json:"vesselStatus"`
+}
+
+/*************/
+/* V3 Routes */
+/*************/
+
+/*
+ * GetV3Sailings
+ *
+ * Returns data for all capacity and non capacity routes in the V3 format. Takes
+ * the same filters as the V2 routes
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetV3Sailings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	capacityRoutes := markCapacityFreshness(db.FilterCapacitySailings("", filter), now)
+	nonCapacityRoutes := markNonCapacityFreshness(db.FilterNonCapacitySailings("", filter), now)
+
+	response := V3Response{
+		CapacityRoutes:    []V3Route{},
+		NonCapacityRoutes: []V3Route{},
+	}
+	for _, route := range capacityRoutes {
+		response.CapacityRoutes = append(response.CapacityRoutes, ConvertCapacityRouteToV3(route, now, sailingtime.Location()))
+	}
+	for _, route := range nonCapacityRoutes {
+		response.NonCapacityRoutes = append(response.NonCapacityRoutes, ConvertNonCapacityRouteToV3(route, now, sailingtime.Location()))
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
+
+/*
+ * GetV3CapacitySailings
+ *
+ * Returns sailing data for all capacity routes in the V3 format
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetV3CapacitySailings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	response := V3RoutesResponse{Routes: []V3Route{}}
+	for _, route := range markCapacityFreshness(db.FilterCapacitySailings("", filter), now) {
+		response.Routes = append(response.Routes, ConvertCapacityRouteToV3(route, now, sailingtime.Location()))
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
+
+/*
+ * GetV3NonCapacitySailings
+ *
+ * Returns sailing data for all non capacity routes in the V3 format
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetV3NonCapacitySailings(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	response := V3RoutesResponse{Routes: []V3Route{}}
+	for _, route := range markNonCapacityFreshness(db.FilterNonCapacitySailings("", filter), now) {
+		response.Routes = append(response.Routes, ConvertNonCapacityRouteToV3(route, now, sailingtime.Location()))
+	}
+
+	jsonString, _ := json.Marshal(response)
+	w.Write(jsonString)
+}
+
+/*
+ * GetV3CapacityRoute
+ *
+ * Returns sailing data for a single capacity route in the V3 format
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetV3CapacityRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	route, ok := findCapacityRoute(w, strings.ToUpper(ps.ByName("routeCode")), filter)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	routes := markCapacityFreshness([]models.CapacityRoute{route}, now)
+
+	jsonString, _ := json.Marshal(ConvertCapacityRouteToV3(routes[0], now, sailingtime.Location()))
+	w.Write(jsonString)
+}
+
+/*
+ * GetV3NonCapacityRoute
+ *
+ * Returns sailing data for a single non capacity route in the V3 format
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetV3NonCapacityRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, ok := sailingFilter(w, r)
+	if !ok {
+		return
+	}
+
+	route, ok := findNonCapacityRoute(w, strings.ToUpper(ps.ByName("routeCode")), filter)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	routes := markNonCapacityFreshness([]models.NonCapacityRoute{route}, now)
+
+	jsonString, _ := json.Marshal(ConvertNonCapacityRouteToV3(routes[0], now, sailingtime.Location()))
+	w.Write(jsonString)
+}
+
+/******************/
+/* V3 Conversions */
+/******************/
+
+/*
+ * ConvertCapacityRouteToV3
+ *
+ * Dates each sailing from the day the route was scraped, or the next day for
+ * sailings marked "(Tomorrow)". Sailings that have left are timed by their
+ * actual departure, and ones that appear to have left after the scrape are
+ * taken to have left the day before. Their scheduled departure is worked back
+ * from the delay.
+ *
+ * @param models.CapacityRoute route
+ * @param time.Time now - used when the scrape time is unknown
+ * @param *time.Location loc - zone the sailing times are in
+ *
+ * @return V3Route
+ */
+func ConvertCapacityRouteToV3(route models.CapacityRoute, now time.Time, loc *time.Location) V3Route {
+	scrapedAt := now
+	if route.LastUpdated != nil {
+		scrapedAt = *route.LastUpdated
+	}
+	duration := durationMinutes(route.SailingDuration)
+
+	v3 := V3Route{
+		RouteCode:              route.RouteCode,
+		FromTerminalCode:       route.FromTerminalCode,
+		ToTerminalCode:         route.ToTerminalCode,
+		SailingDurationMinutes: duration,
+		Sailings:               []V3Sailing{},
+		LastUpdated:            route.LastUpdated,
+		IsStale:                route.IsStale,
+	}
+
+	for _, sailing := range route.Sailings {
+		day := sailingtime.StartOfDay(scrapedAt, loc)
+		if sailing.IsTomorrow {
+			day = day.AddDate(0, 0, 1)
+		}
+
+		v3Sailing := V3Sailing{
+			Status:          v3Status(sailing.SailingStatus),
+			DurationMinutes: duration,
+			VesselName:      sailing.VesselName,
+			VesselStatus:    sailing.VesselStatus,
+		}
+
+		switch v3Sailing.Status {
+		case StatusArrived, StatusUnderway:
+			departure := clockTime(day, sailing.DepartureTime)
+			if departure != nil && departure.After(scrapedAt) {
+				day = day.AddDate(0, 0, -1)
+				departure = clockTime(day, sailing.DepartureTime)
+			}
+			v3Sailing.ActualDeparture = departure
+
+			if departure != nil && sailing.ScheduledDepartureTime != "" {
+				scheduled := departure.Add(-time.Duration(sailing.DelayMinutes) * time.Minute)
+				delay := sailing.DelayMinutes
+				v3Sailing.ScheduledDeparture = &scheduled
+				v3Sailing.DelayMinutes = &delay
+			}
+
+			arrival := arrivalAfter(departure, clockTime(day, sailing.ArrivalTime))
+			if v3Sailing.Status == StatusArrived {
+				v3Sailing.ActualArrival = arrival
+			} else {
+				v3Sailing.EstimatedArrival = arrival
+			}
+
+		default:
+			v3Sailing.ScheduledDeparture = clockTime(day, sailing.DepartureTime)
+			if v3Sailing.ScheduledDeparture != nil && duration != nil {
+				arrival := v3Sailing.ScheduledDeparture.Add(time.Duration(*duration) * time.Minute)
+				v3Sailing.ScheduledArrival = &arrival
+			}
+		}
+
+		if sailing.SailingStatus == "future" {
+			fill, carFill, oversizeFill := sailing.Fill, sailing.CarFill, sailing.OversizeFill
+			v3Sailing.Fill, v3Sailing.CarFill, v3Sailing.OversizeFill = &fill, &carFill, &oversizeFill
+		}
+
+		v3Sailing.SailingDate = day.Format("2006-01-02")
+		v3.Sailings = append(v3.Sailings, v3Sailing)
+	}
+
+	return v3
+}
+
+/*
+ * ConvertNonCapacityRouteToV3
+ *
+ * Dates each sailing on the day the route's schedule was scraped.
+ *
+ * @param models.NonCapacityRoute route
+ * @param time.Time now - used when the scrape time is unknown
+ * @param *time.Location loc - zone the sailing times are in
+ *
+ * @return V3Route
+ */
+func ConvertNonCapacityRouteToV3(route models.NonCapacityRoute, now time.Time, loc *time.Location) V3Route {
+	scrapedAt := now
+	if route.LastUpdated != nil {
+		scrapedAt = *route.LastUpdated
+	}
+	day := sailingtime.StartOfDay(scrapedAt, loc)
+
+	v3 := V3Route{
+		RouteCode:              route.RouteCode,
+		FromTerminalCode:       route.FromTerminalCode,
+		ToTerminalCode:         route.ToTerminalCode,
+		SailingDurationMinutes: durationMinutes(route.SailingDuration),
+		Sailings:               []V3Sailing{},
+		LastUpdated:            route.LastUpdated,
+		IsStale:                route.IsStale,
+	}
+
+	for _, sailing := range route.Sailings {
+		v3Sailing := V3Sailing{
+			SailingDate:        day.Format("2006-01-02"),
+			Status:             StatusScheduled,
+			ScheduledDeparture: clockTime(day, sailing.DepartureTime),
+			DurationMinutes:    v3.SailingDurationMinutes,
+			VesselName:         sailing.VesselName,
+			VesselStatus:       sailing.VesselStatus,
+		}
+		v3Sailing.ScheduledArrival = arrivalAfter(v3Sailing.ScheduledDeparture, clockTime(day, sailing.ArrivalTime))
+
+		if v3Sailing.ScheduledDeparture != nil && v3Sailing.ScheduledArrival != nil {
+			minutes := int(v3Sailing.ScheduledArrival.Sub(*v3Sailing.ScheduledDeparture) / time.Minute)
+			v3Sailing.DurationMinutes = &minutes
+		}
+
+		v3.Sailings = append(v3.Sailings, v3Sailing)
+	}
+
+	return v3
+}
+
+// v3Status maps a scraped sailing status to its V3 status
+func v3Status(sailingStatus string) string {
+	switch sailingStatus {
+	case "future":
+		return StatusScheduled
+	case "current":
+		return StatusUnderway
+	case "past":
+		return StatusArrived
+	case "cancelled":
+		return StatusCancelled
+	}
+	return StatusUnknown
+}
+
+/*
+ * clockTime
+ *
+ * @param time.Time day - midnight of the day the time is on
+ * @param string s - a time of day such as "7:00 am"
+ *
+ * @return *time.Time - nil if s isn't a time, e.g. "Variable" or "..."
+ */
+func clockTime(day time.Time, s string) *time.Time {
+	minutes, ok := departureMinutes(s)
+	if !ok {
+		return nil
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+	return &t
+}
+
+// arrivalAfter moves an arrival that is earlier than its departure to the next day
+func arrivalAfter(departure *time.Time, arrival *time.Time) *time.Time {
+	if departure == nil || arrival == nil || !arrival.Before(*departure) {
+		return arrival
+	}
+	next := arrival.AddDate(0, 0, 1)
+	return &next
+}
+
+// durationMinutes returns a sailing duration in minutes, or nil if it can't be parsed
+func durationMinutes(s string) *int {
+	minutes, ok := sailingtime.DurationMinutes(s)
+	if !ok {
+		return nil
+	}
+	return &minutes
+}
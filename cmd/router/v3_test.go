@@ -0,0 +1,61 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+func TestConvertCapacityRouteToV3(t *testing.T) {
+	loc := sailingtime.Location()
+	scrapedAt := time.Date(2024, 6, 1, 0, 30, 0, 0, loc)
+
+	route := models.CapacityRoute{
+		RouteCode:       "TSASWB",
+		SailingDuration: "1h 35m",
+		LastUpdated:     &scrapedAt,
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "11:00 pm", ScheduledDepartureTime: "10:50 pm", ActualDepartureTime: "11:00 pm", DelayMinutes: 10, ArrivalTime: "12:35 am", SailingStatus: "past"},
+			{DepartureTime: "7:00 am", SailingStatus: "future", Fill: 40},
+			{DepartureTime: "7:00 am", SailingStatus: "cancelled", IsTomorrow: true},
+			{DepartureTime: "9:00 am", SailingStatus: "current", ArrivalTime: "Variable"},
+		},
+	}
+
+	v3 := ConvertCapacityRouteToV3(route, scrapedAt, loc)
+	if v3.SailingDurationMinutes == nil || *v3.SailingDurationMinutes != 95 {
+		t.Fatalf("SailingDurationMinutes = %v, want 95", v3.SailingDurationMinutes)
+	}
+
+	arrived := v3.Sailings[0]
+	if arrived.Status != StatusArrived || arrived.SailingDate != "2024-05-31" || arrived.DelayMinutes == nil || *arrived.DelayMinutes != 10 {
+		t.Errorf("arrived sailing = %+v", arrived)
+	}
+	if arrived.ScheduledDeparture == nil || !arrived.ScheduledDeparture.Equal(time.Date(2024, 5, 31, 22, 50, 0, 0, loc)) {
+		t.Errorf("ScheduledDeparture = %v", arrived.ScheduledDeparture)
+	}
+	if arrived.ActualArrival == nil || !arrived.ActualArrival.Equal(time.Date(2024, 6, 1, 0, 35, 0, 0, loc)) {
+		t.Errorf("ActualArrival = %v", arrived.ActualArrival)
+	}
+
+	scheduled := v3.Sailings[1]
+	if scheduled.Status != StatusScheduled || scheduled.Fill == nil || *scheduled.Fill != 40 {
+		t.Errorf("scheduled sailing = %+v", scheduled)
+	}
+	if scheduled.ScheduledArrival == nil || !scheduled.ScheduledArrival.Equal(time.Date(2024, 6, 1, 8, 35, 0, 0, loc)) {
+		t.Errorf("ScheduledArrival = %v", scheduled.ScheduledArrival)
+	}
+
+	cancelled := v3.Sailings[2]
+	if cancelled.Status != StatusCancelled || cancelled.SailingDate != "2024-06-02" || cancelled.Fill != nil {
+		t.Errorf("cancelled sailing = %+v", cancelled)
+	}
+
+	// Departs after the scrape, so it must have left the day before
+	underway := v3.Sailings[3]
+	if underway.Status != StatusUnderway || underway.SailingDate != "2024-05-31" || underway.EstimatedArrival != nil {
+		t.Errorf("underway sailing = %+v", underway)
+	}
+}
@@ -0,0 +1,348 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/julienschmidt/httprouter"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/staticdata"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/stream"
+)
+
+// Messages clients send
+const (
+	WebSocketSubscribe   = "subscribe"
+	WebSocketUnsubscribe = "unsubscribe"
+)
+
+// Messages the server sends, besides the models.Sailing* updates
+const (
+	WebSocketSubscribed = "subscribed" // The routes the connection is now subscribed to
+	WebSocketSnapshot   = "snapshot"   // A newly subscribed route's current sailings
+	WebSocketError      = "error"
+)
+
+// websocketPing is how often the server pings, so dead connections are noticed
+var websocketPing = 30 * time.Second
+
+const (
+	websocketWriteTimeout = 10 * time.Second
+	websocketMaxMessage   = 4 << 10
+)
+
+type WebSocketRequest struct {
+	Type       string   `json:"type"`
+	RouteCodes []string `json:"routeCodes"`
+}
+
+type WebSocketSubscribedMessage struct {
+	Type       string   `json:"type"`
+	RouteCodes []string `json:"routeCodes"`
+}
+
+type WebSocketSnapshotMessage struct {
+	Type  string               `json:"type"`
+	Route models.CapacityRoute `json:"route"`
+}
+
+type WebSocketErrorMessage struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+/*
+ * GetWebSocket
+ *
+ * Upgrades to a WebSocket that sends sailing updates for the capacity routes
+ * the client subscribes to. Clients send {"type": "subscribe", "routeCodes":
+ * [...]} and {"type": "unsubscribe", "routeCodes": [...]} (no route codes
+ * unsubscribes from everything) at any time, and are sent a `subscribed`
+ * message listing their routes and a `snapshot` of each new one. `route`
+ * subscribes to a comma separated list of routes on connect
+ *
+ * @param http.ResponseWriter w
+ * @param *http.Request r
+ * @param httprouter.Params ps
+ *
+ * @return void
+ */
+func GetWebSocket(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	initialRoutes, ok := streamRoutes(w, r.URL.Query().Get("route"))
+	if !ok {
+		return
+	}
+
+	netConn, buffered, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		return
+	}
+	defer netConn.Close()
+
+	conn := &websocketConn{conn: netConn, reader: netConn}
+	if buffered != nil && buffered.Reader.Buffered() > 0 {
+		conn.reader = buffered.Reader
+	}
+
+	subscription, _, _ := stream.Subscribe(0, false)
+	defer stream.Unsubscribe(subscription)
+
+	requests := make(chan []byte)
+	closed := make(chan struct{})
+	go func() {
+		defer close(requests)
+		for {
+			data, err := conn.read()
+			if err != nil {
+				return
+			}
+			select {
+			case requests <- data:
+			case <-closed:
+				return
+			}
+		}
+	}()
+	defer close(closed)
+
+	routeCodes := map[string]bool{}
+	if len(initialRoutes) > 0 {
+		if err := subscribeRoutes(conn, routeCodes, initialRoutes); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(websocketPing)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case data, ok := <-requests:
+			if !ok {
+				return
+			}
+			err = handleWebSocketRequest(conn, routeCodes, data)
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// Fell too far behind; the client reconnects
+				return
+			}
+			if event.Type == stream.EventSailing && routeCodes[event.RouteCode] {
+				err = conn.write(ws.OpText, event.Data)
+			}
+		case <-ping.C:
+			err = conn.write(ws.OpPing, nil)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+/*
+ * handleWebSocketRequest
+ *
+ * Applies a client's subscribe or unsubscribe message to routeCodes.
+ *
+ * @param *websocketConn conn
+ * @param map[string]bool routeCodes - the connection's subscribed routes
+ * @param []byte data
+ *
+ * @return error - only if writing the reply failed
+ */
+func handleWebSocketRequest(conn *websocketConn, routeCodes map[string]bool, data []byte) error {
+	var request WebSocketRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return conn.writeMessage(WebSocketErrorMessage{Type: WebSocketError, Code: ErrInvalidMessage, Message: "Invalid message, expected JSON"})
+	}
+
+	requested := []string{}
+	for _, routeCode := range request.RouteCodes {
+		routeCode = strings.ToUpper(routeCode)
+		fromTerminal, toTerminal, ok := staticdata.SplitRouteCode(routeCode)
+		if !ok || !staticdata.IsCapacityRoute(fromTerminal, toTerminal) {
+			return conn.writeMessage(WebSocketErrorMessage{Type: WebSocketError, Code: ErrRouteNotFound, Message: "No capacity route " + routeCode})
+		}
+		requested = append(requested, routeCode)
+	}
+
+	switch request.Type {
+	case WebSocketSubscribe:
+		return subscribeRoutes(conn, routeCodes, requested)
+	case WebSocketUnsubscribe:
+		for routeCode := range routeCodes {
+			if len(requested) == 0 || contains(requested, routeCode) {
+				delete(routeCodes, routeCode)
+			}
+		}
+		return conn.writeMessage(WebSocketSubscribedMessage{Type: WebSocketSubscribed, RouteCodes: sortedKeys(routeCodes)})
+	}
+
+	return conn.writeMessage(WebSocketErrorMessage{Type: WebSocketError, Code: ErrInvalidMessage, Message: "Unknown message type " + request.Type + ", expected subscribe or unsubscribe"})
+}
+
+/*
+ * subscribeRoutes
+ *
+ * Adds routes to a connection's subscriptions, then sends the updated list and
+ * a snapshot of each route that wasn't already subscribed.
+ *
+ * @param *websocketConn conn
+ * @param map[string]bool routeCodes - the connection's subscribed routes
+ * @param []string requested - validated, upper cased route codes
+ *
+ * @return error
+ */
+func subscribeRoutes(conn *websocketConn, routeCodes map[string]bool, requested []string) error {
+	var added []string
+	for _, routeCode := range requested {
+		if !routeCodes[routeCode] {
+			routeCodes[routeCode] = true
+			added = append(added, routeCode)
+		}
+	}
+
+	if err := conn.writeMessage(WebSocketSubscribedMessage{Type: WebSocketSubscribed, RouteCodes: sortedKeys(routeCodes)}); err != nil {
+		return err
+	}
+
+	for _, routeCode := range added {
+		route, ok := db.GetCapacityRoute(routeCode)
+		if !ok {
+			continue
+		}
+		if err := conn.writeMessage(WebSocketSnapshotMessage{Type: WebSocketSnapshot, Route: route}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/******************/
+/* WebSocket Conn */
+/******************/
+
+// websocketConn lets the read loop answer pings while the handler writes messages
+type websocketConn struct {
+	conn   net.Conn
+	reader io.Reader // conn, or what was read from it during the handshake first
+	mu     sync.Mutex
+}
+
+/*
+ * write
+ *
+ * Writes one frame. Frames are built in memory and written with a single
+ * call, so writes from the read loop and the handler never interleave.
+ *
+ * @param ws.OpCode op
+ * @param []byte payload
+ *
+ * @return error
+ */
+func (c *websocketConn) write(op ws.OpCode, payload []byte) error {
+	var frame bytes.Buffer
+	if err := wsutil.WriteServerMessage(&frame, op, payload); err != nil {
+		return err
+	}
+	return c.writeFrame(frame.Bytes())
+}
+
+func (c *websocketConn) writeMessage(message interface{}) error {
+	data, _ := json.Marshal(message)
+	return c.write(ws.OpText, data)
+}
+
+func (c *websocketConn) writeFrame(frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+/*
+ * read
+ *
+ * Reads the next text or binary message, answering pings and close frames
+ * on the way.
+ *
+ * @return []byte
+ * @return error - including wsutil.ClosedError once the client closes
+ */
+func (c *websocketConn) read() ([]byte, error) {
+	control := func(header ws.Header, payload io.Reader) error {
+		var response bytes.Buffer
+		err := wsutil.ControlHandler{
+			Src:                 payload,
+			Dst:                 &response,
+			State:               ws.StateServerSide,
+			DisableSrcCiphering: true,
+		}.Handle(header)
+		if response.Len() > 0 {
+			if writeErr := c.writeFrame(response.Bytes()); writeErr != nil && err == nil {
+				err = writeErr
+			}
+		}
+		return err
+	}
+
+	reader := wsutil.Reader{
+		Source:         c.reader,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		MaxFrameSize:   websocketMaxMessage,
+		OnIntermediate: control,
+	}
+
+	for {
+		header, err := reader.NextFrame()
+		if err != nil {
+			return nil, err
+		}
+		if header.OpCode.IsControl() {
+			if err := control(header, &reader); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if header.OpCode != ws.OpText && header.OpCode != ws.OpBinary {
+			if err := reader.Discard(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(&reader, websocketMaxMessage+1))
+		if err == nil && len(data) > websocketMaxMessage {
+			err = wsutil.ErrFrameTooLarge
+		}
+		return data, err
+	}
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/stream"
+)
+
+func TestGetWebSocket(t *testing.T) {
+	db.SetStore(db.NewMemoryStore())
+	if err := db.SaveCapacityRoute(models.CapacityRoute{RouteCode: "SWBTSA", FromTerminalCode: "SWB", ToTerminalCode: "TSA"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(SetupRouter())
+	defer server.Close()
+
+	conn, buffered, _, err := ws.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")+"/v2/ws?route=TSASWB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The server writes straight after the handshake, so some of it may be buffered
+	var reader io.Reader = conn
+	if buffered != nil {
+		reader = buffered
+	}
+	client := struct {
+		io.Reader
+		io.Writer
+	}{reader, conn}
+
+	send := func(message string) {
+		t.Helper()
+		if err := wsutil.WriteClientText(conn, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func() map[string]interface{} {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, err := wsutil.ReadServerText(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var message map[string]interface{}
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+
+	if message := receive(); message["type"] != WebSocketSubscribed || len(message["routeCodes"].([]interface{})) != 1 {
+		t.Errorf("initial subscription = %v", message)
+	}
+
+	send(`{"type": "subscribe", "routeCodes": ["swbtsa"]}`)
+	if message := receive(); message["type"] != WebSocketSubscribed || len(message["routeCodes"].([]interface{})) != 2 {
+		t.Errorf("subscribed = %v", message)
+	}
+	if message := receive(); message["type"] != WebSocketSnapshot || message["route"].(map[string]interface{})["routeCode"] != "SWBTSA" {
+		t.Errorf("snapshot = %v", message)
+	}
+
+	send(`{"type": "subscribe", "routeCodes": ["TSANAN"]}`)
+	if message := receive(); message["type"] != WebSocketError || message["code"] != ErrRouteNotFound {
+		t.Errorf("bad route = %v", message)
+	}
+	send(`{"type": "resubscribe"}`)
+	if message := receive(); message["type"] != WebSocketError || message["code"] != ErrInvalidMessage {
+		t.Errorf("bad type = %v", message)
+	}
+
+	send(`{"type": "unsubscribe", "routeCodes": ["TSASWB"]}`)
+	if message := receive(); message["type"] != WebSocketSubscribed || len(message["routeCodes"].([]interface{})) != 1 {
+		t.Errorf("unsubscribed = %v", message)
+	}
+
+	// Only updates for subscribed routes are sent
+	stream.Publish(stream.EventSailing, "TSASWB", models.SailingUpdate{Type: models.SailingDeparted, RouteCode: "TSASWB"})
+	stream.Publish(stream.EventChange, "SWBTSA", models.ServiceChange{RouteCode: "SWBTSA"})
+	stream.Publish(stream.EventSailing, "SWBTSA", models.SailingUpdate{Type: models.SailingCancelled, RouteCode: "SWBTSA"})
+	if message := receive(); message["type"] != models.SailingCancelled || message["routeCode"] != "SWBTSA" {
+		t.Errorf("update = %v", message)
+	}
+
+	send(`{"type": "unsubscribe"}`)
+	if message := receive(); message["type"] != WebSocketSubscribed || len(message["routeCodes"].([]interface{})) != 0 {
+		t.Errorf("unsubscribed from everything = %v", message)
+	}
+
+	// Pings are answered while the server is idle
+	if err := wsutil.WriteClientMessage(conn, ws.OpPing, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	frame, err := ws.ReadFrame(reader)
+	if err != nil || frame.Header.OpCode != ws.OpPong {
+		t.Errorf("ping reply = %v, %v", frame.Header.OpCode, err)
+	}
+}
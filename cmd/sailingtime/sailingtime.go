@@ -0,0 +1,102 @@
+package sailingtime
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embedded so the zone loads on images without a time zone database
+	_ "time/tzdata"
+)
+
+// Zone is the time zone BC Ferries publishes sailing times in
+const Zone = "America/Vancouver"
+
+var (
+	hoursMinutesRe  = regexp.MustCompile(`^(?:(\d+)\s*h[a-z]*)?\s*(?:(\d+)\s*m[a-z]*)?$`)
+	clockDurationRe = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+)
+
+var location = loadLocation()
+
+/*
+ * Location
+ *
+ * Returns the zone sailing times are in.
+ *
+ * @return *time.Location
+ */
+func Location() *time.Location {
+	return location
+}
+
+// loadLocation panics rather than falling back to another zone, which would shift every sailing date
+func loadLocation() *time.Location {
+	loc, err := time.LoadLocation(Zone)
+	if err != nil {
+		panic("sailingtime: failed to load " + Zone + ": " + err.Error())
+	}
+	return loc
+}
+
+/*
+ * StartOfDay
+ *
+ * @param time.Time t
+ * @param *time.Location loc
+ *
+ * @return time.Time - midnight in loc on the day t falls on there
+ */
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+/*
+ * ClockMinutes
+ *
+ * Parses a time of day as scraped from bcferries.com, e.g. "7:05 pm".
+ *
+ * @param string s
+ *
+ * @return int - minutes past midnight
+ * @return bool - false if s isn't a time, e.g. "Variable" or "..."
+ */
+func ClockMinutes(s string) (int, bool) {
+	t, err := time.Parse("3:04 pm", strings.ToLower(strings.TrimSpace(s)))
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+/*
+ * DurationMinutes
+ *
+ * Parses a sailing duration as shown on bcferries.com, e.g. "1h 35m", "0h 40m",
+ * "35m" or "01:35".
+ *
+ * @param string s
+ *
+ * @return int
+ * @return bool - false if s is empty or not a duration
+ */
+func DurationMinutes(s string) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, false
+	}
+
+	matches := clockDurationRe.FindStringSubmatch(s)
+	if matches == nil {
+		matches = hoursMinutesRe.FindStringSubmatch(s)
+	}
+	if matches == nil {
+		return 0, false
+	}
+
+	hours, _ := strconv.Atoi(matches[1])
+	minutes, _ := strconv.Atoi(matches[2])
+	return hours*60 + minutes, true
+}
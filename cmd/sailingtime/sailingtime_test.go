@@ -0,0 +1,45 @@
+package sailingtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockMinutes(t *testing.T) {
+	tests := map[string]int{"12:05 am": 5, "7:00 am": 420, "12:00 pm": 720, "10:45 PM": 1365, " 7:05 pm ": 1145}
+	for in, want := range tests {
+		if got, ok := ClockMinutes(in); !ok || got != want {
+			t.Errorf("ClockMinutes(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+
+	for _, in := range []string{"", "Variable", "...", "19:30"} {
+		if got, ok := ClockMinutes(in); ok {
+			t.Errorf("ClockMinutes(%q) = %d, want not ok", in, got)
+		}
+	}
+}
+
+func TestDurationMinutes(t *testing.T) {
+	tests := map[string]int{"1h 35m": 95, "0h 40m": 40, "35m": 35, "2h": 120, "01:35": 95}
+	for in, want := range tests {
+		if got, ok := DurationMinutes(in); !ok || got != want {
+			t.Errorf("DurationMinutes(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+
+	for _, in := range []string{"", "Variable"} {
+		if got, ok := DurationMinutes(in); ok {
+			t.Errorf("DurationMinutes(%q) = %d, want not ok", in, got)
+		}
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	loc := Location()
+	// Still the evening before in Vancouver
+	got := StartOfDay(time.Date(2024, 6, 1, 5, 0, 0, 0, time.UTC), loc)
+	if want := time.Date(2024, 5, 31, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("StartOfDay = %v, want %v", got, want)
+	}
+}
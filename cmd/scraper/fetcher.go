@@ -0,0 +1,762 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/config"
+)
+
+/*****************/
+/* Fetcher Types */
+/*****************/
+
+// Page is the raw result of fetching a single URL.
+type Page struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+	HTML       string `json:"html"`
+}
+
+// Fetcher retrieves the HTML for a URL. Implementations decide where the
+// HTML comes from (the live site, a headless browser, files on disk, ...).
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*Page, error)
+}
+
+// FetcherFunc adapts an ordinary function to the Fetcher interface.
+type FetcherFunc func(ctx context.Context, url string) (*Page, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context, url string) (*Page, error) {
+	return f(ctx, url)
+}
+
+// StatusError is returned when the upstream responds with a non-2xx status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.StatusCode, e.URL)
+}
+
+// ErrNotRecorded is returned by fixture and cassette fetchers for unknown URLs.
+var ErrNotRecorded = errors.New("no recorded page for url")
+
+/****************/
+/* HTTP Fetcher */
+/****************/
+
+type HTTPFetcher struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+/*
+ * NewHTTPFetcher
+ *
+ * Returns a fetcher that performs plain HTTP GET requests, the strategy used
+ * for current conditions and vehicle details pages.
+ *
+ * @return *HTTPFetcher
+ */
+func NewHTTPFetcher() *HTTPFetcher {
+	return &HTTPFetcher{
+		Client:    &http.Client{},
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
+	}
+}
+
+/*
+ * Fetch
+ *
+ * Performs a GET request for the given URL and returns the response body.
+ * Non-2xx responses are reported as a *StatusError alongside the page.
+ *
+ * @param context.Context ctx
+ * @param string url
+ *
+ * @return *Page
+ * @return error
+ */
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.UserAgent)
+
+	response, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{URL: url, StatusCode: response.StatusCode, HTML: string(body)}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return page, &StatusError{URL: url, StatusCode: response.StatusCode}
+	}
+
+	return page, nil
+}
+
+/********************/
+/* Chromedp Fetcher */
+/********************/
+
+// ChromedpFetcher renders pages in headless Chrome. The browser is started
+// lazily on the first fetch and shut down by Close.
+type ChromedpFetcher struct {
+	mu            sync.Mutex
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+}
+
+/*
+ * NewChromedpFetcher
+ *
+ * Returns a fetcher that renders pages in a headless browser. This is used to
+ * bypass JavaScript-based protections like Queue-it on the schedule pages.
+ *
+ * @return *ChromedpFetcher
+ */
+func NewChromedpFetcher() *ChromedpFetcher {
+	return &ChromedpFetcher{}
+}
+
+/*
+ * Fetch
+ *
+ * Opens the URL in a new browser tab and returns the full outer HTML once the
+ * body is ready. Cancelling ctx aborts the navigation.
+ *
+ * @param context.Context ctx
+ * @param string url
+ *
+ * @return *Page
+ * @return error
+ */
+func (f *ChromedpFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	browserCtx, err := f.browser()
+	if err != nil {
+		return nil, err
+	}
+
+	tabCtx, cancel := chromedp.NewContext(browserCtx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	var html string
+	err = chromedp.Run(tabCtx,
+		chromedp.Navigate(url),
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		chromedp.OuterHTML("html", &html),
+	)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	return &Page{URL: url, HTML: html}, nil
+}
+
+/*
+ * Close
+ *
+ * Shuts down the browser, if one is running. The next Fetch starts a new one.
+ *
+ * @return error
+ */
+func (f *ChromedpFetcher) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.browserCancel != nil {
+		f.browserCancel()
+	}
+	f.browserCtx = nil
+	f.browserCancel = nil
+
+	return nil
+}
+
+func (f *ChromedpFetcher) browser() (context.Context, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.browserCtx != nil {
+		return f.browserCtx, nil
+	}
+
+	ctx, cancel := chromedp.NewContext(context.Background())
+	// Running with no actions starts the browser so that tabs can share it
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	f.browserCtx = ctx
+	f.browserCancel = cancel
+
+	return ctx, nil
+}
+
+/***************/
+/* Dir Fetcher */
+/***************/
+
+// DirFetcher serves pages from HTML files saved on disk.
+type DirFetcher struct {
+	Dir string
+	// Resolve maps a URL to a file name relative to Dir. Defaults to FixtureName.
+	Resolve func(url string) string
+}
+
+/*
+ * NewDirFetcher
+ *
+ * Returns a fetcher that reads pages from files under dir, named by FixtureName.
+ *
+ * @param string dir
+ *
+ * @return *DirFetcher
+ */
+func NewDirFetcher(dir string) *DirFetcher {
+	return &DirFetcher{Dir: dir}
+}
+
+/*
+ * Fetch
+ *
+ * Reads the fixture file for the URL. Missing files yield ErrNotRecorded.
+ *
+ * @param context.Context ctx
+ * @param string url
+ *
+ * @return *Page
+ * @return error
+ */
+func (f *DirFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	resolve := f.Resolve
+	if resolve == nil {
+		resolve = FixtureName
+	}
+
+	path := filepath.Join(f.Dir, resolve(url))
+	body, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s (looked for %s)", ErrNotRecorded, url, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Page{URL: url, StatusCode: http.StatusOK, HTML: string(body)}, nil
+}
+
+/*
+ * FixtureName
+ *
+ * Derives a file name from a URL by joining its path and query into a single
+ * flat name, e.g. ".../current-conditions/TSA-SWB" -> "current-conditions_TSA-SWB.html".
+ *
+ * @param string rawURL
+ *
+ * @return string
+ */
+func FixtureName(rawURL string) string {
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		name = strings.Trim(u.Path, "/")
+		if u.RawQuery != "" {
+			name += "_" + u.RawQuery
+		}
+	}
+
+	replacer := strings.NewReplacer("/", "_", "?", "_", "&", "_", "=", "-", " ", "-", ":", "-", "%20", "-")
+	return replacer.Replace(name) + ".html"
+}
+
+/********************/
+/* Cassette Fetcher */
+/********************/
+
+// CassetteFetcher replays pages recorded from an earlier run. When Upstream is
+// set, unknown URLs are fetched from it and recorded so Save can persist them.
+type CassetteFetcher struct {
+	Upstream Fetcher
+
+	mu     sync.Mutex
+	pages  map[string]*Page
+	saveMu sync.Mutex // Held while writing the file, so concurrent saves don't interleave
+}
+
+/*
+ * LoadCassette
+ *
+ * Reads a cassette file written by Save. A missing file yields an empty cassette
+ * so that a recording run can create it.
+ *
+ * @param string path
+ *
+ * @return *CassetteFetcher
+ * @return error
+ */
+func LoadCassette(path string) (*CassetteFetcher, error) {
+	cassette := &CassetteFetcher{pages: make(map[string]*Page)}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cassette, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []*Page
+	if err := json.Unmarshal(content, &pages); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	for _, page := range pages {
+		cassette.pages[page.URL] = page
+	}
+
+	return cassette, nil
+}
+
+/*
+ * Fetch
+ *
+ * Returns the recorded page for the URL, falling back to Upstream (and recording
+ * the result) when the URL has not been seen before.
+ *
+ * @param context.Context ctx
+ * @param string url
+ *
+ * @return *Page
+ * @return error
+ */
+func (c *CassetteFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	return c.fetch(ctx, url, c.Upstream)
+}
+
+func (c *CassetteFetcher) fetch(ctx context.Context, url string, upstream Fetcher) (*Page, error) {
+	c.mu.Lock()
+	page, ok := c.pages[url]
+	c.mu.Unlock()
+	if ok {
+		return page, nil
+	}
+
+	if upstream == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotRecorded, url)
+	}
+
+	page, err := upstream.Fetch(ctx, url)
+	if err != nil {
+		return page, err
+	}
+
+	c.mu.Lock()
+	if c.pages == nil {
+		c.pages = make(map[string]*Page)
+	}
+	c.pages[url] = page
+	c.mu.Unlock()
+
+	return page, nil
+}
+
+/*
+ * Save
+ *
+ * Writes every recorded page to path as JSON.
+ *
+ * @param string path
+ *
+ * @return error
+ */
+func (c *CassetteFetcher) Save(path string) error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	c.mu.Lock()
+	pages := make([]*Page, 0, len(c.pages))
+	for _, page := range c.pages {
+		pages = append(pages, page)
+	}
+	c.mu.Unlock()
+
+	content, err := json.MarshalIndent(pages, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0o644)
+}
+
+/*
+ * RecordingFrom
+ *
+ * Returns a fetcher that replays this cassette's pages and records unknown URLs
+ * into it from upstream, for sources that need different upstream fetchers
+ * (e.g. plain HTTP for capacity pages and a browser for schedules) to share one
+ * cassette.
+ *
+ * @param Fetcher upstream
+ *
+ * @return Fetcher
+ */
+func (c *CassetteFetcher) RecordingFrom(upstream Fetcher) Fetcher {
+	return &cassetteRecorder{cassette: c, upstream: upstream}
+}
+
+type cassetteRecorder struct {
+	cassette *CassetteFetcher
+	upstream Fetcher
+}
+
+func (r *cassetteRecorder) Fetch(ctx context.Context, url string) (*Page, error) {
+	return r.cassette.fetch(ctx, url, r.upstream)
+}
+
+func (r *cassetteRecorder) Close() error {
+	closeFetcher(r.upstream)
+	return nil
+}
+
+/************************/
+/* Fetcher Registration */
+/************************/
+
+const (
+	defaultConcurrency    = 4
+	defaultRateLimit      = 2
+	defaultRateBurst      = 4
+	defaultRequestTimeout = 30 * time.Second
+
+	defaultMaxAttempts      = 3
+	defaultRetryBaseDelay   = 1 * time.Second
+	defaultRetryMaxDelay    = 30 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 2 * time.Minute
+)
+
+var (
+	// Live fetchers share one limiter and breaker so bcferries.com sees a single request budget
+	upstreamLimiter = NewHostLimiter(defaultRateLimit, defaultRateBurst)
+	upstreamBreaker = NewCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown)
+
+	fetchersMu      sync.RWMutex
+	capacityFetcher = liveFetcher(NewHTTPFetcher(), upstreamLimiter, upstreamBreaker)
+	scheduleFetcher = liveFetcher(NewChromedpFetcher(), upstreamLimiter, upstreamBreaker)
+	routeFetchers   = map[string]Fetcher{}
+
+	// Set when recording, so each scrape saves what it fetched
+	recording     *CassetteFetcher
+	recordingPath string
+)
+
+/*
+ * SetCapacityFetcher
+ *
+ * Replaces the fetcher used for current conditions and vehicle details pages.
+ *
+ * @param Fetcher f
+ *
+ * @return void
+ */
+func SetCapacityFetcher(f Fetcher) {
+	fetchersMu.Lock()
+	defer fetchersMu.Unlock()
+	capacityFetcher = f
+}
+
+/*
+ * SetScheduleFetcher
+ *
+ * Replaces the fetcher used for daily and seasonal schedule pages.
+ *
+ * @param Fetcher f
+ *
+ * @return void
+ */
+func SetScheduleFetcher(f Fetcher) {
+	fetchersMu.Lock()
+	defer fetchersMu.Unlock()
+	scheduleFetcher = f
+}
+
+/*
+ * SetRouteFetcher
+ *
+ * Overrides the fetcher for a single route code (e.g. "TSASWB"), for both capacity
+ * and schedule scrapes. Passing nil removes the override.
+ *
+ * @param string routeCode
+ * @param Fetcher f
+ *
+ * @return void
+ */
+func SetRouteFetcher(routeCode string, f Fetcher) {
+	fetchersMu.Lock()
+	defer fetchersMu.Unlock()
+	if f == nil {
+		delete(routeFetchers, routeCode)
+		return
+	}
+	routeFetchers[routeCode] = f
+}
+
+/*
+ * UseFixtureDir
+ *
+ * Points every scrape at HTML files saved under dir instead of the live site.
+ *
+ * @param string dir
+ *
+ * @return void
+ */
+func UseFixtureDir(dir string) {
+	f := NewDirFetcher(dir)
+	SetCapacityFetcher(f)
+	SetScheduleFetcher(f)
+}
+
+func capacityFetcherFor(routeCode string) Fetcher {
+	fetchersMu.RLock()
+	defer fetchersMu.RUnlock()
+	if f, ok := routeFetchers[routeCode]; ok {
+		return f
+	}
+	return capacityFetcher
+}
+
+func scheduleFetcherFor(routeCode string) Fetcher {
+	fetchersMu.RLock()
+	defer fetchersMu.RUnlock()
+	if f, ok := routeFetchers[routeCode]; ok {
+		return f
+	}
+	return scheduleFetcher
+}
+
+// closeScheduleFetchers releases resources held by fetchers such as
+// ChromedpFetcher once a schedule scrape has finished.
+func closeScheduleFetchers() {
+	fetchersMu.RLock()
+	defer fetchersMu.RUnlock()
+
+	closeFetcher(scheduleFetcher)
+	for _, f := range routeFetchers {
+		closeFetcher(f)
+	}
+}
+
+// saveRecording writes the cassette being recorded, if any, once a scrape has finished
+func saveRecording() {
+	fetchersMu.RLock()
+	cassette, path := recording, recordingPath
+	fetchersMu.RUnlock()
+
+	if cassette == nil {
+		return
+	}
+	if err := cassette.Save(path); err != nil {
+		log.Printf("scraper: failed to save cassette %s: %v", path, err)
+	}
+}
+
+func closeFetcher(f Fetcher) {
+	if closer, ok := f.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+/*
+ * ConfigureFetchers
+ *
+ * Applies the scraper source, rate limit and retry settings from config. A
+ * cassette takes precedence over a fixture directory; with neither set the live
+ * site is used, rate limited per host and guarded by the circuit breaker. When
+ * recording, pages missing from the cassette are fetched from the live site
+ * and the cassette is saved after every scrape.
+ *
+ * @return error
+ */
+func ConfigureFetchers() error {
+	limiter := NewHostLimiter(config.Scraper.RateLimit, config.Scraper.RateBurst)
+	breaker := NewCircuitBreaker(config.Scraper.BreakerThreshold, config.Scraper.BreakerCooldown)
+	fetchersMu.Lock()
+	upstreamLimiter = limiter
+	upstreamBreaker = breaker
+	fetchersMu.Unlock()
+
+	SetCapacityFetcher(liveFetcher(NewHTTPFetcher(), limiter, breaker))
+	SetScheduleFetcher(liveFetcher(NewChromedpFetcher(), limiter, breaker))
+
+	if config.Scraper.Cassette != "" {
+		cassette, err := LoadCassette(config.Scraper.Cassette)
+		if err != nil {
+			return err
+		}
+		if !config.Scraper.CassetteRecord {
+			SetCapacityFetcher(cassette)
+			SetScheduleFetcher(cassette)
+			return nil
+		}
+
+		SetCapacityFetcher(cassette.RecordingFrom(liveFetcher(NewHTTPFetcher(), limiter, breaker)))
+		SetScheduleFetcher(cassette.RecordingFrom(liveFetcher(NewChromedpFetcher(), limiter, breaker)))
+		fetchersMu.Lock()
+		recording = cassette
+		recordingPath = config.Scraper.Cassette
+		fetchersMu.Unlock()
+		return nil
+	}
+
+	if config.Scraper.FixtureDir != "" {
+		UseFixtureDir(config.Scraper.FixtureDir)
+	}
+
+	return nil
+}
+
+/*
+ * scrapeConcurrency
+ *
+ * Returns the number of routes scraped at once.
+ *
+ * @return int
+ */
+func scrapeConcurrency() int {
+	if config.Scraper.Concurrency > 0 {
+		return config.Scraper.Concurrency
+	}
+	return defaultConcurrency
+}
+
+/*
+ * UpstreamStatus
+ *
+ * Returns the state of the circuit breaker guarding requests to bcferries.com.
+ *
+ * @return BreakerStatus
+ */
+func UpstreamStatus() BreakerStatus {
+	fetchersMu.RLock()
+	defer fetchersMu.RUnlock()
+	return upstreamBreaker.Status()
+}
+
+/*
+ * liveFetcher
+ *
+ * Wraps a fetcher that talks to bcferries.com with the shared rate limiter,
+ * retry policy and circuit breaker.
+ *
+ * @param Fetcher f
+ * @param *HostLimiter limiter
+ * @param *CircuitBreaker breaker
+ *
+ * @return Fetcher
+ */
+func liveFetcher(f Fetcher, limiter *HostLimiter, breaker *CircuitBreaker) Fetcher {
+	return Retrying(f, retryPolicy(), limiter, breaker)
+}
+
+/*
+ * retryPolicy
+ *
+ * Returns the retry policy for live fetches from config, with defaults for unset values.
+ *
+ * @return RetryPolicy
+ */
+func retryPolicy() RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts:    defaultMaxAttempts,
+		BaseDelay:      defaultRetryBaseDelay,
+		MaxDelay:       defaultRetryMaxDelay,
+		AttemptTimeout: requestTimeout(),
+	}
+	if config.Scraper.MaxAttempts > 0 {
+		policy.MaxAttempts = config.Scraper.MaxAttempts
+	}
+	if config.Scraper.RetryBaseDelay > 0 {
+		policy.BaseDelay = config.Scraper.RetryBaseDelay
+	}
+	return policy
+}
+
+/*
+ * requestTimeout
+ *
+ * Returns the time allowed for a single page fetch attempt, not counting rate limit waits.
+ *
+ * @return time.Duration
+ */
+func requestTimeout() time.Duration {
+	if config.Scraper.RequestTimeout > 0 {
+		return config.Scraper.RequestTimeout
+	}
+	return defaultRequestTimeout
+}
+
+/*
+ * fetchDocument
+ *
+ * Fetches a URL and parses it into a document.
+ *
+ * @param context.Context ctx
+ * @param Fetcher fetcher
+ * @param string link
+ *
+ * @return *goquery.Document
+ * @return int - HTTP status of the response, 0 if unknown
+ * @return error
+ */
+func fetchDocument(ctx context.Context, fetcher Fetcher, link string) (*goquery.Document, int, error) {
+	page, err := fetcher.Fetch(ctx, link)
+
+	status := 0
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		status = statusErr.StatusCode
+	} else if page != nil {
+		status = page.StatusCode
+	}
+
+	if err != nil {
+		return nil, status, err
+	}
+
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(page.HTML))
+	if err != nil {
+		return nil, status, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return document, status, nil
+}
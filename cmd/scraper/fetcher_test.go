@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixtureName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.bcferries.com/current-conditions/TSA-SWB", "current-conditions_TSA-SWB.html"},
+		{"https://www.bcferries.com/routes-fares/schedules/daily/FUL-SWB", "routes-fares_schedules_daily_FUL-SWB.html"},
+		{"https://www.bcferries.com/sailing-availability?departureTime=2026-02-22%2012:00:00&routeCode=TSA-SWB", "sailing-availability_departureTime-2026-02-22-12-00-00_routeCode-TSA-SWB.html"},
+	}
+
+	for _, tt := range tests {
+		if got := FixtureName(tt.url); got != tt.want {
+			t.Errorf("FixtureName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestDirFetcher_ServesCheckedInFixture(t *testing.T) {
+	fetcher := &DirFetcher{
+		Dir:     filepath.Join("..", "..", "html"),
+		Resolve: func(string) string { return "current_conditions.html" },
+	}
+
+	page, err := fetcher.Fetch(context.Background(), MakeCurrentConditionsLink("TSA", "SWB"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page.HTML) == 0 {
+		t.Fatalf("expected fixture HTML to be returned")
+	}
+
+	_, err = NewDirFetcher(t.TempDir()).Fetch(context.Background(), MakeCurrentConditionsLink("TSA", "SWB"))
+	if !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("expected ErrNotRecorded for missing fixture, got %v", err)
+	}
+}
+
+func TestCassetteFetcher_RecordAndReplay(t *testing.T) {
+	calls := 0
+	upstream := FetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+		calls++
+		return &Page{URL: url, StatusCode: 200, HTML: "<html>" + url + "</html>"}, nil
+	})
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading empty cassette: %v", err)
+	}
+	recorder.Upstream = upstream
+
+	link := MakeCurrentConditionsLink("HSB", "NAN")
+	for i := 0; i < 2; i++ {
+		if _, err := recorder.Fetch(context.Background(), link); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected upstream to be called once, got %d", calls)
+	}
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("failed to save cassette: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected cassette file to exist: %v", err)
+	}
+
+	replay, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+	page, err := replay.Fetch(context.Background(), link)
+	if err != nil || page.HTML != "<html>"+link+"</html>" {
+		t.Fatalf("expected recorded page, got %+v, %v", page, err)
+	}
+	if _, err := replay.Fetch(context.Background(), MakeCurrentConditionsLink("HSB", "LNG")); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("expected ErrNotRecorded, got %v", err)
+	}
+}
+
+func TestCassetteFetcher_RecordingFromSharesOneCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pageFrom := func(source string) Fetcher {
+		return FetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+			return &Page{URL: url, StatusCode: 200, HTML: source}, nil
+		})
+	}
+	capacity := cassette.RecordingFrom(pageFrom("http"))
+	schedule := cassette.RecordingFrom(pageFrom("browser"))
+
+	capacityLink := MakeCurrentConditionsLink("TSA", "SWB")
+	scheduleLink := MakeScheduleLink("TSA", "SGI")
+	for _, fetch := range []struct {
+		fetcher Fetcher
+		link    string
+	}{{capacity, capacityLink}, {schedule, scheduleLink}} {
+		if _, err := fetch.fetcher.Fetch(context.Background(), fetch.link); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	recording, recordingPath = cassette, path
+	defer func() { recording, recordingPath = nil, "" }()
+	saveRecording()
+
+	replay, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for link, want := range map[string]string{capacityLink: "http", scheduleLink: "browser"} {
+		if page, err := replay.Fetch(context.Background(), link); err != nil || page.HTML != want {
+			t.Errorf("replayed %s = %+v, %v; want the page recorded from %s", link, page, err, want)
+		}
+	}
+}
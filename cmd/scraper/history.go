@@ -0,0 +1,165 @@
+package scraper
+
+import (
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+/*
+ * CapacityObservations
+ *
+ * Turns the future sailings of a freshly scraped capacity route into fill
+ * observations for the capacity history. Sailings are dated in America/Vancouver
+ * time, using the "(Tomorrow)" marker from the page.
+ *
+ * Past, current and cancelled sailings carry no fill data and are left out.
+ *
+ * @param models.CapacityRoute route
+ * @param time.Time observedAt
+ *
+ * @return []models.CapacityObservation
+ */
+func CapacityObservations(route models.CapacityRoute, observedAt time.Time) []models.CapacityObservation {
+	loc := sailingtime.Location()
+	today := observedAt.In(loc)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	var observations []models.CapacityObservation
+	for _, sailing := range route.Sailings {
+		if sailing.SailingStatus != "future" || sailing.DepartureTime == "" {
+			continue
+		}
+
+		sailingDate := today
+		if sailing.IsTomorrow {
+			sailingDate = tomorrow
+		}
+
+		observations = append(observations, models.CapacityObservation{
+			RouteCode:     route.RouteCode,
+			SailingDate:   sailingDate.Format("2006-01-02"),
+			DepartureTime: sailing.DepartureTime,
+			ObservedAt:    observedAt,
+			SailingStatus: sailing.SailingStatus,
+			Fill:          sailing.Fill,
+			CarFill:       sailing.CarFill,
+			OversizeFill:  sailing.OversizeFill,
+			VesselName:    sailing.VesselName,
+		})
+	}
+
+	return observations
+}
+
+/*
+ * DepartureRecords
+ *
+ * Records how the sailings of a freshly scraped capacity route turned out, for
+ * on-time statistics. Sailings that have left are recorded with their delay and
+ * cancelled ones as cancelled; upcoming sailings are left out.
+ *
+ * Departed sailings are dated on the day of the scrape, or the day before if
+ * their departure time is later than the scrape, i.e. they left before midnight.
+ * Cancelled sailings are dated using the "(Tomorrow)" marker.
+ *
+ * @param models.CapacityRoute route
+ * @param time.Time scrapedAt
+ *
+ * @return []models.DepartureRecord
+ */
+func DepartureRecords(route models.CapacityRoute, scrapedAt time.Time) []models.DepartureRecord {
+	loc := sailingtime.Location()
+	today := scrapedAt.In(loc)
+
+	var records []models.DepartureRecord
+	for _, sailing := range route.Sailings {
+		if sailing.ScheduledDepartureTime == "" {
+			continue
+		}
+
+		record := models.DepartureRecord{
+			RouteCode:              route.RouteCode,
+			ScheduledDepartureTime: sailing.ScheduledDepartureTime,
+			VesselName:             sailing.VesselName,
+			RecordedAt:             scrapedAt,
+		}
+
+		switch sailing.SailingStatus {
+		case "past", "current":
+			if sailing.ActualDepartureTime == "" {
+				continue
+			}
+
+			sailingDate := today
+			if departed, err := time.ParseInLocation("2006-01-02 3:04 pm", today.Format("2006-01-02")+" "+sailing.ActualDepartureTime, loc); err == nil && departed.After(scrapedAt) {
+				sailingDate = today.AddDate(0, 0, -1)
+			}
+
+			record.SailingDate = sailingDate.Format("2006-01-02")
+			record.Outcome = models.DepartureDeparted
+			record.ActualDepartureTime = sailing.ActualDepartureTime
+			record.DelayMinutes = sailing.DelayMinutes
+			if sailing.SailingStatus == "past" {
+				record.ArrivalTime = sailing.ArrivalTime
+			}
+
+		case "cancelled":
+			sailingDate := today
+			if sailing.IsTomorrow {
+				sailingDate = today.AddDate(0, 0, 1)
+			}
+
+			record.SailingDate = sailingDate.Format("2006-01-02")
+			record.Outcome = models.DepartureCancelled
+
+		default:
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+/*
+ * CancellationEvents
+ *
+ * Returns the cancelled sailings of a freshly scraped capacity route, with the
+ * reason given on the page. Sailings are dated using the "(Tomorrow)" marker.
+ *
+ * @param models.CapacityRoute route
+ * @param time.Time scrapedAt - recorded as the time the cancellation was seen
+ *
+ * @return []models.CancellationEvent
+ */
+func CancellationEvents(route models.CapacityRoute, scrapedAt time.Time) []models.CancellationEvent {
+	loc := sailingtime.Location()
+	today := scrapedAt.In(loc)
+
+	var events []models.CancellationEvent
+	for _, sailing := range route.Sailings {
+		if sailing.SailingStatus != "cancelled" || sailing.ScheduledDepartureTime == "" {
+			continue
+		}
+
+		sailingDate := today
+		if sailing.IsTomorrow {
+			sailingDate = today.AddDate(0, 0, 1)
+		}
+
+		events = append(events, models.CancellationEvent{
+			RouteCode:              route.RouteCode,
+			SailingDate:            sailingDate.Format("2006-01-02"),
+			ScheduledDepartureTime: sailing.ScheduledDepartureTime,
+			VesselName:             sailing.VesselName,
+			Reason:                 sailing.VesselStatus,
+			FirstSeenAt:            scrapedAt,
+			LastSeenAt:             scrapedAt,
+		})
+	}
+
+	return events
+}
@@ -0,0 +1,93 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestCapacityObservations_DatesFutureSailings(t *testing.T) {
+	route := models.CapacityRoute{
+		RouteCode: "TSASWB",
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "7:00 am", SailingStatus: "departed"},
+			{DepartureTime: "9:00 pm", SailingStatus: "future", Fill: 40, CarFill: 35, OversizeFill: 60, VesselName: "Spirit of Vancouver Island"},
+			{DepartureTime: "11:00 pm", SailingStatus: "cancelled", IsTomorrow: true},
+			{DepartureTime: "7:00 am", SailingStatus: "future", IsTomorrow: true, Fill: 5},
+		},
+	}
+
+	// 2024-06-02 05:30 UTC is still June 1st in Vancouver
+	observedAt := time.Date(2024, 6, 2, 5, 30, 0, 0, time.UTC)
+	observations := CapacityObservations(route, observedAt)
+
+	if len(observations) != 2 {
+		t.Fatalf("got %d observations, want 2: %+v", len(observations), observations)
+	}
+
+	first := observations[0]
+	if first.SailingDate != "2024-06-01" || first.DepartureTime != "9:00 pm" || first.Fill != 40 || first.CarFill != 35 || first.OversizeFill != 60 {
+		t.Errorf("first observation = %+v", first)
+	}
+	if !first.ObservedAt.Equal(observedAt) || first.RouteCode != "TSASWB" {
+		t.Errorf("first observation = %+v", first)
+	}
+
+	if second := observations[1]; second.SailingDate != "2024-06-02" || second.DepartureTime != "7:00 am" {
+		t.Errorf("second observation = %+v", second)
+	}
+}
+
+func TestDepartureRecords(t *testing.T) {
+	route := models.CapacityRoute{
+		RouteCode: "TSASWB",
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "11:10 pm", ScheduledDepartureTime: "11:00 pm", ActualDepartureTime: "11:10 pm", DelayMinutes: 10, ArrivalTime: "12:45 am", SailingStatus: "past"},
+			{DepartureTime: "7:02 am", ScheduledDepartureTime: "7:00 am", ActualDepartureTime: "7:02 am", DelayMinutes: 2, ArrivalTime: "Variable", SailingStatus: "current"},
+			{DepartureTime: "9:00 am", ScheduledDepartureTime: "9:00 am", SailingStatus: "future"},
+			{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "cancelled", IsTomorrow: true},
+		},
+	}
+
+	scrapedAt := time.Date(2024, 6, 1, 7, 30, 0, 0, time.FixedZone("PDT", -7*60*60))
+	records := DepartureRecords(route, scrapedAt)
+
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3: %+v", len(records), records)
+	}
+	if r := records[0]; r.SailingDate != "2024-05-31" || r.Outcome != models.DepartureDeparted || r.DelayMinutes != 10 || r.ArrivalTime != "12:45 am" {
+		t.Errorf("overnight record = %+v", r)
+	}
+	if r := records[1]; r.SailingDate != "2024-06-01" || r.ArrivalTime != "" {
+		t.Errorf("underway record = %+v", r)
+	}
+	if r := records[2]; r.SailingDate != "2024-06-02" || r.Outcome != models.DepartureCancelled {
+		t.Errorf("cancelled record = %+v", r)
+	}
+}
+
+func TestCancellationEvents(t *testing.T) {
+	route := models.CapacityRoute{
+		RouteCode: "TSASWB",
+		Sailings: []models.CapacitySailing{
+			{DepartureTime: "3:00 pm", ScheduledDepartureTime: "3:00 pm", SailingStatus: "future"},
+			{DepartureTime: "5:00 pm", ScheduledDepartureTime: "5:00 pm", SailingStatus: "cancelled", VesselName: "Queen of Oak Bay", VesselStatus: "Mechanical difficulties"},
+			{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "cancelled", IsTomorrow: true},
+		},
+	}
+
+	// 2024-06-02 05:30 UTC is still June 1st in Vancouver
+	scrapedAt := time.Date(2024, 6, 2, 5, 30, 0, 0, time.UTC)
+	events := CancellationEvents(route, scrapedAt)
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if e := events[0]; e.SailingDate != "2024-06-01" || e.Reason != "Mechanical difficulties" || e.VesselName != "Queen of Oak Bay" || !e.FirstSeenAt.Equal(scrapedAt) {
+		t.Errorf("first event = %+v", e)
+	}
+	if e := events[1]; e.SailingDate != "2024-06-02" || e.ScheduledDepartureTime != "7:00 am" {
+		t.Errorf("second event = %+v", e)
+	}
+}
@@ -0,0 +1,765 @@
+package scraper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+// ParseWarning describes a part of a page that could not be parsed. Parsing
+// carries on past warnings, so a route may still be returned with gaps.
+type ParseWarning struct {
+	RouteCode string `json:"routeCode"`
+	Row       int    `json:"row"` // Index of the sailing row, -1 for route-level warnings
+	Message   string `json:"message"`
+}
+
+func (w ParseWarning) String() string {
+	if w.Row < 0 {
+		return fmt.Sprintf("%s: %s", w.RouteCode, w.Message)
+	}
+	return fmt.Sprintf("%s row %d: %s", w.RouteCode, w.Row, w.Message)
+}
+
+var (
+	scheduledSailingRe = regexp.MustCompile(`(?P<Time>\d{1,2}:\d{2} [ap]m)(?P<Tomorrow> \(Tomorrow\))? (?P<VesselName>.+)`)
+	departedSailingRe  = regexp.MustCompile(`(?P<DepartureTime>\d{1,2}:\d{2} [ap]m) Departed (?P<ActualDepartureTime>\d{1,2}:\d{2} [ap]m) (?P<VesselName>.+)`)
+	arrivedRe          = regexp.MustCompile(`Arrived: (?P<ArrivalTime>\d{1,2}:\d{2} [ap]m)`)
+	etaRe              = regexp.MustCompile(`ETA : (?P<ETA>\d{1,2}:\d{2} [ap]m|Variable)`)
+	clockTimeRe        = regexp.MustCompile(`(?i)\b\d{1,2}:\d{2}\s*[ap]m\b`)
+)
+
+/*******************/
+/* Capacity Routes */
+/*******************/
+
+/*
+ * CapacityDetailsLinks
+ *
+ * Returns the absolute vehicle details links found on a current conditions page,
+ * in page order and without duplicates. These pages hold the per-vehicle-type
+ * fill percentages used by ParseCapacityRoute.
+ *
+ * @param *goquery.Document document
+ *
+ * @return []string
+ */
+func CapacityDetailsLinks(document *goquery.Document) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	document.Find("table.detail-departure-table tbody tr.mobile-friendly-row").Each(func(_ int, row *goquery.Selection) {
+		td := row.Find("td").Eq(1)
+		if !strings.Contains(td.Text(), "Details") {
+			return
+		}
+		for _, link := range detailsLinks(td) {
+			if !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	})
+
+	return links
+}
+
+/*
+ * ParseCapacityRoute
+ *
+ * Parses a current conditions page into a capacity route. Vehicle details pages
+ * are looked up in details by the links returned from CapacityDetailsLinks; when
+ * one is missing the summary percentage on the main page is used instead.
+ *
+ * Does no I/O, so it can be run against saved pages.
+ *
+ * @param *goquery.Document document
+ * @param string fromTerminalCode
+ * @param string toTerminalCode
+ * @param map[string]*goquery.Document details - details pages keyed by link, may be nil
+ *
+ * @return models.CapacityRoute
+ * @return []ParseWarning
+ */
+func ParseCapacityRoute(document *goquery.Document, fromTerminalCode, toTerminalCode string, details map[string]*goquery.Document) (models.CapacityRoute, []ParseWarning) {
+	route := models.CapacityRoute{
+		RouteCode:        fromTerminalCode + toTerminalCode,
+		ToTerminalCode:   toTerminalCode,
+		FromTerminalCode: fromTerminalCode,
+		Sailings:         []models.CapacitySailing{},
+	}
+
+	var warnings []ParseWarning
+	warn := func(row int, format string, args ...interface{}) {
+		warnings = append(warnings, ParseWarning{RouteCode: route.RouteCode, Row: row, Message: fmt.Sprintf(format, args...)})
+	}
+
+	rowIndex := 0
+	document.Find("table.detail-departure-table").Each(func(_ int, table *goquery.Selection) {
+		table.Find("tbody").Each(func(_ int, tbody *goquery.Selection) {
+			tbody.Find("tr.mobile-friendly-row").Each(func(_ int, row *goquery.Selection) {
+				index := rowIndex
+				rowIndex++
+
+				sailing := models.CapacitySailing{}
+				rowText := row.Text()
+				rowTextLower := strings.ToLower(rowText)
+				tds := row.Find("td")
+				timeCell := tds.Eq(0)
+				statusCell := tds.Eq(1)
+
+				switch {
+				// Handle explicitly cancelled rows
+				case strings.Contains(rowTextLower, "cancelled"):
+					sailing.SailingStatus = "cancelled"
+
+					// Scheduled time and vessel
+					if matches := scheduledSailingRe.FindStringSubmatch(collapseSpaces(timeCell.Text())); len(matches) >= 4 {
+						sailing.DepartureTime = matches[1]
+						sailing.ScheduledDepartureTime = matches[1]
+						sailing.IsTomorrow = matches[2] != ""
+						sailing.VesselName = matches[3]
+					} else {
+						warn(index, "cancelled sailing time and vessel not found")
+					}
+
+					// Capture reason if present under the red text block
+					// Prefer the second <p> which often holds the reason
+					reason := strings.TrimSpace(statusCell.Find("div.text-red p").Eq(1).Text())
+					if reason == "" {
+						// Fallback to the whole red block text
+						reason = strings.TrimSpace(statusCell.Find("div.text-red").Text())
+					}
+					if reason != "" {
+						sailing.VesselStatus = reason
+					}
+
+				case strings.Contains(rowText, "Arrived"):
+					sailing.SailingStatus = "past"
+
+					if matches := departedSailingRe.FindStringSubmatch(collapseSpaces(timeCell.Find("p").Text())); len(matches) == 0 {
+						warn(index, "departed sailing time and vessel not found")
+					} else {
+						sailing.DepartureTime = matches[2]
+						sailing.ScheduledDepartureTime = matches[1]
+						sailing.ActualDepartureTime = matches[2]
+						sailing.DelayMinutes = delayMinutes(matches[1], matches[2])
+						sailing.VesselName = matches[3]
+					}
+
+					if matches := arrivedRe.FindStringSubmatch(collapseSpaces(statusCell.Find("div.cc-message-updates").Text())); len(matches) == 0 {
+						warn(index, "arrival time not found")
+					} else {
+						sailing.ArrivalTime = matches[1]
+					}
+
+				case strings.Contains(rowText, "ETA") || strings.Contains(rowText, "..."):
+					sailing.SailingStatus = "current"
+
+					if matches := departedSailingRe.FindStringSubmatch(collapseSpaces(timeCell.Find("p").Text())); len(matches) == 0 {
+						warn(index, "departed sailing time and vessel not found")
+					} else {
+						sailing.DepartureTime = matches[2]
+						sailing.ScheduledDepartureTime = matches[1]
+						sailing.ActualDepartureTime = matches[2]
+						sailing.DelayMinutes = delayMinutes(matches[1], matches[2])
+						sailing.VesselName = matches[3]
+					}
+
+					if matches := etaRe.FindStringSubmatch(collapseSpaces(statusCell.Find("div.cc-message-updates").Text())); len(matches) == 0 {
+						sailing.ArrivalTime = "..."
+					} else {
+						sailing.ArrivalTime = matches[1]
+					}
+
+				case strings.Contains(rowText, "Details") || strings.Contains(rowText, "%") || strings.Contains(rowTextLower, "full"):
+					sailing.SailingStatus = "future"
+
+					// Schedule time, vessel
+					if matches := scheduledSailingRe.FindStringSubmatch(collapseSpaces(timeCell.Text())); len(matches) == 0 {
+						warn(index, "scheduled sailing time and vessel not found")
+					} else {
+						sailing.DepartureTime = matches[1]
+						sailing.ScheduledDepartureTime = matches[1]
+						sailing.IsTomorrow = matches[2] != ""
+						sailing.VesselName = matches[3]
+					}
+
+					parseSailingFill(&sailing, statusCell, details, func(format string, args ...interface{}) {
+						warn(index, format, args...)
+					})
+
+				default:
+					warn(index, "unrecognised sailing row")
+				}
+
+				// Add sailing to route
+				route.Sailings = append(route.Sailings, sailing)
+			})
+		})
+	})
+
+	if len(route.Sailings) == 0 {
+		warn(-1, "no sailing rows found")
+	}
+
+	// Try to find sailing duration text in a case-insensitive way
+	sailingDuration := ""
+	document.Find("span").Each(func(_ int, s *goquery.Selection) {
+		if sailingDuration != "" {
+			return
+		}
+		txt := strings.ReplaceAll(s.Text(), "\u00a0", " ")
+		if strings.Contains(strings.ToLower(txt), "sailing duration:") {
+			sailingDuration = txt
+		}
+	})
+	sailingDuration = strings.ReplaceAll(sailingDuration, "Sailing duration:", "")
+	sailingDuration = strings.ReplaceAll(sailingDuration, "sailing duration:", "")
+	route.SailingDuration = strings.TrimSpace(sailingDuration)
+	if route.SailingDuration == "" {
+		warn(-1, "sailing duration not found")
+	}
+
+	return route, warnings
+}
+
+/*
+ * delayMinutes
+ *
+ * Returns how many minutes after its scheduled time a sailing left, negative if
+ * it left early. Departures either side of midnight are taken to be the
+ * closer of the two ways round.
+ *
+ * @param string scheduled - e.g. "7:00 am"
+ * @param string actual - e.g. "7:12 am"
+ *
+ * @return int - 0 if either time can't be parsed
+ */
+func delayMinutes(scheduled, actual string) int {
+	scheduledMinutes, ok := sailingtime.ClockMinutes(scheduled)
+	if !ok {
+		return 0
+	}
+	actualMinutes, ok := sailingtime.ClockMinutes(actual)
+	if !ok {
+		return 0
+	}
+
+	delay := actualMinutes - scheduledMinutes
+	switch {
+	case delay > 12*60:
+		delay -= 24 * 60
+	case delay < -12*60:
+		delay += 24 * 60
+	}
+	return delay
+}
+
+/*
+ * parseSailingFill
+ *
+ * Fills in the fill percentages of a future sailing from its status cell. If the
+ * cell links to a details page present in details, the per-vehicle-type values
+ * are read from it, otherwise the summary percentage in the cell is used.
+ *
+ * @param *models.CapacitySailing sailing
+ * @param *goquery.Selection td
+ * @param map[string]*goquery.Document details
+ * @param func(string, ...interface{}) warn
+ *
+ * @return void
+ */
+func parseSailingFill(sailing *models.CapacitySailing, td *goquery.Selection, details map[string]*goquery.Document, warn func(string, ...interface{})) {
+	fillDetailsString := td.Text()
+
+	if strings.Contains(strings.ToLower(fillDetailsString), "full") && !strings.Contains(fillDetailsString, "Details") {
+		sailing.Fill = 100
+		sailing.CarFill = 100
+		sailing.OversizeFill = 100
+		return
+	}
+
+	// If word "Details" is in the cell prefer the details page, otherwise take percentage
+	if strings.Contains(fillDetailsString, "Details") {
+		for _, link := range detailsLinks(td) {
+			if fillDocument, ok := details[link]; ok && fillDocument != nil {
+				for _, message := range ParseVehicleDetails(fillDocument, sailing) {
+					warn("%s", message)
+				}
+				return
+			}
+		}
+		warn("details page unavailable, using summary percentage")
+	}
+
+	fillPercentage := strings.TrimSpace(strings.ReplaceAll(td.Find("span.cc-vessel-percent-full").Text(), "\u00a0", " "))
+	available, err := strconv.Atoi(strings.ReplaceAll(fillPercentage, "%", ""))
+	if err != nil {
+		warn("invalid fill percentage %q", fillPercentage)
+		return
+	}
+
+	sailing.Fill = 100 - available
+}
+
+/*
+ * ParseVehicleDetails
+ *
+ * Reads the total, car and oversize space available from a vehicle details page
+ * into the sailing's fill percentages.
+ *
+ * @param *goquery.Document fillDocument
+ * @param *models.CapacitySailing sailing
+ *
+ * @return []string - messages for values that could not be parsed
+ */
+func ParseVehicleDetails(fillDocument *goquery.Document, sailing *models.CapacitySailing) []string {
+	var messages []string
+
+	fillDocument.Find("p.vehicle-icon-text").Each(func(o int, percentageText *goquery.Selection) {
+		fillPercentage := strings.TrimSpace(percentageText.Text())
+		isFull := strings.Contains(strings.ToLower(fillPercentage), "full")
+
+		fill := 100
+		if !isFull {
+			available, err := strconv.Atoi(strings.ReplaceAll(fillPercentage, "%", ""))
+			if err != nil {
+				messages = append(messages, fmt.Sprintf("invalid details percentage %q", fillPercentage))
+				return
+			}
+			fill = 100 - available
+		}
+
+		switch o {
+		case 0:
+			sailing.Fill = fill
+			if isFull {
+				sailing.CarFill = 100
+				sailing.OversizeFill = 100
+			}
+		case 1:
+			sailing.CarFill = fill
+		case 2:
+			sailing.OversizeFill = fill
+		}
+	})
+
+	return messages
+}
+
+/***********************/
+/* Non Capacity Routes */
+/***********************/
+
+/*
+ * ParseNonCapacityRoute
+ *
+ * Parses a daily or seasonal schedule page into the sailings running on the day
+ * of now, in America/Vancouver time. Daily pages are tried first when isDaily is
+ * set, falling back to the seasonal table layout.
+ *
+ * Does no I/O, so it can be run against saved pages.
+ *
+ * @param *goquery.Document document
+ * @param string fromTerminalCode
+ * @param string toTerminalCode
+ * @param bool isDaily
+ * @param time.Time now
+ *
+ * @return models.NonCapacityRoute
+ * @return []ParseWarning
+ */
+func ParseNonCapacityRoute(document *goquery.Document, fromTerminalCode, toTerminalCode string, isDaily bool, now time.Time) (models.NonCapacityRoute, []ParseWarning) {
+	route := models.NonCapacityRoute{
+		RouteCode:        fromTerminalCode + toTerminalCode,
+		FromTerminalCode: fromTerminalCode,
+		ToTerminalCode:   toTerminalCode,
+		Sailings:         []models.NonCapacitySailing{},
+	}
+
+	var warnings []ParseWarning
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, ParseWarning{RouteCode: route.RouteCode, Row: -1, Message: fmt.Sprintf(format, args...)})
+	}
+
+	loc := sailingtime.Location()
+	today := now.In(loc)
+	todayNorm := normalizeDay(today.Weekday().String()) // e.g. "MONDAY"
+
+	if isDaily {
+		if dailySailings, dailyDuration, ok := parseDailyScheduleSailings(document); ok {
+			route.Sailings = dailySailings
+			route.SailingDuration = dailyDuration
+		}
+	}
+
+	if len(route.Sailings) == 0 {
+		// ---- Step 1: find the seasonal schedule table that contains weekday theads
+		var scheduleTable *goquery.Selection
+		document.Find("table.table-seasonal-schedule").Each(func(_ int, t *goquery.Selection) {
+			if scheduleTable != nil {
+				return
+			}
+			// Heuristic: a real schedule table has thead rows with day labels
+			if t.Find("thead tr[data-schedule-day], thead [data-schedule-day], thead h4, thead b").Length() > 0 {
+				scheduleTable = t
+			}
+		})
+		// Fallback to the historical assumption (2nd table) if heuristic fails
+		if scheduleTable == nil {
+			scheduleTable = document.Find("table.table-seasonal-schedule").Eq(1)
+		}
+		if scheduleTable == nil || scheduleTable.Length() == 0 {
+			warn("seasonal schedule table not found")
+			return route, warnings
+		}
+
+		// ---- Step 2: find the <thead> whose day matches today (MONDAY vs MONDAYS, any case)
+		var dayBody *goquery.Selection
+		scheduleTable.Find("thead").Each(func(_ int, thead *goquery.Selection) {
+			if dayBody != nil {
+				return
+			}
+
+			// Prefer the attribute if present.
+			dayAttr := thead.Find("tr").First().AttrOr("data-schedule-day", "")
+			dayAttrNorm := normalizeDay(dayAttr)
+
+			match := (dayAttrNorm != "" && dayAttrNorm == todayNorm)
+			if !match {
+				// Fallback: try visible text inside thead (e.g., MONDAY Depart)
+				txt := thead.Find("h4, b, th").First().Text()
+				txtNorm := normalizeDay(txt)
+				// If the text contains the weekday token (e.g., "MONDAY DEPART"), accept it.
+				match = (txtNorm == todayNorm) || strings.Contains(txtNorm, todayNorm)
+			}
+
+			if match {
+				// ---- Step 3: go to the NEXT sibling under the table; skip to the first <tbody>
+				tb := thead.Next()
+				for tb.Length() > 0 && goquery.NodeName(tb) != "tbody" {
+					tb = tb.Next()
+				}
+				if tb.Length() > 0 && goquery.NodeName(tb) == "tbody" {
+					dayBody = tb
+				}
+			}
+		})
+
+		if dayBody == nil {
+			warn("no tbody found for today (%s) in schedule table", todayNorm)
+			return route, warnings
+		}
+
+		// ---- Step 4: parse rows in the found <tbody>
+		dayBody.Find("tr.schedule-table-row").Each(func(_ int, row *goquery.Selection) {
+			tds := row.Find("td")
+			if tds.Length() < 3 {
+				return
+			}
+
+			// Extract clean departure time (first time token) and any status notes
+			depCell := tds.Eq(1)
+			depRaw := cleanText(depCell.Text())
+
+			// Capture red/black status notes if present (e.g., Only on..., Except on..., Foot passengers only, Dangerous goods only)
+			var statuses []string
+			var redNotes []string
+			depCell.Find("p").Each(func(_ int, p *goquery.Selection) {
+				txt := cleanText(p.Text())
+				if txt == "" {
+					return
+				}
+				// Only keep informative notes, skip if it's just whitespace
+				// Common classes include red-text italic-style or text-black
+				if p.HasClass("red-text") || p.HasClass("text-black") {
+					statuses = append(statuses, txt)
+					if p.HasClass("red-text") {
+						redNotes = append(redNotes, txt)
+					}
+				}
+			})
+
+			// Extract the first time-like token from the departure cell
+			depTime := depRaw
+			if m := clockTimeRe.FindString(depRaw); m != "" {
+				depTime = m
+			}
+
+			// Extract clean arrival time (first time token)
+			arrRaw := cleanText(tds.Eq(2).Text())
+			arrTime := arrRaw
+			if m := clockTimeRe.FindString(arrRaw); m != "" {
+				arrTime = m
+			}
+
+			// Filter: drop dangerous goods only sailings outright
+			depLower := strings.ToLower(depCell.Text())
+			if strings.Contains(depLower, "dangerous goods only") || strings.Contains(depLower, "no passengers permitted") {
+				return
+			}
+
+			// Apply exception rules: "Only on <dates>" and "Except on <dates>"
+			// Build a combined note string from red notes
+			combinedRed := strings.ToLower(strings.Join(redNotes, "; "))
+			todayKey := fmt.Sprintf("%02d-%02d", int(today.Month()), today.Day())
+
+			// If there is an "only on" note, include only if today is listed
+			if strings.Contains(combinedRed, "only on") {
+				dates := parseMentionedDates(combinedRed)
+				if _, ok := dates[todayKey]; !ok {
+					return
+				}
+			}
+			// If there is an "except on" note, exclude if today is listed
+			if strings.Contains(combinedRed, "except on") {
+				dates := parseMentionedDates(combinedRed)
+				if _, ok := dates[todayKey]; ok {
+					return
+				}
+			}
+
+			s := models.NonCapacitySailing{
+				DepartureTime: depTime,
+				ArrivalTime:   arrTime,
+			}
+			if len(statuses) > 0 {
+				s.VesselStatus = strings.Join(statuses, " | ")
+			}
+
+			if s.DepartureTime != "" || s.ArrivalTime != "" {
+				route.Sailings = append(route.Sailings, s)
+			}
+		})
+
+		// Optional: route-level duration (from the first row's 4th cell, if present)
+		if firstRow := dayBody.Find("tr.schedule-table-row").First(); firstRow.Length() > 0 {
+			if cell := firstRow.Find("td").Eq(3); cell.Length() > 0 {
+				route.SailingDuration = cleanText(cell.Text())
+			}
+		}
+	}
+
+	if len(route.Sailings) == 0 {
+		warn("no sailings parsed")
+	}
+
+	return route, warnings
+}
+
+func parseDailyScheduleSailings(document *goquery.Document) ([]models.NonCapacitySailing, string, bool) {
+	durationRe := regexp.MustCompile(`\b\d{1,2}:\d{2}\b`)
+	extractTime := func(s string) string {
+		return clockTimeRe.FindString(cleanText(s))
+	}
+
+	var sailings []models.NonCapacitySailing
+	sailingDuration := ""
+
+	document.Find("table").Each(func(_ int, table *goquery.Selection) {
+		if len(sailings) > 0 {
+			return
+		}
+
+		headerText := strings.ToUpper(cleanText(table.Find("thead").First().Text()))
+		if headerText == "" {
+			headerText = strings.ToUpper(cleanText(table.Find("tr").First().Text()))
+		}
+		if !strings.Contains(headerText, "DEPART") || !strings.Contains(headerText, "ARRIVE") {
+			return
+		}
+
+		tableSailings := make([]models.NonCapacitySailing, 0)
+		tableDuration := ""
+
+		rows := table.Find("tbody tr")
+		if rows.Length() == 0 {
+			rows = table.Find("tr")
+		}
+
+		rows.Each(func(_ int, row *goquery.Selection) {
+			if row.Find("th").Length() > 0 {
+				return
+			}
+
+			tds := row.Find("td")
+			if tds.Length() < 2 {
+				return
+			}
+
+			rowTextLower := strings.ToLower(cleanText(row.Text()))
+			if strings.Contains(rowTextLower, "dangerous goods only") || strings.Contains(rowTextLower, "no passengers permitted") {
+				return
+			}
+
+			var timeTokens []string
+			tds.Each(func(_ int, td *goquery.Selection) {
+				if m := extractTime(td.Text()); m != "" {
+					timeTokens = append(timeTokens, m)
+				}
+			})
+			if len(timeTokens) == 0 {
+				return
+			}
+			departureTime := timeTokens[0]
+			arrivalTime := ""
+			if len(timeTokens) > 1 {
+				arrivalTime = timeTokens[1]
+			}
+
+			if tableDuration == "" {
+				tds.Each(func(_ int, td *goquery.Selection) {
+					if tableDuration != "" {
+						return
+					}
+					tdText := cleanText(td.Text())
+					if tdText == "" {
+						return
+					}
+					tdTextLower := strings.ToLower(tdText)
+					if strings.Contains(tdTextLower, "am") || strings.Contains(tdTextLower, "pm") {
+						return
+					}
+					if m := durationRe.FindString(tdText); m != "" {
+						tableDuration = m
+					}
+				})
+			}
+
+			tableSailings = append(tableSailings, models.NonCapacitySailing{
+				DepartureTime: departureTime,
+				ArrivalTime:   arrivalTime,
+			})
+		})
+
+		if len(tableSailings) == 0 {
+			return
+		}
+
+		sailings = tableSailings
+		sailingDuration = tableDuration
+	})
+
+	return sailings, sailingDuration, len(sailings) > 0
+}
+
+/********************/
+/* Helper Functions */
+/********************/
+
+/*
+ * parseMentionedDates
+ *
+ * Parses a list of month/day mentions from a status string like
+ * "Only on Sep 14, 28 & Oct 12" or "Except on Oct 13".
+ *
+ * @param string note
+ *
+ * @return map[string]struct{} - set keyed by "MM-DD" for quick lookup
+ */
+func parseMentionedDates(note string) map[string]struct{} {
+	res := make(map[string]struct{})
+	if note == "" {
+		return res
+	}
+	lower := strings.ToLower(note)
+
+	monthMap := map[string]time.Month{
+		"jan": time.January, "january": time.January,
+		"feb": time.February, "february": time.February,
+		"mar": time.March, "march": time.March,
+		"apr": time.April, "april": time.April,
+		"may": time.May,
+		"jun": time.June, "june": time.June,
+		"jul": time.July, "july": time.July,
+		"aug": time.August, "august": time.August,
+		"sep": time.September, "sept": time.September, "september": time.September,
+		"oct": time.October, "october": time.October,
+		"nov": time.November, "november": time.November,
+		"dec": time.December, "december": time.December,
+	}
+
+	// 1) Find explicit Month Day pairs
+	mdRe := regexp.MustCompile(`(?i)(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|jun(?:e)?|jul(?:y)?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\s+(\d{1,2})`)
+	matches := mdRe.FindAllStringSubmatch(lower, -1)
+
+	for _, m := range matches {
+		monKey := m[1]
+		dayStr := m[2]
+		if mon, ok := monthMap[monKey]; ok {
+			if d, err := strconv.Atoi(dayStr); err == nil {
+				key := fmt.Sprintf("%02d-%02d", int(mon), d)
+				res[key] = struct{}{}
+			}
+		}
+	}
+
+	// 2) Handle shorthand days following a month (e.g., "Sep 14, 28 & Oct 12")
+	//    For each segment that starts with a month, capture trailing , <day> pieces until next month appears
+	segRe := regexp.MustCompile(`(?i)(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|jun(?:e)?|jul(?:y)?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\s+\d{1,2}([^a-z]*)`)
+	pos := 0
+	for {
+		loc := segRe.FindStringSubmatchIndex(lower[pos:])
+		if loc == nil {
+			break
+		}
+		// Extract month for this segment
+		seg := lower[pos+loc[0] : pos+loc[1]]
+		mon := mdRe.FindStringSubmatch(seg)
+		if len(mon) >= 3 {
+			monKey := mon[1]
+			if monVal, ok := monthMap[monKey]; ok {
+				// After the first "Month DD", scan the tail for , DD patterns
+				tail := seg[len(mon[0]):]
+				// Match bare days like ", 28" without unsupported lookaheads
+				ddRe := regexp.MustCompile(`(?i)[,&\s]+(\d{1,2})\b`)
+				ddMatches := ddRe.FindAllStringSubmatch(tail, -1)
+				for _, dm := range ddMatches {
+					if d, err := strconv.Atoi(dm[1]); err == nil {
+						key := fmt.Sprintf("%02d-%02d", int(monVal), d)
+						res[key] = struct{}{}
+					}
+				}
+			}
+		}
+		pos += loc[1]
+	}
+
+	return res
+}
+
+// detailsLinks returns the absolute vehicle details links within a status cell.
+func detailsLinks(td *goquery.Selection) []string {
+	var links []string
+	td.Find("a.vehicle-info-link").Each(func(_ int, s *goquery.Selection) {
+		if href, exists := s.Attr("href"); exists {
+			links = append(links, strings.ReplaceAll("https://www.bcferries.com"+href, " ", "%20"))
+		}
+	})
+	return links
+}
+
+// normalizeDay upper-cases a weekday and treats a trailing "S" as optional: MONDAY == MONDAYS
+func normalizeDay(s string) string {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	return strings.TrimSuffix(s, "S")
+}
+
+// cleanText converts NBSPs to spaces and trims the result
+func cleanText(s string) string {
+	s = strings.ReplaceAll(s, "\u00a0", " ")
+	return strings.TrimSpace(s)
+}
+
+// collapseSpaces trims s and collapses every run of whitespace to a single space
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,275 @@
+package scraper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/sailingtime"
+)
+
+func loadFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+
+	fixturePath := filepath.Join("..", "..", "html", name)
+	html, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Skipf("fixture not found at %s: %v", fixturePath, err)
+	}
+
+	document, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		t.Fatalf("failed to parse fixture HTML: %v", err)
+	}
+
+	return document
+}
+
+func documentFromString(t *testing.T, html string) *goquery.Document {
+	t.Helper()
+
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("failed to parse HTML: %v", err)
+	}
+
+	return document
+}
+
+func TestParseCapacityRoute_CurrentConditionsFixture(t *testing.T) {
+	document := loadFixture(t, "current_conditions.html")
+
+	route, warnings := ParseCapacityRoute(document, "TSA", "SWB", nil)
+
+	if route.RouteCode != "TSASWB" {
+		t.Fatalf("expected route code TSASWB, got %q", route.RouteCode)
+	}
+	if route.SailingDuration != "1h 35m" {
+		t.Fatalf("expected sailing duration 1h 35m, got %q", route.SailingDuration)
+	}
+	if len(route.Sailings) != 15 {
+		t.Fatalf("expected 15 sailings, got %d", len(route.Sailings))
+	}
+
+	tests := []struct {
+		row  int
+		want models.CapacitySailing
+	}{
+		{0, models.CapacitySailing{DepartureTime: "6:58 am", ScheduledDepartureTime: "7:00 am", ActualDepartureTime: "6:58 am", DelayMinutes: -2, ArrivalTime: "8:28 am", SailingStatus: "past", VesselName: "Spirit of British Columbia"}},
+		{1, models.CapacitySailing{DepartureTime: "9:04 am", ScheduledDepartureTime: "9:00 am", ActualDepartureTime: "9:04 am", DelayMinutes: 4, ArrivalTime: "10:29 am", SailingStatus: "past", VesselName: "Coastal Renaissance"}},
+		{2, models.CapacitySailing{DepartureTime: "11:00 am", ScheduledDepartureTime: "11:00 am", SailingStatus: "future", Fill: 100, CarFill: 100, OversizeFill: 100, VesselName: "Spirit of British Columbia"}},
+		{3, models.CapacitySailing{DepartureTime: "12:00 pm", ScheduledDepartureTime: "12:00 pm", SailingStatus: "future", Fill: 85, VesselName: "Queen of New Westminster"}},
+		{12, models.CapacitySailing{DepartureTime: "7:00 am", ScheduledDepartureTime: "7:00 am", SailingStatus: "future", Fill: 80, VesselName: "Spirit of British Columbia", IsTomorrow: true}},
+	}
+
+	for _, tt := range tests {
+		if got := route.Sailings[tt.row]; got != tt.want {
+			t.Errorf("row %d: got %+v, want %+v", tt.row, got, tt.want)
+		}
+	}
+
+	// Without details pages every "Details" row falls back to the summary percentage
+	if len(warnings) != 12 {
+		t.Fatalf("expected 12 warnings, got %d: %v", len(warnings), warnings)
+	}
+	for _, warning := range warnings {
+		if warning.RouteCode != "TSASWB" || !strings.Contains(warning.Message, "details page unavailable") {
+			t.Errorf("unexpected warning: %s", warning)
+		}
+	}
+}
+
+func TestParseCapacityRoute_UsesDetailsPages(t *testing.T) {
+	document := loadFixture(t, "current_conditions.html")
+
+	links := CapacityDetailsLinks(document)
+	if len(links) != 12 {
+		t.Fatalf("expected 12 details links, got %d", len(links))
+	}
+	if want := "https://www.bcferries.com/sailing-availability?departureTime=2026-02-22%2012:00:00&routeCode=TSA-SWB"; links[0] != want {
+		t.Fatalf("expected first details link %q, got %q", want, links[0])
+	}
+
+	details := map[string]*goquery.Document{
+		links[0]: documentFromString(t, `<p class="vehicle-icon-text">40%</p><p class="vehicle-icon-text">Full</p><p class="vehicle-icon-text">75%</p>`),
+	}
+
+	route, warnings := ParseCapacityRoute(document, "TSA", "SWB", details)
+
+	want := models.CapacitySailing{DepartureTime: "12:00 pm", ScheduledDepartureTime: "12:00 pm", SailingStatus: "future", Fill: 60, CarFill: 100, OversizeFill: 25, VesselName: "Queen of New Westminster"}
+	if got := route.Sailings[3]; got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if len(warnings) != 11 {
+		t.Fatalf("expected 11 warnings, got %d", len(warnings))
+	}
+}
+
+func TestParseCapacityRoute_RowKinds(t *testing.T) {
+	wrap := func(rows string) string {
+		return `<table class="detail-departure-table"><tbody>` + rows + `</tbody></table><span>Sailing duration:&nbsp;1h 40m</span>`
+	}
+
+	tests := []struct {
+		name         string
+		html         string
+		want         models.CapacitySailing
+		wantWarnings int
+	}{
+		{
+			name: "cancelled with reason",
+			html: wrap(`<tr class="mobile-friendly-row"><td>3:00 pm Queen of Oak Bay</td><td><div class="text-red"><p>Cancelled</p><p>Mechanical difficulties</p></div></td></tr>`),
+			want: models.CapacitySailing{DepartureTime: "3:00 pm", ScheduledDepartureTime: "3:00 pm", SailingStatus: "cancelled", VesselName: "Queen of Oak Bay", VesselStatus: "Mechanical difficulties"},
+		},
+		{
+			name: "current with eta",
+			html: wrap(`<tr class="mobile-friendly-row"><td><p>3:00 pm Departed 3:05 pm Queen of Oak Bay</p></td><td><div class="cc-message-updates">ETA : 4:45 pm</div></td></tr>`),
+			want: models.CapacitySailing{DepartureTime: "3:05 pm", ScheduledDepartureTime: "3:00 pm", ActualDepartureTime: "3:05 pm", DelayMinutes: 5, ArrivalTime: "4:45 pm", SailingStatus: "current", VesselName: "Queen of Oak Bay"},
+		},
+		{
+			name: "current with variable eta",
+			html: wrap(`<tr class="mobile-friendly-row"><td><p>3:00 pm Departed 3:05 pm Queen of Oak Bay</p></td><td><div class="cc-message-updates">ETA : Variable</div></td></tr>`),
+			want: models.CapacitySailing{DepartureTime: "3:05 pm", ScheduledDepartureTime: "3:00 pm", ActualDepartureTime: "3:05 pm", DelayMinutes: 5, ArrivalTime: "Variable", SailingStatus: "current", VesselName: "Queen of Oak Bay"},
+		},
+		{
+			name:         "future with unreadable percentage",
+			html:         wrap(`<tr class="mobile-friendly-row"><td>5:00 pm Queen of Oak Bay</td><td><span class="cc-vessel-percent-full">n/a %</span></td></tr>`),
+			want:         models.CapacitySailing{DepartureTime: "5:00 pm", ScheduledDepartureTime: "5:00 pm", SailingStatus: "future", VesselName: "Queen of Oak Bay"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "unrecognised row",
+			html:         wrap(`<tr class="mobile-friendly-row"><td>Service notice</td><td></td></tr>`),
+			want:         models.CapacitySailing{},
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, warnings := ParseCapacityRoute(documentFromString(t, tt.html), "HSB", "NAN", nil)
+
+			if len(route.Sailings) != 1 {
+				t.Fatalf("expected 1 sailing, got %d", len(route.Sailings))
+			}
+			if got := route.Sailings[0]; got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if route.SailingDuration != "1h 40m" {
+				t.Errorf("expected sailing duration 1h 40m, got %q", route.SailingDuration)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got %v", tt.wantWarnings, warnings)
+			}
+		})
+	}
+}
+
+func TestDelayMinutes(t *testing.T) {
+	tests := []struct {
+		scheduled, actual string
+		want              int
+	}{
+		{"7:00 am", "7:12 am", 12},
+		{"7:00 am", "6:58 am", -2},
+		{"11:50 pm", "12:10 am", 20},
+		{"12:05 am", "11:55 pm", -10},
+		{"7:00 am", "Variable", 0},
+	}
+
+	for _, tt := range tests {
+		if got := delayMinutes(tt.scheduled, tt.actual); got != tt.want {
+			t.Errorf("delayMinutes(%q, %q) = %d, want %d", tt.scheduled, tt.actual, got, tt.want)
+		}
+	}
+}
+
+func TestParseNonCapacityRoute(t *testing.T) {
+	loc := sailingtime.Location()
+
+	seasonal := `<table class="table-seasonal-schedule">
+		<thead><tr data-schedule-day="MONDAYS"><th>MONDAYS</th></tr></thead>
+		<tbody>
+			<tr class="schedule-table-row"><td></td><td>6:30 am</td><td>7:10 am</td><td>0h 40m</td></tr>
+			<tr class="schedule-table-row"><td></td><td>9:00 am <p class="red-text">Only on Sep 14, 28 &amp; Oct 12</p></td><td>9:40 am</td><td></td></tr>
+			<tr class="schedule-table-row"><td></td><td>1:00 pm <p class="red-text">Except on Oct 12</p></td><td>1:40 pm</td><td></td></tr>
+			<tr class="schedule-table-row"><td></td><td>4:00 pm <p class="text-black">Dangerous goods only</p></td><td>4:40 pm</td><td></td></tr>
+		</tbody>
+		<thead><tr data-schedule-day="TUESDAYS"><th>TUESDAYS</th></tr></thead>
+		<tbody>
+			<tr class="schedule-table-row"><td></td><td>8:00 am</td><td>8:40 am</td><td>0h 40m</td></tr>
+		</tbody>
+	</table>`
+
+	tests := []struct {
+		name         string
+		document     *goquery.Document
+		isDaily      bool
+		now          time.Time
+		wantTimes    []string
+		wantDuration string
+		wantWarnings int
+	}{
+		{
+			name:         "daily fixture",
+			document:     loadFixture(t, "daily_schedule.html"),
+			isDaily:      true,
+			now:          time.Date(2026, 2, 22, 12, 0, 0, 0, loc),
+			wantTimes:    []string{"7:00 am", "8:00 am", "9:00 am", "11:00 am", "12:00 pm", "1:00 pm", "3:00 pm", "5:00 pm", "7:00 pm", "9:00 pm"},
+			wantDuration: "01:35",
+		},
+		{
+			name:         "seasonal listed date",
+			document:     documentFromString(t, seasonal),
+			now:          time.Date(2026, 10, 12, 12, 0, 0, 0, loc),
+			wantTimes:    []string{"6:30 am", "9:00 am"},
+			wantDuration: "0h 40m",
+		},
+		{
+			name:         "seasonal unlisted date",
+			document:     documentFromString(t, seasonal),
+			now:          time.Date(2026, 10, 5, 12, 0, 0, 0, loc),
+			wantTimes:    []string{"6:30 am", "1:00 pm"},
+			wantDuration: "0h 40m",
+		},
+		{
+			name:         "seasonal other weekday",
+			document:     documentFromString(t, seasonal),
+			now:          time.Date(2026, 10, 6, 12, 0, 0, 0, loc),
+			wantTimes:    []string{"8:00 am"},
+			wantDuration: "0h 40m",
+		},
+		{
+			name:         "seasonal missing weekday",
+			document:     documentFromString(t, seasonal),
+			now:          time.Date(2026, 10, 7, 12, 0, 0, 0, loc),
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, warnings := ParseNonCapacityRoute(tt.document, "SWB", "TSA", tt.isDaily, tt.now)
+
+			var times []string
+			for _, sailing := range route.Sailings {
+				times = append(times, sailing.DepartureTime)
+			}
+			if strings.Join(times, ",") != strings.Join(tt.wantTimes, ",") {
+				t.Errorf("got sailings %v, want %v", times, tt.wantTimes)
+			}
+			if route.SailingDuration != tt.wantDuration {
+				t.Errorf("got duration %q, want %q", route.SailingDuration, tt.wantDuration)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("expected %d warnings, got %v", tt.wantWarnings, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// TokenBucket allows bursts of up to burst requests, refilled at rate tokens per second.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+/*
+ * NewTokenBucket
+ *
+ * Returns a full token bucket. A rate of zero or less disables limiting.
+ *
+ * @param float64 rate - tokens added per second
+ * @param int burst - bucket capacity
+ *
+ * @return *TokenBucket
+ */
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+/*
+ * Wait
+ *
+ * Blocks until a token is available or ctx is done.
+ *
+ * @param context.Context ctx
+ *
+ * @return error - ctx.Err() if ctx ended first
+ */
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return nil
+	}
+
+	for {
+		delay := b.reserve()
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise returns how long until one is
+func (b *TokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// HostLimiter keeps a separate token bucket for every host it sees.
+type HostLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*TokenBucket
+}
+
+/*
+ * NewHostLimiter
+ *
+ * Returns a limiter allowing rate requests per second, with bursts of burst,
+ * to each host.
+ *
+ * @param float64 rate
+ * @param int burst
+ *
+ * @return *HostLimiter
+ */
+func NewHostLimiter(rate float64, burst int) *HostLimiter {
+	return &HostLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*TokenBucket),
+	}
+}
+
+/*
+ * Wait
+ *
+ * Blocks until a request to the host of rawURL is allowed or ctx is done.
+ *
+ * @param context.Context ctx
+ * @param string rawURL
+ *
+ * @return error
+ */
+func (l *HostLimiter) Wait(ctx context.Context, rawURL string) error {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+
+	l.mu.Lock()
+	bucket, ok := l.buckets[host]
+	if !ok {
+		bucket = NewTokenBucket(l.rate, l.burst)
+		l.buckets[host] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.Wait(ctx)
+}
@@ -0,0 +1,76 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter_LimitsEachHostSeparately(t *testing.T) {
+	limiter := NewHostLimiter(20, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(ctx, "https://www.bcferries.com/current-conditions/TSA-SWB"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// One token up front, then two more at 20/s
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("expected requests to be spaced out, took %s", elapsed)
+	}
+
+	start = time.Now()
+	if err := limiter.Wait(ctx, "https://example.com/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("expected a fresh bucket for another host, waited %s", elapsed)
+	}
+}
+
+func TestTokenBucket_WaitHonoursContext(t *testing.T) {
+	bucket := NewTokenBucket(0.1, 1)
+	if err := bucket.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := bucket.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestForEachConcurrently_BoundsWorkers(t *testing.T) {
+	var running, maxRunning, calls int32
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+
+	forEachConcurrently(3, 20, func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&calls, 1)
+
+		mu.Lock()
+		seen[i] = true
+		mu.Unlock()
+	})
+
+	if calls != 20 || len(seen) != 20 {
+		t.Fatalf("expected 20 distinct calls, got %d calls over %d indexes", calls, len(seen))
+	}
+	if maxRunning > 3 {
+		t.Fatalf("expected at most 3 concurrent calls, got %d", maxRunning)
+	}
+}
@@ -0,0 +1,297 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting upstream while the breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open, upstream marked as down")
+
+/*****************/
+/* Retry Policy */
+/*****************/
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	AttemptTimeout time.Duration // Zero means attempts are only bounded by the caller's context
+}
+
+/*
+ * backoff
+ *
+ * Returns a random delay between zero and BaseDelay * 2^attempt, capped at
+ * MaxDelay ("full jitter"), so that retrying workers spread out.
+ *
+ * @param int attempt - zero-based index of the attempt that just failed
+ *
+ * @return time.Duration
+ */
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+/*
+ * IsRetryable
+ *
+ * Reports whether a fetch error is worth retrying: server errors, rate limiting
+ * and network failures. Client errors, missing fixtures, an open breaker and
+ * cancellation by the caller are not.
+ *
+ * @param error err
+ *
+ * @return bool
+ */
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNotRecorded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
+
+/*******************/
+/* Circuit Breaker */
+/*******************/
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerStatus is a snapshot of a CircuitBreaker, as reported by the API.
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"`
+}
+
+// CircuitBreaker opens after Threshold consecutive failures and rejects requests
+// until Cooldown has passed. It then lets a single trial request through: success
+// closes it again, failure re-opens it for another cooldown.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	lastErr  string
+	openedAt time.Time
+	trial    bool
+}
+
+/*
+ * NewCircuitBreaker
+ *
+ * @param int threshold - consecutive failures before opening
+ * @param time.Duration cooldown - how long to stay open before a trial request
+ *
+ * @return *CircuitBreaker
+ */
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown, state: BreakerClosed}
+}
+
+/*
+ * Allow
+ *
+ * Reports whether a request may be sent now. While half-open only one trial
+ * request is allowed at a time.
+ *
+ * @return bool
+ */
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+/*
+ * Record
+ *
+ * Records the outcome of an allowed request. Only errors that IsRetryable
+ * counts as failures count against upstream; a 404 means the site is up.
+ *
+ * @param error err
+ *
+ * @return void
+ */
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+
+	if !IsRetryable(err) {
+		if err == nil || !errors.Is(err, context.Canceled) {
+			b.state = BreakerClosed
+			b.failures = 0
+		}
+		return
+	}
+
+	b.failures++
+	b.lastErr = err.Error()
+	if b.state == BreakerHalfOpen || (b.Threshold > 0 && b.failures >= b.Threshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+/*
+ * Status
+ *
+ * Returns a snapshot of the breaker state.
+ *
+ * @return BreakerStatus
+ */
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastErr,
+	}
+	if status.State == "" {
+		status.State = BreakerClosed
+	}
+	if b.state != BreakerClosed && !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.Cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+
+	return status
+}
+
+/*********************/
+/* Retrying Fetcher */
+/*********************/
+
+type retryingFetcher struct {
+	fetcher Fetcher
+	policy  RetryPolicy
+	limiter *HostLimiter
+	breaker *CircuitBreaker
+}
+
+/*
+ * Retrying
+ *
+ * Wraps a fetcher with policy's retries and, if breaker is not nil, a circuit
+ * breaker checked before every attempt. If limiter is not nil every attempt
+ * first waits on it, before the attempt's timeout starts, so time spent queued
+ * behind the rate limit never counts against upstream.
+ *
+ * @param Fetcher f
+ * @param RetryPolicy policy
+ * @param *HostLimiter limiter
+ * @param *CircuitBreaker breaker
+ *
+ * @return Fetcher
+ */
+func Retrying(f Fetcher, policy RetryPolicy, limiter *HostLimiter, breaker *CircuitBreaker) Fetcher {
+	return &retryingFetcher{fetcher: f, policy: policy, limiter: limiter, breaker: breaker}
+}
+
+func (f *retryingFetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	attempts := f.policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var page *Page
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if f.limiter != nil {
+			if waitErr := f.limiter.Wait(ctx, url); waitErr != nil {
+				if err == nil {
+					err = waitErr
+				}
+				return page, err
+			}
+		}
+		if f.breaker != nil && !f.breaker.Allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		page, err = f.attempt(ctx, url)
+		if f.breaker != nil {
+			f.breaker.Record(err)
+		}
+		if !IsRetryable(err) || ctx.Err() != nil || attempt == attempts-1 {
+			break
+		}
+
+		timer := time.NewTimer(f.policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return page, err
+		case <-timer.C:
+		}
+	}
+
+	return page, err
+}
+
+func (f *retryingFetcher) attempt(ctx context.Context, url string) (*Page, error) {
+	if f.policy.AttemptTimeout <= 0 {
+		return f.fetcher.Fetch(ctx, url)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.policy.AttemptTimeout)
+	defer cancel()
+
+	return f.fetcher.Fetch(ctx, url)
+}
+
+func (f *retryingFetcher) Close() error {
+	closeFetcher(f.fetcher)
+	return nil
+}
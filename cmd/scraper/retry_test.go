@@ -0,0 +1,124 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"server error", &StatusError{StatusCode: http.StatusBadGateway}, true},
+		{"rate limited", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"not found", &StatusError{StatusCode: http.StatusNotFound}, false},
+		{"network", errors.New("connection reset by peer"), true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, false},
+		{"breaker open", ErrCircuitOpen, false},
+		{"missing fixture", ErrNotRecorded, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetrying_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	upstream := FetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+		calls++
+		if calls < 3 {
+			return nil, &StatusError{URL: url, StatusCode: http.StatusServiceUnavailable}
+		}
+		return &Page{URL: url, StatusCode: http.StatusOK}, nil
+	})
+
+	fetcher := Retrying(upstream, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, nil, nil)
+	if _, err := fetcher.Fetch(context.Background(), "https://www.bcferries.com/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+
+	calls = 0
+	notFound := FetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+		calls++
+		return nil, &StatusError{URL: url, StatusCode: http.StatusNotFound}
+	})
+	if _, err := Retrying(notFound, RetryPolicy{MaxAttempts: 3}, nil, nil).Fetch(context.Background(), "https://www.bcferries.com/"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if calls != 1 {
+		t.Fatalf("expected client errors not to be retried, got %d calls", calls)
+	}
+}
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	breaker := NewCircuitBreaker(2, 20*time.Millisecond)
+	failing := true
+	calls := 0
+	upstream := FetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+		calls++
+		if failing {
+			return nil, &StatusError{URL: url, StatusCode: http.StatusInternalServerError}
+		}
+		return &Page{URL: url, StatusCode: http.StatusOK}, nil
+	})
+	fetcher := Retrying(upstream, RetryPolicy{MaxAttempts: 1}, nil, breaker)
+
+	for i := 0; i < 2; i++ {
+		fetcher.Fetch(context.Background(), "https://www.bcferries.com/")
+	}
+	if status := breaker.Status(); status.State != BreakerOpen || status.RetryAt == nil {
+		t.Fatalf("expected breaker to be open, got %+v", status)
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), "https://www.bcferries.com/"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected no upstream call while open, got %d calls", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	failing = false
+	if _, err := fetcher.Fetch(context.Background(), "https://www.bcferries.com/"); err != nil {
+		t.Fatalf("expected trial request to succeed, got %v", err)
+	}
+	if status := breaker.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("expected breaker to be closed, got %+v", status)
+	}
+}
+
+func TestRetrying_RateLimitWaitIsNotAnAttempt(t *testing.T) {
+	breaker := NewCircuitBreaker(1, time.Minute)
+	upstream := FetcherFunc(func(ctx context.Context, url string) (*Page, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &Page{URL: url, StatusCode: http.StatusOK}, nil
+	})
+
+	// The second request waits about 100ms for a token, longer than an attempt may take
+	limiter := NewHostLimiter(10, 1)
+	fetcher := Retrying(upstream, RetryPolicy{MaxAttempts: 1, AttemptTimeout: 20 * time.Millisecond}, limiter, breaker)
+
+	for i := 0; i < 2; i++ {
+		if _, err := fetcher.Fetch(context.Background(), "https://www.bcferries.com/"); err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+	}
+	if status := breaker.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("expected breaker to be closed, got %+v", status)
+	}
+}
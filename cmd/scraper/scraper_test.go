@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/staticdata"
 )
 
 func TestParseDailyScheduleSailings_ParsesUpdatedSWBTSAOnwardTimes(t *testing.T) {
@@ -47,3 +48,18 @@ func TestParseDailyScheduleSailings_ParsesUpdatedSWBTSAOnwardTimes(t *testing.T)
 		t.Fatalf("expected parsed sailings to include 12:00 pm")
 	}
 }
+
+func TestTerminalPairs_SkipsDuplicateRoutes(t *testing.T) {
+	pairs := terminalPairs(staticdata.GetNonCapacityDepartureTerminals(), staticdata.GetNonCapacityDestinationTerminals())
+
+	seen := make(map[[2]string]bool)
+	for _, pair := range pairs {
+		if seen[pair] {
+			t.Errorf("route %s%s listed more than once", pair[0], pair[1])
+		}
+		seen[pair] = true
+	}
+	if !seen[[2]string{"SWB", "PSB"}] || !seen[[2]string{"PPH", "PPR"}] {
+		t.Errorf("expected SWBPSB and PPHPPR in %v", pairs)
+	}
+}
@@ -2,20 +2,32 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 
-	_ "github.com/lib/pq"
 	"github.com/samuel-pratt/bc-ferries-api/cmd/config"
 	"github.com/samuel-pratt/bc-ferries-api/cmd/cron"
 	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
 	"github.com/samuel-pratt/bc-ferries-api/cmd/router"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/scraper"
 )
 
 func main() {
 	// Set up environment variables, database connection
 	config.LoadEnv()
+
+	// `main migrate ...` manages the schema without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	db.Init()
-	defer db.Conn.Close()
+	defer db.Close()
+
+	if err := scraper.ConfigureFetchers(); err != nil {
+		log.Fatalf("Failed to configure scraper: %v", err)
+	}
 
 	cron.SetupCron()
 
@@ -0,0 +1,69 @@
+package staticdata
+
+import "strings"
+
+/*
+ * IsCapacityRoute
+ *
+ * Reports whether BC Ferries publishes capacity data for sailings from one
+ * terminal to another.
+ *
+ * @param string from - departure terminal code, e.g. "TSA"
+ * @param string to - destination terminal code, e.g. "SWB"
+ *
+ * @return bool
+ */
+func IsCapacityRoute(from string, to string) bool {
+	return hasRoute(GetCapacityDepartureTerminals(), GetCapacityDestinationTerminals(), from, to)
+}
+
+/*
+ * IsNonCapacityRoute
+ *
+ * Reports whether BC Ferries publishes a schedule for sailings from one terminal
+ * to another.
+ *
+ * @param string from - departure terminal code
+ * @param string to - destination terminal code
+ *
+ * @return bool
+ */
+func IsNonCapacityRoute(from string, to string) bool {
+	return hasRoute(GetNonCapacityDepartureTerminals(), GetNonCapacityDestinationTerminals(), from, to)
+}
+
+/*
+ * SplitRouteCode
+ *
+ * Splits a route code such as "TSASWB" into its departure and destination
+ * terminal codes.
+ *
+ * @param string routeCode
+ *
+ * @return string - departure terminal code
+ * @return string - destination terminal code
+ * @return bool - false if routeCode is not two three-letter codes
+ */
+func SplitRouteCode(routeCode string) (string, string, bool) {
+	if len(routeCode) != 6 {
+		return "", "", false
+	}
+	return routeCode[:3], routeCode[3:], true
+}
+
+func hasRoute(departures []string, destinations [][]string, from string, to string) bool {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+
+	for i, departure := range departures {
+		if departure != from || i >= len(destinations) {
+			continue
+		}
+		for _, destination := range destinations[i] {
+			if destination == to {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -122,3 +122,77 @@ func GetNonCapacityDestinationTerminals() [][]string {
 
 	return destinationTerminals[:]
 }
+
+type Terminal struct {
+	Code      string
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+// terminals are the names and approximate locations of the terminals above
+var terminals = map[string]Terminal{
+	"ALF": {"ALF", "Alliford Bay (Haida Gwaii)", 53.2092, -132.0497},
+	"ALR": {"ALR", "Alert Bay (Cormorant Island)", 50.5861, -126.9304},
+	"BEC": {"BEC", "Bella Coola", 52.3792, -126.7594},
+	"BKY": {"BKY", "Buckley Bay", 49.5255, -124.8497},
+	"BOW": {"BOW", "Bowen Island (Snug Cove)", 49.3783, -123.3283},
+	"BTW": {"BTW", "Brentwood Bay", 48.5746, -123.4626},
+	"CAM": {"CAM", "Campbell River", 50.0296, -125.2432},
+	"CFT": {"CFT", "Crofton", 48.8650, -123.6380},
+	"CHM": {"CHM", "Chemainus", 48.9256, -123.7150},
+	"CMX": {"CMX", "Comox (Little River)", 49.7245, -124.9201},
+	"COR": {"COR", "Whaletown (Cortes Island)", 50.1063, -125.0456},
+	"DNE": {"DNE", "Denman Island East", 49.4939, -124.7386},
+	"DNM": {"DNM", "Denman Island West", 49.5319, -124.8194},
+	"DUK": {"DUK", "Duke Point (Nanaimo)", 49.1628, -123.8917},
+	"ERL": {"ERL", "Earls Cove", 49.7530, -124.0102},
+	"FUL": {"FUL", "Fulford Harbour (Salt Spring Island)", 48.7689, -123.4508},
+	"GAB": {"GAB", "Descanso Bay (Gabriola Island)", 49.1758, -123.8628},
+	"HRB": {"HRB", "Heriot Bay (Quadra Island)", 50.1030, -125.2081},
+	"HRN": {"HRN", "Gravelly Bay (Hornby Island)", 49.5215, -124.6783},
+	"HSB": {"HSB", "Horseshoe Bay", 49.3742, -123.2727},
+	"KLE": {"KLE", "Klemtu", 52.5939, -128.5217},
+	"LNG": {"LNG", "Langdale", 49.4344, -123.4715},
+	"MCN": {"MCN", "Port McNeill", 50.5902, -127.0847},
+	"MIL": {"MIL", "Mill Bay", 48.6386, -123.5521},
+	"NAH": {"NAH", "Nanaimo Harbour", 49.1700, -123.9300},
+	"NAN": {"NAN", "Departure Bay (Nanaimo)", 49.1933, -123.9546},
+	"PBB": {"PBB", "Bella Bella (McLoughlin Bay)", 52.1383, -128.1347},
+	"PEN": {"PEN", "Penelakut Island (Telegraph Harbour)", 48.9693, -123.6660},
+	"PLH": {"PLH", "Long Harbour (Salt Spring Island)", 48.8505, -123.4447},
+	"POB": {"POB", "Otter Bay (Pender Island)", 48.7993, -123.3109},
+	"POF": {"POF", "Ocean Falls", 52.3536, -127.6939},
+	"PPH": {"PPH", "Port Hardy (Bear Cove)", 50.7236, -127.4975},
+	"PPR": {"PPR", "Prince Rupert", 54.2988, -130.3489},
+	"PSB": {"PSB", "Sturdies Bay (Galiano Island)", 48.8772, -123.3167},
+	"PSK": {"PSK", "Skidegate (Haida Gwaii)", 53.2553, -132.0122},
+	"PST": {"PST", "Lyall Harbour (Saturna Island)", 48.7964, -123.1967},
+	"PVB": {"PVB", "Village Bay (Mayne Island)", 48.8446, -123.3225},
+	"PWR": {"PWR", "Powell River (Westview)", 49.8359, -124.5274},
+	"QDR": {"QDR", "Quathiaski Cove (Quadra Island)", 50.0436, -125.2175},
+	"SHW": {"SHW", "Shearwater", 52.1470, -128.0890},
+	"SLT": {"SLT", "Saltery Bay", 49.7806, -123.9747},
+	"SOI": {"SOI", "Sointula (Malcolm Island)", 50.6270, -127.0167},
+	"SWB": {"SWB", "Swartz Bay", 48.6886, -123.4105},
+	"TEX": {"TEX", "Blubber Bay (Texada Island)", 49.7947, -124.6213},
+	"THT": {"THT", "Preedy Harbour (Thetis Island)", 48.9771, -123.6778},
+	"TSA": {"TSA", "Tsawwassen", 49.0069, -123.1303},
+	"VES": {"VES", "Vesuvius Bay (Salt Spring Island)", 48.8808, -123.5722},
+}
+
+/*
+ * GetTerminal
+ *
+ * Returns a terminal's name and location. SGI, the Southern Gulf Islands as a
+ * capacity route destination, isn't a single terminal and has no entry.
+ *
+ * @param string code
+ *
+ * @return Terminal
+ * @return bool - false for unknown codes
+ */
+func GetTerminal(code string) (Terminal, bool) {
+	terminal, ok := terminals[code]
+	return terminal, ok
+}
@@ -0,0 +1,135 @@
+package stats
+
+import (
+	"math"
+	"sort"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+/*
+ * OnTime
+ *
+ * Summarises departure records overall, per route and per vessel.
+ *
+ * A departed sailing is on time if it left no more than thresholdMinutes after
+ * its scheduled time. Early departures count as no delay in the mean and p90.
+ * Cancelled sailings are left out of the per-vessel figures when the vessel
+ * isn't known.
+ *
+ * @param []models.DepartureRecord records
+ * @param int thresholdMinutes
+ *
+ * @return models.OnTimeStats - with From and To left for the caller
+ */
+func OnTime(records []models.DepartureRecord, thresholdMinutes int) models.OnTimeStats {
+	overall := &tally{}
+	byRoute := make(map[string]*tally)
+	byVessel := make(map[string]*tally)
+
+	for _, r := range records {
+		overall.add(r, thresholdMinutes)
+
+		if byRoute[r.RouteCode] == nil {
+			byRoute[r.RouteCode] = &tally{}
+		}
+		byRoute[r.RouteCode].add(r, thresholdMinutes)
+
+		if r.VesselName != "" {
+			if byVessel[r.VesselName] == nil {
+				byVessel[r.VesselName] = &tally{}
+			}
+			byVessel[r.VesselName].add(r, thresholdMinutes)
+		}
+	}
+
+	stats := models.OnTimeStats{
+		ThresholdMinutes: thresholdMinutes,
+		Overall:          overall.summary(),
+		Routes:           []models.OnTimeSummary{},
+		Vessels:          []models.OnTimeSummary{},
+	}
+
+	for routeCode, t := range byRoute {
+		summary := t.summary()
+		summary.RouteCode = routeCode
+		stats.Routes = append(stats.Routes, summary)
+	}
+	sort.Slice(stats.Routes, func(i, j int) bool { return stats.Routes[i].RouteCode < stats.Routes[j].RouteCode })
+
+	for vesselName, t := range byVessel {
+		summary := t.summary()
+		summary.VesselName = vesselName
+		stats.Vessels = append(stats.Vessels, summary)
+	}
+	sort.Slice(stats.Vessels, func(i, j int) bool { return stats.Vessels[i].VesselName < stats.Vessels[j].VesselName })
+
+	return stats
+}
+
+type tally struct {
+	onTime    int
+	cancelled int
+	delays    []int
+}
+
+func (t *tally) add(r models.DepartureRecord, thresholdMinutes int) {
+	switch r.Outcome {
+	case models.DepartureCancelled:
+		t.cancelled++
+	case models.DepartureDeparted:
+		delay := r.DelayMinutes
+		if delay < 0 {
+			delay = 0
+		}
+		if delay <= thresholdMinutes {
+			t.onTime++
+		}
+		t.delays = append(t.delays, delay)
+	}
+}
+
+func (t *tally) summary() models.OnTimeSummary {
+	departed := len(t.delays)
+
+	summary := models.OnTimeSummary{
+		Sailings:  departed + t.cancelled,
+		Departed:  departed,
+		OnTime:    t.onTime,
+		Cancelled: t.cancelled,
+	}
+
+	if summary.Sailings > 0 {
+		summary.CancellationRate = round(float64(t.cancelled)/float64(summary.Sailings), 3)
+	}
+	if departed > 0 {
+		total := 0
+		for _, delay := range t.delays {
+			total += delay
+		}
+
+		summary.OnTimePercent = round(float64(t.onTime)/float64(departed)*100, 1)
+		summary.MeanDelayMinutes = round(float64(total)/float64(departed), 1)
+		summary.P90DelayMinutes = round(float64(percentile(t.delays, 90)), 1)
+	}
+
+	return summary
+}
+
+// percentile returns the nearest-rank pth percentile of values
+func percentile(values []int, p int) int {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func round(f float64, places int) *float64 {
+	scale := math.Pow(10, float64(places))
+	rounded := math.Round(f*scale) / scale
+	return &rounded
+}
@@ -0,0 +1,45 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+func TestOnTime(t *testing.T) {
+	departed := func(routeCode string, vesselName string, delay int) models.DepartureRecord {
+		return models.DepartureRecord{RouteCode: routeCode, VesselName: vesselName, Outcome: models.DepartureDeparted, DelayMinutes: delay}
+	}
+
+	records := []models.DepartureRecord{
+		departed("TSASWB", "Spirit of British Columbia", -2),
+		departed("TSASWB", "Spirit of British Columbia", 3),
+		departed("TSASWB", "Coastal Renaissance", 12),
+		departed("TSASWB", "Coastal Renaissance", 40),
+		{RouteCode: "TSASWB", Outcome: models.DepartureCancelled},
+		departed("HSBNAN", "Queen of Oak Bay", 5),
+	}
+
+	stats := OnTime(records, 5)
+
+	if len(stats.Routes) != 2 || len(stats.Vessels) != 3 {
+		t.Fatalf("got %d routes and %d vessels, want 2 and 3", len(stats.Routes), len(stats.Vessels))
+	}
+
+	route := stats.Routes[1]
+	if route.RouteCode != "TSASWB" || route.Sailings != 5 || route.Departed != 4 || route.OnTime != 2 || route.Cancelled != 1 {
+		t.Errorf("TSASWB = %+v", route)
+	}
+	if *route.OnTimePercent != 50 || *route.MeanDelayMinutes != 13.8 || *route.P90DelayMinutes != 40 || *route.CancellationRate != 0.2 {
+		t.Errorf("TSASWB rates = %v%%, mean %v, p90 %v, cancelled %v", *route.OnTimePercent, *route.MeanDelayMinutes, *route.P90DelayMinutes, *route.CancellationRate)
+	}
+
+	if overall := stats.Overall; overall.Sailings != 6 || overall.OnTime != 3 {
+		t.Errorf("overall = %+v", overall)
+	}
+
+	empty := OnTime(nil, 5)
+	if empty.Overall.OnTimePercent != nil || empty.Overall.CancellationRate != nil {
+		t.Errorf("empty stats = %+v", empty.Overall)
+	}
+}
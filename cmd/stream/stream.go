@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventRoute   = "route"   // A capacity route's sailings after a scrape
+	EventChange  = "change"  // A service change detected by a scrape
+	EventSailing = "sailing" // A capacity sailing's update between scrapes
+)
+
+const (
+	historySize    = 1000 // Events kept for clients resuming with Last-Event-ID
+	subscriberSize = 256  // Events a subscriber can fall behind by before it is dropped
+)
+
+type Event struct {
+	ID        uint64
+	Type      string
+	RouteCode string
+	Data      json.RawMessage
+}
+
+type Subscription struct {
+	Events  <-chan Event // Closed if the subscriber falls too far behind
+	StartID uint64       // ID of the last event published before subscribing
+
+	events chan Event
+}
+
+/*******/
+/* Hub */
+/*******/
+
+// Hub fans published events out to subscribers and remembers recent ones
+type Hub struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	subscribers map[*Subscription]bool
+}
+
+/*
+ * NewHub
+ *
+ * Event IDs start from the time the hub is created in Unix milliseconds, so
+ * IDs handed out before a restart are never mistaken for new ones.
+ *
+ * @return *Hub
+ */
+func NewHub() *Hub {
+	return &Hub{
+		lastID:      uint64(time.Now().UnixMilli()),
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+/*
+ * Publish
+ *
+ * Sends an event to every subscriber. Subscribers that have fallen too far
+ * behind are dropped rather than blocking the publisher.
+ *
+ * @param string eventType
+ * @param string routeCode
+ * @param interface{} payload - marshalled to JSON
+ *
+ * @return void
+ */
+func (h *Hub) Publish(eventType string, routeCode string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("stream: failed to marshal %s event for %s: %v", eventType, routeCode, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	event := Event{ID: h.lastID, Type: eventType, RouteCode: routeCode, Data: data}
+
+	h.history = append(h.history, event)
+	if len(h.history) > historySize {
+		h.history = h.history[len(h.history)-historySize:]
+	}
+
+	for subscription := range h.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			delete(h.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+/*
+ * Subscribe
+ *
+ * Registers a subscriber. If resume is set and the events published after
+ * lastEventID are all still remembered, they are returned to be sent before
+ * anything from the subscription's channel.
+ *
+ * @param uint64 lastEventID
+ * @param bool resume
+ *
+ * @return *Subscription
+ * @return []Event - events to replay
+ * @return bool - whether the subscriber could be resumed; if not it needs a fresh snapshot
+ */
+func (h *Hub) Subscribe(lastEventID uint64, resume bool) (*Subscription, []Event, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make(chan Event, subscriberSize)
+	subscription := &Subscription{Events: events, StartID: h.lastID, events: events}
+	h.subscribers[subscription] = true
+
+	if !resume || lastEventID > h.lastID {
+		return subscription, nil, false
+	}
+	if lastEventID == h.lastID {
+		return subscription, nil, true
+	}
+	if len(h.history) == 0 || lastEventID < h.history[0].ID-1 {
+		return subscription, nil, false
+	}
+
+	replay := append([]Event{}, h.history[lastEventID-(h.history[0].ID-1):]...)
+	return subscription, replay, true
+}
+
+/*
+ * Unsubscribe
+ *
+ * @param *Subscription subscription
+ *
+ * @return void
+ */
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[subscription] {
+		delete(h.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+/******************/
+/* Hub Shorthands */
+/******************/
+
+// hub is the process wide hub scrapes publish to. The functions below call the
+// same method on it.
+var hub = NewHub()
+
+func Publish(eventType string, routeCode string, payload interface{}) {
+	hub.Publish(eventType, routeCode, payload)
+}
+
+func Subscribe(lastEventID uint64, resume bool) (*Subscription, []Event, bool) {
+	return hub.Subscribe(lastEventID, resume)
+}
+
+func Unsubscribe(subscription *Subscription) {
+	hub.Unsubscribe(subscription)
+}
@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"testing"
+)
+
+func TestHub_Resume(t *testing.T) {
+	h := NewHub()
+	start := h.lastID
+
+	h.Publish(EventRoute, "TSASWB", map[string]int{"n": 1})
+	h.Publish(EventRoute, "SWBTSA", map[string]int{"n": 2})
+	h.Publish(EventChange, "TSASWB", map[string]int{"n": 3})
+
+	_, replay, resumed := h.Subscribe(start+1, true)
+	if !resumed || len(replay) != 2 || replay[0].ID != start+2 || replay[1].Type != EventChange || string(replay[1].Data) != `{"n":3}` {
+		t.Errorf("resume from %d = %+v, %v", start+1, replay, resumed)
+	}
+
+	if _, replay, resumed := h.Subscribe(start+3, true); !resumed || len(replay) != 0 {
+		t.Errorf("resume from latest = %+v, %v; want nothing to replay", replay, resumed)
+	}
+
+	// An ID from the future, e.g. before a restart, can't be resumed from
+	if _, _, resumed := h.Subscribe(start+10, true); resumed {
+		t.Error("resumed from an unknown ID")
+	}
+
+	if subscription, _, resumed := h.Subscribe(0, false); resumed || subscription.StartID != start+3 {
+		t.Errorf("new subscription StartID = %d, resumed %v", subscription.StartID, resumed)
+	}
+}
+
+func TestHub_ForgottenEvents(t *testing.T) {
+	h := NewHub()
+	start := h.lastID
+
+	for i := 0; i < historySize+10; i++ {
+		h.Publish(EventRoute, "TSASWB", i)
+	}
+
+	if _, _, resumed := h.Subscribe(start+5, true); resumed {
+		t.Error("resumed past events that are no longer remembered")
+	}
+	if _, replay, resumed := h.Subscribe(start+10, true); !resumed || len(replay) != historySize {
+		t.Errorf("resume from oldest remembered = %d events, %v", len(replay), resumed)
+	}
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	h := NewHub()
+	subscription, _, _ := h.Subscribe(0, false)
+
+	h.Publish(EventRoute, "TSASWB", 0)
+	if event := <-subscription.Events; event.RouteCode != "TSASWB" {
+		t.Errorf("event = %+v", event)
+	}
+
+	for i := 0; i < subscriberSize+1; i++ {
+		h.Publish(EventRoute, "TSASWB", i)
+	}
+
+	received := 0
+	for range subscription.Events {
+		received++
+	}
+	if received != subscriberSize {
+		t.Errorf("slow subscriber received %d events before being dropped, want %d", received, subscriberSize)
+	}
+
+	// Unsubscribing after being dropped is harmless
+	h.Unsubscribe(subscription)
+}
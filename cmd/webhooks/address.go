@@ -0,0 +1,103 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned for subscriber URLs that point into the network
+// the server runs in, so subscriptions can't be used to reach internal services.
+var ErrBlockedAddress = errors.New("webhook URL resolves to a loopback, private or link-local address")
+
+// Carrier-grade NAT space, which some clouds serve instance metadata from
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// blockedAddress is swapped out by tests, whose subscribers listen on loopback
+var blockedAddress = isInternalAddress
+
+/*
+ * CheckURL
+ *
+ * Reports whether a subscriber URL may be delivered to: its host must not be,
+ * or resolve to, a loopback, private, link-local or unspecified address. Hosts
+ * that don't resolve yet are allowed, since every delivery checks the address
+ * it connects to again.
+ *
+ * @param context.Context ctx
+ * @param string rawURL
+ *
+ * @return error - ErrBlockedAddress, or nil
+ */
+func CheckURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := target.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if blockedAddress(ip) {
+			return ErrBlockedAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if blockedAddress(addr.IP) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+/*
+ * newClient
+ *
+ * Returns the HTTP client deliveries are made with. It connects directly,
+ * without any proxy from the environment, refuses to connect to addresses
+ * CheckURL would reject, so a host re-pointed at an internal address after
+ * it was registered is still caught, and doesn't follow redirects.
+ *
+ * @return *http.Client
+ */
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: timeout(), Control: dialControl}
+	return &http.Client{
+		Timeout:   timeout(),
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout()},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialControl rejects connections to blocked addresses, after DNS resolution
+func dialControl(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || blockedAddress(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+func isInternalAddress(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip)
+}
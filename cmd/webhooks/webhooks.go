@@ -0,0 +1,418 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/config"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-BCFerries-Event"
+	DeliveryHeader  = "X-BCFerries-Delivery" // The event ID, the same on every retry
+	TimestampHeader = "X-BCFerries-Timestamp"
+	SignatureHeader = "X-BCFerries-Signature"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultRetryBaseDelay = 2 * time.Second
+	defaultTimeout        = 10 * time.Second
+	defaultQueueSize      = 1000
+	maxRetryDelay         = 5 * time.Minute
+)
+
+// ErrQueueFull is recorded on dead letters for events dropped because the
+// subscription already had as many undelivered events as it may queue.
+var ErrQueueFull = errors.New("delivery queue full")
+
+// queues holds each subscription's undelivered events, so every subscription gets
+// them one at a time in the order they were detected. A subscription has a queue
+// only while a worker is delivering to it.
+var (
+	queuesMu sync.Mutex
+	queues   = map[int64][]queuedEvent{}
+)
+
+type queuedEvent struct {
+	event models.WebhookEvent
+	done  *sync.WaitGroup // Nil if nobody is waiting on the delivery
+}
+
+// EventTypes are the events a subscription can ask for
+var EventTypes = []string{
+	models.ChangeCancelled,
+	models.ChangeAdded,
+	models.ChangeRemoved,
+	models.ChangeVesselChanged,
+	models.ChangeStatusChanged,
+	models.EventFillThreshold,
+}
+
+/*
+ * Notify
+ *
+ * Queues service changes and fill changes for every subscription that wants
+ * them and delivers them in the background, so a slow subscriber can't hold up
+ * scraping. Events are queued before Notify returns, so each subscription gets
+ * one scrape's events before the next's. Each delivery is retried with
+ * exponential backoff and dead lettered once every attempt has failed.
+ *
+ * @param []models.ServiceChange changes
+ * @param []models.FillChange fills
+ *
+ * @return void
+ */
+func Notify(changes []models.ServiceChange, fills []models.FillChange) {
+	if len(changes) == 0 && len(fills) == 0 {
+		return
+	}
+	enqueueAll(changes, fills, nil)
+}
+
+/*
+ * enqueueAll
+ *
+ * Queues each subscription's events from a batch of changes, starting a worker
+ * for any subscription without one. Events that don't fit in a subscription's
+ * queue are dead lettered without being sent.
+ *
+ * @param []models.ServiceChange changes
+ * @param []models.FillChange fills
+ * @param *sync.WaitGroup done - if not nil, marked done as each event is delivered or dead lettered
+ *
+ * @return void
+ */
+func enqueueAll(changes []models.ServiceChange, fills []models.FillChange, done *sync.WaitGroup) {
+	for _, subscription := range db.GetSubscriptions() {
+		events := Events(subscription, changes, fills)
+		if len(events) == 0 {
+			continue
+		}
+		if done != nil {
+			done.Add(len(events))
+		}
+
+		var overflow []queuedEvent
+		queuesMu.Lock()
+		pending, running := queues[subscription.ID]
+		for _, event := range events {
+			if len(pending) >= queueSize() {
+				overflow = append(overflow, queuedEvent{event: event, done: done})
+				continue
+			}
+			pending = append(pending, queuedEvent{event: event, done: done})
+		}
+		queues[subscription.ID] = pending
+		queuesMu.Unlock()
+
+		if !running {
+			go drain(subscription.ID)
+		}
+		for _, dropped := range overflow {
+			log.Printf("webhooks: queue for subscription %d is full, dropping %s", subscription.ID, dropped.event.ID)
+			deadLetter(subscription, dropped.event, 0, 0, ErrQueueFull)
+			dropped.finish()
+		}
+	}
+}
+
+/*
+ * drain
+ *
+ * Delivers a subscription's queued events one at a time until the queue is
+ * empty, then removes it. The subscription is looked up before every delivery,
+ * so a changed URL or secret takes effect straight away and a deleted
+ * subscription's remaining events are dropped.
+ *
+ * @param int64 subscriptionID
+ *
+ * @return void
+ */
+func drain(subscriptionID int64) {
+	client := newClient()
+
+	for {
+		queuesMu.Lock()
+		pending := queues[subscriptionID]
+		if len(pending) == 0 {
+			delete(queues, subscriptionID)
+			queuesMu.Unlock()
+			return
+		}
+		next := pending[0]
+		queues[subscriptionID] = pending[1:]
+		queuesMu.Unlock()
+
+		subscription, ok := db.GetSubscription(subscriptionID)
+		if !ok {
+			queuesMu.Lock()
+			dropped := append([]queuedEvent{next}, queues[subscriptionID]...)
+			delete(queues, subscriptionID)
+			queuesMu.Unlock()
+
+			for _, event := range dropped {
+				event.finish()
+			}
+			return
+		}
+
+		deliver(client, subscription, next.event)
+		next.finish()
+	}
+}
+
+// finish marks a queued event as delivered or given up on
+func (e queuedEvent) finish() {
+	if e.done != nil {
+		e.done.Done()
+	}
+}
+
+/*
+ * Events
+ *
+ * Returns the events a subscription wants out of a batch of changes. A
+ * fill_threshold event fires when a sailing goes from below the subscription's
+ * threshold to at or above it. Event IDs come from what changed rather than
+ * database IDs, so they are stable even if a change failed to save.
+ *
+ * @param models.Subscription subscription
+ * @param []models.ServiceChange changes
+ * @param []models.FillChange fills
+ *
+ * @return []models.WebhookEvent
+ */
+func Events(subscription models.Subscription, changes []models.ServiceChange, fills []models.FillChange) []models.WebhookEvent {
+	var events []models.WebhookEvent
+
+	for i := range changes {
+		change := changes[i]
+		if !wantsRoute(subscription, change.RouteCode) || !contains(subscription.EventTypes, change.Kind) {
+			continue
+		}
+
+		events = append(events, models.WebhookEvent{
+			ID:         fmt.Sprintf("change:%s:%s:%s:%s:%d", change.RouteCode, change.SailingDate, strings.ReplaceAll(change.DepartureTime, " ", ""), change.Kind, change.DetectedAt.Unix()),
+			Type:       change.Kind,
+			RouteCode:  change.RouteCode,
+			OccurredAt: change.DetectedAt,
+			Change:     &change,
+		})
+	}
+
+	threshold := subscription.FillThreshold
+	if threshold > 0 && contains(subscription.EventTypes, models.EventFillThreshold) {
+		for i := range fills {
+			fill := fills[i]
+			if !wantsRoute(subscription, fill.RouteCode) || fill.PreviousFill >= threshold || fill.CurrentFill < threshold {
+				continue
+			}
+
+			events = append(events, models.WebhookEvent{
+				ID:         fmt.Sprintf("fill:%s:%s:%s:%d", fill.RouteCode, fill.SailingDate, strings.ReplaceAll(fill.DepartureTime, " ", ""), threshold),
+				Type:       models.EventFillThreshold,
+				RouteCode:  fill.RouteCode,
+				OccurredAt: fill.DetectedAt,
+				Fill:       &fill,
+				Threshold:  threshold,
+			})
+		}
+	}
+
+	return events
+}
+
+/*
+ * Sign
+ *
+ * Signs a delivery as the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with
+ * the subscription's secret. Receivers should recompute it and compare, and
+ * reject old timestamps to stop replays.
+ *
+ * @param string secret
+ * @param string timestamp - Unix seconds, as sent in the timestamp header
+ * @param []byte body
+ *
+ * @return string - "sha256=<hex>"
+ */
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+ * deliver
+ *
+ * POSTs an event to a subscription until it is accepted with a 2xx, the
+ * subscriber rejects it with a 4xx other than 408 or 429, its host resolves to
+ * a blocked address, or the attempts run out. Failed deliveries are saved as
+ * dead letters.
+ *
+ * @param *http.Client client
+ * @param models.Subscription subscription
+ * @param models.WebhookEvent event
+ *
+ * @return void
+ */
+func deliver(client *http.Client, subscription models.Subscription, event models.WebhookEvent) {
+	body, _ := json.Marshal(event)
+	maxAttempts := maxAttempts()
+
+	var status, attempts int
+	var err error
+	for attempts < maxAttempts {
+		if attempts > 0 {
+			time.Sleep(backoff(attempts - 1))
+		}
+		attempts++
+
+		status, err = post(client, subscription, event, body)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, ErrBlockedAddress) || (status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests) {
+			break
+		}
+	}
+
+	log.Printf("webhooks: delivery of %s to subscription %d failed after %d attempts: %v", event.ID, subscription.ID, attempts, err)
+	deadLetter(subscription, event, attempts, status, err)
+}
+
+/*
+ * deadLetter
+ *
+ * Saves an event that couldn't be delivered to a subscription.
+ *
+ * @param models.Subscription subscription
+ * @param models.WebhookEvent event
+ * @param int attempts - 0 if it was never sent
+ * @param int status - last response status, 0 if there was no response
+ * @param error err - why the last attempt failed
+ *
+ * @return void
+ */
+func deadLetter(subscription models.Subscription, event models.WebhookEvent, attempts int, status int, err error) {
+	body, _ := json.Marshal(event)
+	letter := models.DeadLetter{
+		SubscriptionID: subscription.ID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        body,
+		Attempts:       attempts,
+		LastStatus:     status,
+		LastError:      err.Error(),
+		FailedAt:       time.Now(),
+	}
+	if err := db.SaveDeadLetter(&letter); err != nil {
+		log.Printf("webhooks: failed to save dead letter for %s: %v", event.ID, err)
+	}
+}
+
+/*
+ * post
+ *
+ * Makes one delivery attempt.
+ *
+ * @param *http.Client client
+ * @param models.Subscription subscription
+ * @param models.WebhookEvent event
+ * @param []byte body
+ *
+ * @return int - response status, 0 if there was no response
+ * @return error - nil only for a 2xx response
+ */
+func post(client *http.Client, subscription models.Subscription, event models.WebhookEvent, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bc-ferries-api-webhooks")
+	req.Header.Set(EventHeader, event.Type)
+	req.Header.Set(DeliveryHeader, event.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the delay after each failed attempt, up to maxRetryDelay
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay() << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+func maxAttempts() int {
+	if config.Webhooks.MaxAttempts > 0 {
+		return config.Webhooks.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+func retryBaseDelay() time.Duration {
+	if config.Webhooks.RetryBaseDelay > 0 {
+		return config.Webhooks.RetryBaseDelay
+	}
+	return defaultRetryBaseDelay
+}
+
+func timeout() time.Duration {
+	if config.Webhooks.Timeout > 0 {
+		return config.Webhooks.Timeout
+	}
+	return defaultTimeout
+}
+
+func queueSize() int {
+	if config.Webhooks.QueueSize > 0 {
+		return config.Webhooks.QueueSize
+	}
+	return defaultQueueSize
+}
+
+// wantsRoute reports whether a subscription covers a route; no route codes means every route
+func wantsRoute(subscription models.Subscription, routeCode string) bool {
+	return len(subscription.RouteCodes) == 0 || contains(subscription.RouteCodes, routeCode)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samuel-pratt/bc-ferries-api/cmd/config"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/db"
+	"github.com/samuel-pratt/bc-ferries-api/cmd/models"
+)
+
+// allowLoopback lets deliveries reach httptest servers for the rest of the test
+func allowLoopback(t *testing.T) {
+	blockedAddress = func(net.IP) bool { return false }
+	t.Cleanup(func() { blockedAddress = isInternalAddress })
+}
+
+func TestEvents(t *testing.T) {
+	detectedAt := time.Date(2024, 6, 1, 15, 0, 0, 0, time.UTC)
+	changes := []models.ServiceChange{
+		{ID: 1, RouteCode: "TSASWB", Kind: models.ChangeCancelled, SailingDate: "2024-06-01", DepartureTime: "7:00 pm", DetectedAt: detectedAt},
+		{ID: 2, RouteCode: "TSASWB", Kind: models.ChangeVesselChanged, DetectedAt: detectedAt},
+		{ID: 3, RouteCode: "HSBNAN", Kind: models.ChangeCancelled, DetectedAt: detectedAt},
+	}
+	fills := []models.FillChange{
+		{RouteCode: "TSASWB", SailingDate: "2024-06-01", DepartureTime: "5:00 pm", PreviousFill: 85, CurrentFill: 92, DetectedAt: detectedAt},
+		{RouteCode: "TSASWB", SailingDate: "2024-06-01", DepartureTime: "7:00 pm", PreviousFill: 92, CurrentFill: 95, DetectedAt: detectedAt},
+		{RouteCode: "TSASWB", SailingDate: "2024-06-01", DepartureTime: "9:00 pm", PreviousFill: 50, CurrentFill: 60, DetectedAt: detectedAt},
+	}
+
+	subscription := models.Subscription{
+		RouteCodes:    []string{"TSASWB"},
+		EventTypes:    []string{models.ChangeCancelled, models.EventFillThreshold},
+		FillThreshold: 90,
+	}
+
+	got := Events(subscription, changes, fills)
+	if len(got) != 2 {
+		t.Fatalf("Events = %+v, want 2", got)
+	}
+	if got[0].ID != "change:TSASWB:2024-06-01:7:00pm:cancelled:1717254000" || got[0].Type != models.ChangeCancelled || got[0].Change.ID != 1 {
+		t.Errorf("change event = %+v", got[0])
+	}
+	if got[1].ID != "fill:TSASWB:2024-06-01:5:00pm:90" || got[1].Threshold != 90 || got[1].Fill.CurrentFill != 92 || !got[1].OccurredAt.Equal(detectedAt) {
+		t.Errorf("fill event = %+v", got[1])
+	}
+
+	// No route codes means every route
+	subscription.RouteCodes = []string{}
+	if got := Events(subscription, changes, nil); len(got) != 2 {
+		t.Errorf("Events for every route = %+v, want 2", got)
+	}
+}
+
+func TestEnqueueAll_RetriesAndDeadLetters(t *testing.T) {
+	allowLoopback(t)
+	db.SetStore(db.NewMemoryStore())
+	config.Webhooks = config.WebhookConfig{MaxAttempts: 3, RetryBaseDelay: time.Millisecond, Timeout: time.Second}
+	defer func() { config.Webhooks = config.WebhookConfig{} }()
+
+	var flakyCalls, failingCalls int32
+	var verified atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flakyCalls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) == Sign("flaky", r.Header.Get(TimestampHeader), body) && r.Header.Get(DeliveryHeader) == "change:TSASWB:2024-06-01:7:00pm:cancelled:0" {
+			verified.Store(true)
+		}
+	}))
+	defer flaky.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failingCalls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	flakySubscription := models.Subscription{URL: flaky.URL, Secret: "flaky", RouteCodes: []string{}, EventTypes: []string{models.ChangeCancelled}}
+	failingSubscription := models.Subscription{URL: failing.URL, Secret: "failing", RouteCodes: []string{}, EventTypes: []string{models.ChangeCancelled}}
+	for _, subscription := range []*models.Subscription{&flakySubscription, &failingSubscription} {
+		if err := db.SaveSubscription(subscription); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Not saved, so no database ID
+	detectedAt := time.Unix(0, 0)
+	var wg sync.WaitGroup
+	enqueueAll([]models.ServiceChange{{RouteCode: "TSASWB", Kind: models.ChangeCancelled, SailingDate: "2024-06-01", DepartureTime: "7:00 pm", DetectedAt: detectedAt}}, nil, &wg)
+	wg.Wait()
+
+	if flakyCalls != 2 || !verified.Load() {
+		t.Errorf("flaky subscriber: %d calls, signature verified %v; want 2 calls and a verified signature", flakyCalls, verified.Load())
+	}
+	if letters := db.GetDeadLetters(flakySubscription.ID, 10); len(letters) != 0 {
+		t.Errorf("flaky subscriber dead letters = %+v, want none", letters)
+	}
+
+	if failingCalls != 3 {
+		t.Errorf("failing subscriber: %d calls, want 3", failingCalls)
+	}
+	letters := db.GetDeadLetters(failingSubscription.ID, 10)
+	if len(letters) != 1 || letters[0].EventID != "change:TSASWB:2024-06-01:7:00pm:cancelled:0" || letters[0].Attempts != 3 || letters[0].LastStatus != http.StatusInternalServerError {
+		t.Fatalf("failing subscriber dead letters = %+v", letters)
+	}
+	var event models.WebhookEvent
+	if err := json.Unmarshal(letters[0].Payload, &event); err != nil || event.Type != models.ChangeCancelled {
+		t.Errorf("dead letter payload = %s", letters[0].Payload)
+	}
+}
+
+func TestNotify_DeliversInOrder(t *testing.T) {
+	allowLoopback(t)
+	db.SetStore(db.NewMemoryStore())
+
+	var mu sync.Mutex
+	var delivered []string
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		delivered = append(delivered, r.Header.Get(DeliveryHeader))
+		mu.Unlock()
+	}))
+	defer subscriber.Close()
+
+	subscription := models.Subscription{URL: subscriber.URL, Secret: "ordered", RouteCodes: []string{}, EventTypes: []string{models.ChangeCancelled, models.ChangeAdded}}
+	if err := db.SaveSubscription(&subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		change := models.ServiceChange{RouteCode: "TSASWB", Kind: models.ChangeCancelled, SailingDate: "2024-06-01", DepartureTime: "7:00 pm", DetectedAt: time.Unix(int64(i), 0)}
+		if i%2 == 1 {
+			change.Kind = models.ChangeAdded
+		}
+		want = append(want, Events(subscription, []models.ServiceChange{change}, nil)[0].ID)
+		if i < 4 {
+			Notify([]models.ServiceChange{change}, nil)
+			continue
+		}
+		// Queued behind the notifications, so they have all been delivered once it is
+		var wg sync.WaitGroup
+		enqueueAll([]models.ServiceChange{change}, nil, &wg)
+		wg.Wait()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != len(want) {
+		t.Fatalf("delivered %v, want %v", delivered, want)
+	}
+	for i := range want {
+		if delivered[i] != want[i] {
+			t.Errorf("delivery %d = %s, want %s", i, delivered[i], want[i])
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://203.0.113.10/hook", false},
+		{"http://127.0.0.1:8080/hook", true},
+		{"http://[::1]/hook", true},
+		{"http://10.1.2.3/hook", true},
+		{"http://192.168.0.1/hook", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://100.100.100.200/", true},
+		{"http://0.0.0.0/", true},
+		{"http://localhost/hook", true},
+	}
+
+	for _, tt := range tests {
+		err := CheckURL(context.Background(), tt.url)
+		if blocked := errors.Is(err, ErrBlockedAddress); blocked != tt.blocked {
+			t.Errorf("CheckURL(%s) = %v, want blocked %v", tt.url, err, tt.blocked)
+		}
+	}
+}
+
+func TestDeliver_RefusesInternalAddressesAndRedirects(t *testing.T) {
+	db.SetStore(db.NewMemoryStore())
+	config.Webhooks = config.WebhookConfig{MaxAttempts: 3, RetryBaseDelay: time.Millisecond, Timeout: time.Second}
+	defer func() { config.Webhooks = config.WebhookConfig{} }()
+
+	var internalCalls int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&internalCalls, 1)
+	}))
+	defer internal.Close()
+
+	// Without allowLoopback, the server's loopback address is refused when dialling
+	event := models.WebhookEvent{ID: "change:1", Type: models.ChangeCancelled}
+	deliver(newClient(), models.Subscription{ID: 1, URL: internal.URL}, event)
+	if internalCalls != 0 {
+		t.Errorf("internal subscriber got %d calls, want none", internalCalls)
+	}
+	if letters := db.GetDeadLetters(1, 10); len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("dead letters = %+v, want one after a single attempt", letters)
+	}
+
+	allowLoopback(t)
+	redirect := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+	deliver(newClient(), models.Subscription{ID: 2, URL: redirect.URL}, event)
+	if internalCalls != 0 {
+		t.Errorf("redirect followed to %s", internal.URL)
+	}
+	if letters := db.GetDeadLetters(2, 10); len(letters) != 1 || letters[0].LastStatus != http.StatusTemporaryRedirect {
+		t.Errorf("dead letters = %+v, want one with the redirect status", letters)
+	}
+}
+
+func TestEnqueueAll_DeadLettersOverflowAndDropsDeletedSubscriptions(t *testing.T) {
+	allowLoopback(t)
+	db.SetStore(db.NewMemoryStore())
+	config.Webhooks = config.WebhookConfig{QueueSize: 2}
+	defer func() { config.Webhooks = config.WebhookConfig{} }()
+
+	var calls int32
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer subscriber.Close()
+
+	subscription := models.Subscription{URL: subscriber.URL, Secret: "slow", RouteCodes: []string{}, EventTypes: []string{models.ChangeCancelled}}
+	if err := db.SaveSubscription(&subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []models.ServiceChange
+	for i := 0; i < 4; i++ {
+		changes = append(changes, models.ServiceChange{RouteCode: "TSASWB", Kind: models.ChangeCancelled, DetectedAt: time.Unix(int64(i), 0)})
+	}
+
+	var wg sync.WaitGroup
+	enqueueAll(changes, nil, &wg)
+
+	// Two fit in the queue, the rest are dead lettered unsent
+	letters := db.GetDeadLetters(subscription.ID, 10)
+	if len(letters) != 2 || letters[0].Attempts != 0 || letters[0].LastError != ErrQueueFull.Error() {
+		t.Fatalf("dead letters = %+v, want the two events past the queue size", letters)
+	}
+
+	// Deleted while the first delivery is in flight, so the second is never sent
+	<-arrived
+	if _, err := db.DeleteSubscription(subscription.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("subscriber got %d calls, want 1", calls)
+	}
+}